@@ -2,13 +2,18 @@ package main
 
 import (
 	"os"
+	"strconv"
 	"strings"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/diwise/api-pointofinterest/internal/pkg/application"
 	"github.com/diwise/api-pointofinterest/internal/pkg/application/services"
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/elevation"
 	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/deadletter"
 	"github.com/diwise/messaging-golang/pkg/messaging"
 	"github.com/diwise/messaging-golang/pkg/messaging/telemetry"
 )
@@ -24,8 +29,110 @@ func main() {
 	sourceURL := os.Getenv("SOURCE_DATA_URL")
 	apiKey := os.Getenv("SOURCE_DATA_APIKEY")
 	trailStatusURL := os.Getenv("PREPARATION_STATUS_URL")
+	beachEnrichmentPath := os.Getenv("BEACH_ENRICHMENT_PATH")
+	fieldMappingPath := os.Getenv("FIELD_MAPPING_PATH")
+	elevationModelPath := os.Getenv("ELEVATION_MODEL_PATH")
+	difficultyRulesPath := os.Getenv("DIFFICULTY_RULES_PATH")
+	trailSeasonsPath := os.Getenv("TRAIL_SEASONS_PATH")
+	waterTemperatureMaxAge := os.Getenv("WATER_TEMPERATURE_MAX_AGE_HOURS")
+	waterTemperatureStaleAction := os.Getenv("WATER_TEMPERATURE_STALE_ACTION")
+	sensorIDPrefix, hasSensorIDPrefix := os.LookupEnv("SENSOR_ID_PREFIX")
+	deadLetterPath := os.Getenv("DEAD_LETTER_PATH")
+	localEntitiesPath := os.Getenv("LOCAL_ENTITIES_PATH")
+	deviceRegistryPath := os.Getenv("DEVICE_REGISTRY_PATH")
+	preparationHistoryPath := os.Getenv("PREPARATION_HISTORY_PATH")
 
-	db, err := database.NewDatabaseConnection(sourceURL, apiKey, logger)
+	dbOptions := []database.Option{}
+
+	if fieldMappingPath != "" {
+		data, err := os.ReadFile(fieldMappingPath)
+		if err != nil {
+			panic(err.Error())
+		}
+
+		mapping, err := database.ParseFieldMapping(data)
+		if err != nil {
+			panic(err.Error())
+		}
+
+		dbOptions = append(dbOptions, database.WithFieldMapping(mapping))
+	}
+
+	if elevationModelPath != "" {
+		model, err := elevation.LoadFromFile(elevationModelPath, os.Getenv("ELEVATION_MODEL_CRS"))
+		if err != nil {
+			panic(err.Error())
+		}
+
+		dbOptions = append(dbOptions, database.WithElevationModel(model))
+	}
+
+	if difficultyRulesPath != "" {
+		data, err := os.ReadFile(difficultyRulesPath)
+		if err != nil {
+			panic(err.Error())
+		}
+
+		rules, err := database.ParseDifficultyRules(data)
+		if err != nil {
+			panic(err.Error())
+		}
+
+		dbOptions = append(dbOptions, database.WithDifficultyRules(rules))
+	}
+
+	if trailSeasonsPath != "" {
+		data, err := os.ReadFile(trailSeasonsPath)
+		if err != nil {
+			panic(err.Error())
+		}
+
+		seasons, err := database.ParseTrailSeasons(data)
+		if err != nil {
+			panic(err.Error())
+		}
+
+		dbOptions = append(dbOptions, database.WithTrailSeasons(seasons))
+	}
+
+	if waterTemperatureMaxAge != "" || waterTemperatureStaleAction != "" {
+		staleness := database.WaterTemperatureStaleness{
+			MaxAge: database.DefaultWaterTemperatureMaxAge,
+			Action: database.StaleWaterTemperatureFlag,
+		}
+
+		if waterTemperatureMaxAge != "" {
+			hours, err := strconv.ParseFloat(waterTemperatureMaxAge, 64)
+			if err != nil {
+				panic("WATER_TEMPERATURE_MAX_AGE_HOURS must be a number")
+			}
+			staleness.MaxAge = time.Duration(hours * float64(time.Hour))
+		}
+
+		if waterTemperatureStaleAction != "" {
+			staleness.Action = waterTemperatureStaleAction
+		}
+
+		dbOptions = append(dbOptions, database.WithWaterTemperatureStaleness(staleness))
+	}
+
+	if hasSensorIDPrefix {
+		dbOptions = append(dbOptions, database.WithSensorIDPrefix(sensorIDPrefix))
+	}
+
+	if localEntitiesPath != "" {
+		dbOptions = append(dbOptions, database.WithLocalEntitiesPath(localEntitiesPath))
+	}
+
+	if deviceRegistryPath != "" {
+		dbOptions = append(dbOptions, database.WithDeviceRegistryPath(deviceRegistryPath))
+	}
+
+	if preparationHistoryPath != "" {
+		dbOptions = append(dbOptions, database.WithPreparationHistoryPath(preparationHistoryPath))
+	}
+
+	db, err := database.NewDatabaseConnection(sourceURL, apiKey, logger, dbOptions...)
 	if err != nil {
 		panic(err.Error())
 	}
@@ -34,11 +141,23 @@ func main() {
 	messenger, _ := messaging.Initialize(config)
 	defer messenger.Close()
 
-	h := application.CreateWaterTempReceiver(db)
+	deadLetters, err := deadletter.NewStore(deadLetterPath, deadletter.DefaultCapacity)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	wtp := application.NewWaterTemperatureProcessor(db, deadLetters)
+
+	h := application.CreateWaterTempReceiver(wtp)
 	messenger.RegisterTopicMessageHandler((&telemetry.WaterTemperature{}).TopicName(), h)
 
 	tps := services.NewTrailPreparationService(logger, trailStatusURL, db)
 	defer tps.Shutdown()
 
-	application.CreateRouterAndStartServing(db, logger)
+	if beachEnrichmentPath != "" {
+		bes := services.NewBeachEnrichmentService(logger, beachEnrichmentPath, db)
+		defer bes.Shutdown()
+	}
+
+	application.CreateRouterAndStartServing(db, wtp, logger)
 }
@@ -7,6 +7,7 @@ require (
 	github.com/diwise/ngsi-ld-golang v0.0.0-20220107175243-ec4570c83cdd
 	github.com/go-chi/chi/v5 v5.0.0
 	github.com/go-chi/httplog v0.2.1
+	github.com/gorilla/websocket v1.4.2
 	github.com/matryer/is v1.4.0
 	github.com/rabbitmq/amqp091-go v1.2.0
 	github.com/rs/cors v1.8.2
@@ -0,0 +1,180 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/diwise"
+	"github.com/go-chi/chi/v5"
+)
+
+type trailStatusOverride struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+	Until  string `json:"until,omitempty"`
+}
+
+func trailIDFromRequest(r *http.Request) (string, bool) {
+	entityID, _ := url.QueryUnescape(chi.URLParam(r, "entity"))
+	if !strings.HasPrefix(entityID, diwise.ExerciseTrailIDPrefix) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(entityID, diwise.ExerciseTrailIDPrefix), true
+}
+
+//newSetTrailStatusOverrideHandler returns a handler that sets a manual status for a trail, that takes
+//precedence over the season and the status reported by sources until it expires or is removed
+func newSetTrailStatusOverrideHandler(db database.Datastore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		trailID, ok := trailIDFromRequest(r)
+		if !ok {
+			http.Error(w, "status overrides are only supported for exercise trails", http.StatusNotFound)
+			return
+		}
+
+		override := trailStatusOverride{}
+		err := json.NewDecoder(r.Body).Decode(&override)
+		if err != nil {
+			http.Error(w, "failed to decode request body", http.StatusBadRequest)
+			return
+		}
+
+		statusOverride := &domain.StatusOverride{Status: override.Status, Reason: override.Reason}
+
+		if override.Until != "" {
+			statusOverride.Until, err = time.Parse(time.RFC3339, override.Until)
+			if err != nil {
+				http.Error(w, "until must be a valid RFC3339 timestamp", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if _, err = db.GetTrailFromID(trailID); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		err = db.SetTrailStatusOverride(trailID, statusOverride)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newDeleteTrailStatusOverrideHandler(db database.Datastore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		trailID, ok := trailIDFromRequest(r)
+		if !ok {
+			http.Error(w, "status overrides are only supported for exercise trails", http.StatusNotFound)
+			return
+		}
+
+		err := db.SetTrailStatusOverride(trailID, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func decodeLightingSchedule(r *http.Request) (*domain.LightingSchedule, error) {
+	schedule := lightingSchedule{}
+	err := json.NewDecoder(r.Body).Decode(&schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode request body")
+	}
+
+	ls := &domain.LightingSchedule{From: schedule.From, To: schedule.To}
+	return ls, ls.Validate()
+}
+
+//newSetTrailLightingScheduleHandler returns a handler that sets the lighting schedule of a floodlit trail
+func newSetTrailLightingScheduleHandler(db database.Datastore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		trailID, ok := trailIDFromRequest(r)
+		if !ok {
+			http.Error(w, "lighting schedules are only supported for exercise trails", http.StatusNotFound)
+			return
+		}
+
+		schedule, err := decodeLightingSchedule(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = db.SetTrailLightingSchedule(trailID, schedule)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newDeleteTrailLightingScheduleHandler(db database.Datastore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		trailID, ok := trailIDFromRequest(r)
+		if !ok {
+			http.Error(w, "lighting schedules are only supported for exercise trails", http.StatusNotFound)
+			return
+		}
+
+		err := db.SetTrailLightingSchedule(trailID, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+//newSetAreaLightingScheduleHandler returns a handler that sets the lighting schedule for all floodlit
+//trails in an area, that do not have a schedule of their own
+func newSetAreaLightingScheduleHandler(db database.Datastore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		area, _ := url.QueryUnescape(chi.URLParam(r, "area"))
+
+		schedule, err := decodeLightingSchedule(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = db.SetAreaLightingSchedule(area, schedule)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newDeleteAreaLightingScheduleHandler(db database.Datastore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		area, _ := url.QueryUnescape(chi.URLParam(r, "area"))
+
+		err := db.SetAreaLightingSchedule(area, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
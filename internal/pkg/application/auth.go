@@ -0,0 +1,25 @@
+package application
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+//newTokenAuthenticator returns a middleware that only lets requests through that carry the
+//configured token as a bearer token in the Authorization header
+func newTokenAuthenticator(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+			if len(authorization) != 2 || !strings.EqualFold(authorization[0], "Bearer") ||
+				subtle.ConstantTimeCompare([]byte(strings.TrimSpace(authorization[1])), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api-pointofinterest"`)
+				http.Error(w, "a valid bearer token is required", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package application
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/deadletter"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/diwise"
+	"github.com/matryer/is"
+	"github.com/rs/zerolog"
+)
+
+func TestThatRoutesThatModifyEntitiesRequireTheAdminToken(t *testing.T) {
+	is := is.New(t)
+	logger := zerolog.New(ioutil.Discard)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(trailsWithAndWithoutGeometry))
+	}))
+	defer server.Close()
+
+	db, err := database.NewDatabaseConnection(server.URL, "apikey", logger)
+	is.NoErr(err)
+
+	deadLetters, err := deadletter.NewStore("", deadletter.DefaultCapacity)
+	is.NoErr(err)
+
+	contexts, err := newJSONLDContexts("", nil)
+	is.NoErr(err)
+
+	ctxSource := newContextSource(db, logger)
+	newRouter := func(adminToken string) *RequestRouter {
+		return createRequestRouter(nil, ctxSource, db, NewWaterTemperatureProcessor(db, deadLetters),
+			contexts, newResponseCaching("", db), []string{"*"}, adminToken, logger)
+	}
+
+	trailPath := "/ngsi-ld/v1/entities/" + url.QueryEscape(diwise.ExerciseTrailIDPrefix+database.SundsvallAnlaggningPrefix+"701")
+	statusPath := "/admin/trails/" + url.QueryEscape(diwise.ExerciseTrailIDPrefix+database.SundsvallAnlaggningPrefix+"701") + "/status"
+
+	serve := func(router *RequestRouter, method, path, authorization string) int {
+		r := httptest.NewRequest(method, path, nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		router.impl.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	withoutToken := newRouter("")
+	is.Equal(serve(withoutToken, http.MethodGet, "/ngsi-ld/v1/types", ""), http.StatusOK)                   // reading entities should not require a token
+	is.Equal(serve(withoutToken, http.MethodDelete, trailPath, "Bearer "), http.StatusMethodNotAllowed)     // entities should not be deleted when no token is configured
+	is.Equal(serve(withoutToken, http.MethodDelete, statusPath, "Bearer "), http.StatusNotFound)            // admin routes should not be served when no token is configured
+	is.Equal(serve(withoutToken, http.MethodGet, "/admin/deadletters", ""), http.StatusNotFound)            // admin routes should not be served when no token is configured
+	is.Equal(serve(withoutToken, http.MethodPost, "/ngsi-ld/v1/entities", ""), http.StatusMethodNotAllowed) // entities should not be created when no token is configured
+
+	withToken := newRouter("s3cret")
+	is.Equal(serve(withToken, http.MethodGet, "/ngsi-ld/v1/types", ""), http.StatusOK)
+	is.Equal(serve(withToken, http.MethodDelete, statusPath, ""), http.StatusUnauthorized)             // a request without a token should be rejected
+	is.Equal(serve(withToken, http.MethodDelete, statusPath, "Bearer wrong"), http.StatusUnauthorized) // a request with the wrong token should be rejected
+	is.Equal(serve(withToken, http.MethodDelete, statusPath, "Basic s3cret"), http.StatusUnauthorized) // the token should be sent as a bearer token
+	is.Equal(serve(withToken, http.MethodDelete, trailPath, "Bearer wrong"), http.StatusUnauthorized)  // entities should not be deleted without the token
+	is.Equal(serve(withToken, http.MethodDelete, statusPath, "Bearer s3cret"), http.StatusNoContent)   // a request with the token should be served
+	is.Equal(serve(withToken, http.MethodGet, "/admin/deadletters", "Bearer s3cret"), http.StatusOK)
+}
@@ -0,0 +1,259 @@
+package application
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/go-chi/chi/v5"
+)
+
+const defaultCacheControl string = "public, no-cache"
+
+//responseCaching adds validators and caching directives to entity responses, and answers conditional
+//requests with 304 Not Modified when the representation has not changed
+type responseCaching struct {
+	cacheControl string
+	now          func() time.Time
+
+	mu         sync.Mutex
+	lastChange time.Time
+	changedAt  map[string]time.Time
+}
+
+//newResponseCaching creates response caching that also follows the changes of the datastore, since
+//not every change of an entity is reflected in its timestamps
+func newResponseCaching(cacheControl string, db database.Datastore) *responseCaching {
+	if cacheControl == "" {
+		cacheControl = defaultCacheControl
+	}
+
+	rc := &responseCaching{
+		cacheControl: cacheControl,
+		now:          time.Now,
+		changedAt:    map[string]time.Time{},
+	}
+
+	db.AddChangeListener(rc.recordChange)
+
+	return rc
+}
+
+//recordChange is registered as a change listener, and keeps the time of the latest change of each
+//entity, including deletions, and of any entity
+func (rc *responseCaching) recordChange(change database.EntityChange) {
+	_, entityID, err := changedEntity(change)
+	if err != nil {
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.lastChange = rc.now().UTC()
+	rc.changedAt[entityID] = rc.lastChange
+}
+
+//lastChanged returns the time of the latest change of the requested entity, or of any entity when a
+//list of entities is requested, that has been applied since the service started
+func (rc *responseCaching) lastChanged(r *http.Request) time.Time {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if entityID, _ := url.QueryUnescape(chi.URLParam(r, "entity")); entityID != "" {
+		return rc.changedAt[entityID]
+	}
+
+	return rc.lastChange
+}
+
+//timestampAttributes are the attributes that hold the times when the entities of a representation changed
+var timestampAttributes = map[string]bool{"dateModified": true, "dateLastPreparation": true, "observedAt": true}
+
+//timeDependentAttributes are attributes whose values change with time, and not only when an entity is
+//modified, such as lightsOn that follows the lighting schedule and status that follows the season
+var timeDependentAttributes = map[string]bool{"hoursSinceLastPreparation": true, "lightsOn": true, "stale": true, "status": true}
+
+//attributeTerm returns the short name of an attribute, which may have been expanded to an IRI when the
+//response is compacted with another @context
+func attributeTerm(key string) string {
+	return key[strings.LastIndexAny(key, "/#:")+1:]
+}
+
+//timestampOf returns the time of a DateTime value in any of the representations of an attribute
+func timestampOf(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		return t, err == nil
+	case map[string]interface{}:
+		if nested, ok := v["@value"]; ok {
+			return timestampOf(nested)
+		}
+		return timestampOf(v["value"])
+	case []interface{}:
+		latest := time.Time{}
+		for _, item := range v {
+			if t, ok := timestampOf(item); ok && t.After(latest) {
+				latest = t
+			}
+		}
+		return latest, !latest.IsZero()
+	}
+
+	return time.Time{}, false
+}
+
+//representationTimes returns the latest of the dateModified, dateLastPreparation and observedAt times
+//in a representation of one or more entities, and whether it contains attributes that change with time
+func representationTimes(body []byte) (latest time.Time, timeDependent bool) {
+	var representation interface{}
+	if json.Unmarshal(body, &representation) != nil {
+		return time.Time{}, false
+	}
+
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, member := range v {
+				term := attributeTerm(key)
+				if timeDependentAttributes[term] {
+					timeDependent = true
+				}
+
+				if timestampAttributes[term] {
+					if t, ok := timestampOf(member); ok && t.After(latest) {
+						latest = t
+					}
+				}
+
+				walk(member)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+
+	walk(representation)
+
+	return latest.UTC(), timeDependent
+}
+
+//lastModified returns the Last-Modified time of a representation, that is the latest of the timestamps
+//of its entities and of the changes that have been applied to them. It is capped at the time of the
+//request, and is the time of the request when the representation contains attributes that change with
+//time. evaluate is false in that case, since If-Modified-Since can not tell if such a representation
+//has changed.
+func (rc *responseCaching) lastModified(r *http.Request, body []byte) (lastModified time.Time, evaluate bool) {
+	lastModified, timeDependent := representationTimes(body)
+
+	if changed := rc.lastChanged(r); changed.After(lastModified) {
+		lastModified = changed
+	}
+
+	now := rc.now().UTC()
+	if timeDependent || lastModified.After(now) {
+		lastModified = now
+	}
+
+	return lastModified, !timeDependent
+}
+
+//entityETag identifies a representation of entities. Since attributes such as hoursSinceLastPreparation
+//and lightsOn change with time and not only when an entity is modified, the ETag is computed from the
+//generated body, together with the headers that select the @context of the response.
+func entityETag(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write(body)
+	hash.Write([]byte("\n" + r.Header.Get("Accept") + "\n" + strings.Join(r.Header.Values("Link"), ",")))
+
+	return "\"" + hex.EncodeToString(hash.Sum(nil))[:32] + "\""
+}
+
+//etagMatches compares the ETags of an If-None-Match header using the weak comparison of RFC 7232
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+//notModified evaluates If-None-Match, or If-Modified-Since when no If-None-Match is present and the
+//last modification time is known
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, etag)
+	}
+
+	if lastModified.IsZero() {
+		return false
+	}
+
+	ifModifiedSince, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	return !lastModified.Truncate(time.Second).After(ifModifiedSince)
+}
+
+//handler wraps a handler that returns entities with ETag, Last-Modified and Cache-Control headers
+func (rc *responseCaching) handler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		buffer := &bufferedResponseWriter{header: http.Header{}}
+		next(buffer, r)
+
+		for key, values := range buffer.header {
+			w.Header()[key] = values
+		}
+
+		if buffer.statusCode == 0 {
+			buffer.statusCode = http.StatusOK
+		}
+
+		if buffer.statusCode != http.StatusOK || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			w.WriteHeader(buffer.statusCode)
+			w.Write(buffer.body.Bytes())
+			return
+		}
+
+		body := buffer.body.Bytes()
+		etag := entityETag(r, body)
+		lastModified, evaluate := rc.lastModified(r, body)
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", rc.cacheControl)
+		w.Header().Add("Vary", "Accept, Link")
+
+		if !lastModified.IsZero() {
+			w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		}
+
+		if !evaluate {
+			lastModified = time.Time{}
+		}
+
+		if notModified(r, etag, lastModified) {
+			w.Header().Del("Content-Type")
+			w.Header().Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
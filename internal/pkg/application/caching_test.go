@@ -0,0 +1,96 @@
+package application
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/diwise"
+	"github.com/go-chi/chi/v5"
+	"github.com/matryer/is"
+	"github.com/rs/zerolog"
+)
+
+func TestThatLastModifiedIsDerivedFromTheTimestampsOfTheEntities(t *testing.T) {
+	is := is.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(trailsWithAndWithoutGeometry))
+	}))
+	defer server.Close()
+
+	db, err := database.NewDatabaseConnection(server.URL, "apikey", zerolog.New(ioutil.Discard))
+	is.NoErr(err)
+
+	now := time.Date(2022, 1, 15, 12, 0, 0, 0, time.UTC)
+	caching := newResponseCaching("", db)
+	caching.now = func() time.Time { return now }
+
+	body := ""
+	router := chi.NewRouter()
+	entities := caching.handler(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})
+	router.Get("/ngsi-ld/v1/entities/{entity}", entities)
+	router.Get("/ngsi-ld/v1/entities", entities)
+
+	get := func(path string, ifModifiedSince time.Time) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if !ifModifiedSince.IsZero() {
+			r.Header.Set("If-Modified-Since", ifModifiedSince.UTC().Format(http.TimeFormat))
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	lastModified := func(w *httptest.ResponseRecorder) time.Time {
+		at, err := http.ParseTime(w.Header().Get("Last-Modified"))
+		is.NoErr(err)
+		return at
+	}
+
+	modified := time.Date(2022, 1, 10, 8, 0, 0, 0, time.UTC)
+	observed := time.Date(2022, 1, 14, 6, 30, 0, 0, time.UTC)
+
+	beachPath := "/ngsi-ld/v1/entities/" + url.QueryEscape("urn:ngsi-ld:Beach:1545")
+	body = `{"id":"urn:ngsi-ld:Beach:1545","type":"Beach",` +
+		`"dateModified":{"type":"Property","value":{"@type":"DateTime","@value":"2022-01-10T08:00:00Z"}}}`
+	is.Equal(lastModified(get(beachPath, time.Time{})), modified) // Last-Modified should be the dateModified of the entity
+	is.Equal(get(beachPath, modified).Code, http.StatusNotModified)
+	is.Equal(get(beachPath, modified.Add(-time.Second)).Code, http.StatusOK)
+
+	body = `{"id":"urn:ngsi-ld:Beach:1545","type":"Beach","dateModified":"2022-01-10T08:00:00Z",` +
+		`"waterTemperature":{"value":12.5,"observedAt":"2022-01-14T06:30:00Z"}}`
+	is.Equal(lastModified(get(beachPath, time.Time{})), observed) // a later observation of the water temperature should modify the entity
+	is.Equal(get(beachPath, modified).Code, http.StatusOK)
+
+	body = `[{"id":"urn:ngsi-ld:Beach:1545","dateModified":"2022-01-10T08:00:00Z"},` +
+		`{"id":"urn:ngsi-ld:Beach:1546","https://uri.fiware.org/ns/data-models#dateModified":"2022-01-12T08:00:00Z"}]`
+	is.Equal(lastModified(get("/ngsi-ld/v1/entities", time.Time{})), modified.Add(48*time.Hour)) // a list of entities was modified with the latest entity
+
+	body = `{"id":"urn:ngsi-ld:Beach:1545","type":"Beach","name":"Stranden"}`
+	is.Equal(get(beachPath, time.Time{}).Header().Get("Last-Modified"), "") // Last-Modified is unknown without timestamps
+	is.Equal(get(beachPath, modified).Code, http.StatusOK)
+
+	trailID := database.SundsvallAnlaggningPrefix + "701"
+	trailPath := "/ngsi-ld/v1/entities/" + url.QueryEscape(diwise.ExerciseTrailIDPrefix+trailID)
+	body = `{"id":"` + diwise.ExerciseTrailIDPrefix + trailID + `","type":"ExerciseTrail","dateModified":"2022-01-10T08:00:00Z",` +
+		`"dateLastPreparation":{"type":"Property","value":{"@type":"DateTime","@value":"2022-01-14T06:30:00Z"}},` +
+		`"hoursSinceLastPreparation":{"type":"Property","value":29.5}}`
+	is.Equal(lastModified(get(trailPath, time.Time{})), now)         // a representation that changes with time should be capped at the time of the request
+	is.Equal(get(trailPath, now.Add(time.Hour)).Code, http.StatusOK) // and If-Modified-Since should not be evaluated for it
+	is.Equal(get(beachPath, now.Add(time.Hour)).Code, http.StatusOK) // neither for an entity without timestamps
+
+	body = `{"id":"` + diwise.ExerciseTrailIDPrefix + trailID + `","type":"ExerciseTrail","dateModified":"2022-01-10T08:00:00Z"}`
+	is.Equal(get(trailPath, modified).Code, http.StatusNotModified)
+
+	now = now.Add(time.Hour)
+	is.NoErr(db.SetTrailOpenStatus(trailID, false))
+	is.Equal(lastModified(get(trailPath, time.Time{})), now) // a change that is not reflected in the timestamps should still modify the entity
+	is.Equal(get(trailPath, modified).Code, http.StatusOK)
+	is.Equal(lastModified(get(beachPath, time.Time{})), modified) // other entities are unaffected
+}
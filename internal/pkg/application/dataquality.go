@@ -0,0 +1,43 @@
+package application
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+)
+
+type dataQualityIssue struct {
+	EntityID  string `json:"entityId"`
+	Attribute string `json:"attribute"`
+	Message   string `json:"message"`
+}
+
+func newDataQualityReportHandler(db database.Datastore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		issues, err := db.GetDataQualityReport()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		report := []dataQualityIssue{}
+		for _, issue := range issues {
+			report = append(report, dataQualityIssue{
+				EntityID:  issue.EntityID,
+				Attribute: issue.Attribute,
+				Message:   issue.Message,
+			})
+		}
+
+		body, err := json.Marshal(report)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
@@ -0,0 +1,136 @@
+package application
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/deadletter"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+)
+
+type deadLetter struct {
+	ID          string          `json:"id"`
+	Topic       string          `json:"topic"`
+	Reason      string          `json:"reason"`
+	ReceivedAt  string          `json:"receivedAt"`
+	Attempts    int             `json:"attempts"`
+	LastAttempt string          `json:"lastAttempt,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+	RawBody     string          `json:"rawBody,omitempty"`
+}
+
+type replayResult struct {
+	Replayed int               `json:"replayed"`
+	Failed   map[string]string `json:"failed"`
+}
+
+func newDeadLetter(m deadletter.Message) deadLetter {
+	dl := deadLetter{
+		ID:          m.ID,
+		Topic:       m.Topic,
+		Reason:      m.Reason,
+		ReceivedAt:  m.ReceivedAt.Format(time.RFC3339),
+		Attempts:    m.Attempts,
+		LastAttempt: formatOptionalTime(m.LastAttempt),
+	}
+
+	// bodies that are not valid json, which is a common reason for rejection, are returned as text
+	if json.Valid(m.Body) {
+		dl.Body = m.Body
+	} else {
+		dl.RawBody = string(m.Body)
+	}
+
+	return dl
+}
+
+//newListDeadLettersHandler returns a handler that lists the rejected messages and the reasons they were rejected
+func newListDeadLettersHandler(store deadletter.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		messages, err := store.List()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		response := []deadLetter{}
+		for _, m := range messages {
+			response = append(response, newDeadLetter(m))
+		}
+
+		body, err := json.Marshal(response)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
+
+//newReplayDeadLetterHandler returns a handler that processes a rejected message again, for instance after
+//its device has been assigned to a beach
+func newReplayDeadLetterHandler(wtp *WaterTemperatureProcessor, logger zerolog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		if _, err := wtp.deadLetters.Get(id); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if err := wtp.Replay(id, logger); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+//newReplayAllDeadLettersHandler returns a handler that replays all rejected messages in the order they
+//were received, and reports the messages that were rejected again
+func newReplayAllDeadLettersHandler(wtp *WaterTemperatureProcessor, logger zerolog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		messages, err := wtp.deadLetters.List()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		result := replayResult{Failed: map[string]string{}}
+
+		for _, m := range messages {
+			if err := wtp.Replay(m.ID, logger); err != nil {
+				result.Failed[m.ID] = err.Error()
+			} else {
+				result.Replayed++
+			}
+		}
+
+		body, err := json.Marshal(result)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
+
+func newDeleteDeadLetterHandler(store deadletter.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := store.Remove(chi.URLParam(r, "id")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
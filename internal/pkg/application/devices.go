@@ -0,0 +1,194 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/fiware"
+	"github.com/go-chi/chi/v5"
+)
+
+type deviceLocation struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+type deviceAssignment struct {
+	DeviceID string          `json:"deviceID"`
+	Beach    string          `json:"beach,omitempty"`
+	Location *deviceLocation `json:"location,omitempty"`
+	From     string          `json:"from,omitempty"`
+	To       string          `json:"to,omitempty"`
+}
+
+func beachIDFromRequest(r *http.Request) (string, bool) {
+	entityID, _ := url.QueryUnescape(chi.URLParam(r, "entity"))
+	if !strings.HasPrefix(entityID, fiware.BeachIDPrefix) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(entityID, fiware.BeachIDPrefix), true
+}
+
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+//newListDeviceAssignmentsHandler returns a handler that lists the assignment history of sensors, either
+//for all beaches or for the beach in the url
+func newListDeviceAssignmentsHandler(db database.Datastore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		beachID := ""
+		if chi.URLParam(r, "entity") != "" {
+			var ok bool
+			if beachID, ok = beachIDFromRequest(r); !ok {
+				http.Error(w, "sensors can only be assigned to beaches", http.StatusNotFound)
+				return
+			}
+		}
+
+		assignments, err := db.GetDeviceAssignments(beachID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		response := []deviceAssignment{}
+		for _, a := range assignments {
+			da := deviceAssignment{
+				DeviceID: a.DeviceID,
+				Beach:    fiware.BeachIDPrefix + a.BeachID,
+				From:     formatOptionalTime(a.From),
+				To:       formatOptionalTime(a.To),
+			}
+
+			if a.Location != nil && len(a.Location.Coordinates) >= 2 {
+				da.Location = &deviceLocation{Lon: a.Location.Coordinates[0], Lat: a.Location.Coordinates[1]}
+			}
+
+			response = append(response, da)
+		}
+
+		body, err := json.Marshal(response)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
+
+//newAssignDeviceHandler returns a handler that assigns a sensor to the beach in the url, optionally
+//with the position of the sensor and the time the assignment starts
+func newAssignDeviceHandler(db database.Datastore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		beachID, ok := beachIDFromRequest(r)
+		if !ok {
+			http.Error(w, "sensors can only be assigned to beaches", http.StatusNotFound)
+			return
+		}
+
+		da := deviceAssignment{}
+		if err := json.NewDecoder(r.Body).Decode(&da); err != nil || da.DeviceID == "" {
+			http.Error(w, "request body must contain a deviceID", http.StatusBadRequest)
+			return
+		}
+
+		assignment := domain.DeviceAssignment{DeviceID: da.DeviceID, BeachID: beachID}
+
+		if da.Location != nil {
+			if math.Abs(da.Location.Lat) > 90 || math.Abs(da.Location.Lon) > 180 {
+				http.Error(w, "location must be valid WGS84 coordinates", http.StatusBadRequest)
+				return
+			}
+			assignment.Location = &domain.Point{Coordinates: []float64{da.Location.Lon, da.Location.Lat}}
+		}
+
+		if da.From != "" {
+			from, err := time.Parse(time.RFC3339, da.From)
+			if err != nil {
+				http.Error(w, "from must be formatted according to RFC3339", http.StatusBadRequest)
+				return
+			}
+			assignment.From = from.UTC()
+		}
+
+		if _, err := db.GetBeachFromID(beachID); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if err := db.AssignDeviceToBeach(assignment); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func newUnassignDeviceHandler(db database.Datastore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		beachID, ok := beachIDFromRequest(r)
+		if !ok {
+			http.Error(w, "sensors can only be assigned to beaches", http.StatusNotFound)
+			return
+		}
+
+		deviceID, _ := url.QueryUnescape(chi.URLParam(r, "device"))
+
+		err := db.UnassignDeviceFromBeach(deviceID, beachID, time.Time{})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("no active assignment of %s to %s", deviceID, fiware.BeachIDPrefix+beachID), http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+//newSetSensorAggregationHandler returns a handler that selects how readings from multiple sensors
+//at a beach are combined, using either the median or the sensor nearest to the swim area
+func newSetSensorAggregationHandler(db database.Datastore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		beachID, ok := beachIDFromRequest(r)
+		if !ok {
+			http.Error(w, "sensor aggregation is only supported for beaches", http.StatusNotFound)
+			return
+		}
+
+		request := struct {
+			Method string `json:"method"`
+		}{}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "failed to decode request body", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := db.GetBeachFromID(beachID); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if err := db.SetBeachSensorAggregation(beachID, request.Method); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
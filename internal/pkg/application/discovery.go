@@ -0,0 +1,407 @@
+package application
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/diwise"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/fiware"
+	ngsi "github.com/diwise/ngsi-ld-golang/pkg/ngsi-ld"
+	"github.com/go-chi/chi/v5"
+)
+
+//providedTypes lists the entity types that are served by the context source
+var providedTypes []string = []string{
+	fiware.BeachTypeName,
+	diwise.ExerciseTrailTypeName,
+	FireplaceTypeName,
+	OutdoorGymTypeName,
+	PlaygroundTypeName,
+	SportsFieldTypeName,
+}
+
+//typeDescription is what the context source currently knows about the entities of a type
+type typeDescription struct {
+	entityCount int
+	attributes  map[string]*attributeDescription
+}
+
+type attributeDescription struct {
+	count          int
+	attributeTypes map[string]bool
+}
+
+//entityAttributes returns the attributes of an entity in normalized form, without id, type and @context
+func entityAttributes(entity ngsi.Entity) (map[string]json.RawMessage, error) {
+	body, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := map[string]json.RawMessage{}
+	err = json.Unmarshal(body, &attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(attributes, "id")
+	delete(attributes, "type")
+	delete(attributes, "@context")
+
+	return attributes, nil
+}
+
+//typeDescriptionMaxAge limits how long a description is kept, since attributes such as a stale water
+//temperature come and go with time without any change being announced
+const typeDescriptionMaxAge time.Duration = time.Minute
+
+//typeDescriptionCache keeps the description of each type until an entity of the type changes. Only
+//beaches and exercise trails change after the datastore has been loaded.
+type typeDescriptionCache struct {
+	mu           sync.Mutex
+	descriptions map[string]*typeDescription
+	describedAt  map[string]time.Time
+	generations  map[string]int
+}
+
+func newTypeDescriptionCache() *typeDescriptionCache {
+	return &typeDescriptionCache{
+		descriptions: map[string]*typeDescription{},
+		describedAt:  map[string]time.Time{},
+		generations:  map[string]int{},
+	}
+}
+
+//invalidate is registered as a change listener, and is called while the datastore is locked
+func (c *typeDescriptionCache) invalidate(change database.EntityChange) {
+	typeName := fiware.BeachTypeName
+	if change.EntityType == database.EntityTypeExerciseTrail {
+		typeName = diwise.ExerciseTrailTypeName
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.descriptions, typeName)
+	c.generations[typeName]++
+}
+
+//describeTypes returns the descriptions of the provided types, and inspects the entities of the types
+//that have changed since they were last described. The descriptions must not be modified.
+func (cs *contextSource) describeTypes() (map[string]*typeDescription, error) {
+	descriptions := map[string]*typeDescription{}
+
+	for _, typeName := range providedTypes {
+		cs.types.mu.Lock()
+		description, ok := cs.types.descriptions[typeName]
+		expired := time.Since(cs.types.describedAt[typeName]) > typeDescriptionMaxAge
+		generation := cs.types.generations[typeName]
+		cs.types.mu.Unlock()
+
+		if !ok || expired {
+			var err error
+			if description, err = cs.describeType(typeName); err != nil {
+				return nil, err
+			}
+
+			//the cache is not locked while the datastore is queried, since changes are announced while
+			//the datastore is locked, and a description that was made during a change is not kept
+			cs.types.mu.Lock()
+			if cs.types.generations[typeName] == generation {
+				cs.types.descriptions[typeName] = description
+				cs.types.describedAt[typeName] = time.Now()
+			}
+			cs.types.mu.Unlock()
+		}
+
+		descriptions[typeName] = description
+	}
+
+	return descriptions, nil
+}
+
+//describeType inspects all entities of a type to find their attributes
+func (cs *contextSource) describeType(typeName string) (*typeDescription, error) {
+	description := &typeDescription{attributes: map[string]*attributeDescription{}}
+
+	err := cs.queryEntities([]string{typeName}, &queryFilter{}, func(entity ngsi.Entity) error {
+		attributes, err := entityAttributes(entity)
+		if err != nil {
+			return err
+		}
+
+		description.entityCount++
+
+		for name, value := range attributes {
+			attr, ok := description.attributes[name]
+			if !ok {
+				attr = &attributeDescription{attributeTypes: map[string]bool{}}
+				description.attributes[name] = attr
+			}
+
+			attributeType := struct {
+				Type string `json:"type"`
+			}{}
+			json.Unmarshal(value, &attributeType)
+
+			attr.count++
+			if attributeType.Type != "" {
+				attr.attributeTypes[attributeType.Type] = true
+			}
+		}
+
+		return nil
+	})
+
+	return description, err
+}
+
+func sortedNames(names map[string]bool) []string {
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (d *typeDescription) attributeNames() []string {
+	names := map[string]bool{}
+	for name := range d.attributes {
+		names[name] = true
+	}
+	return sortedNames(names)
+}
+
+type entityTypeList struct {
+	ID       string   `json:"id"`
+	Type     string   `json:"type"`
+	TypeList []string `json:"typeList"`
+}
+
+type entityType struct {
+	ID             string   `json:"id"`
+	Type           string   `json:"type"`
+	TypeName       string   `json:"typeName"`
+	AttributeNames []string `json:"attributeNames"`
+}
+
+type attributeDetails struct {
+	ID             string   `json:"id"`
+	Type           string   `json:"type"`
+	AttributeName  string   `json:"attributeName"`
+	AttributeTypes []string `json:"attributeTypes"`
+}
+
+type entityTypeInformation struct {
+	ID               string             `json:"id"`
+	Type             string             `json:"type"`
+	TypeName         string             `json:"typeName"`
+	EntityCount      int                `json:"entityCount"`
+	AttributeDetails []attributeDetails `json:"attributeDetails"`
+}
+
+type attributeList struct {
+	ID            string   `json:"id"`
+	Type          string   `json:"type"`
+	AttributeList []string `json:"attributeList"`
+}
+
+type attribute struct {
+	ID             string   `json:"id"`
+	Type           string   `json:"type"`
+	AttributeName  string   `json:"attributeName"`
+	AttributeCount int      `json:"attributeCount,omitempty"`
+	AttributeTypes []string `json:"attributeTypes,omitempty"`
+	TypeNames      []string `json:"typeNames"`
+}
+
+func writeDiscoveryResponse(w http.ResponseWriter, response interface{}) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+//newListTypesHandler returns a handler that lists the entity types that are available, together with
+//their attribute names when details=true is given
+func newListTypesHandler(cs *contextSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		descriptions, err := cs.describeTypes()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		typeNames := []string{}
+		for _, typeName := range providedTypes {
+			if descriptions[typeName].entityCount > 0 {
+				typeNames = append(typeNames, typeName)
+			}
+		}
+
+		if r.URL.Query().Get("details") != "true" {
+			writeDiscoveryResponse(w, entityTypeList{
+				ID:       "urn:ngsi-ld:EntityTypeList:api-pointofinterest",
+				Type:     "EntityTypeList",
+				TypeList: typeNames,
+			})
+			return
+		}
+
+		types := []entityType{}
+		for _, typeName := range typeNames {
+			types = append(types, entityType{
+				ID:             typeName,
+				Type:           "EntityType",
+				TypeName:       typeName,
+				AttributeNames: descriptions[typeName].attributeNames(),
+			})
+		}
+
+		writeDiscoveryResponse(w, types)
+	}
+}
+
+//newRetrieveTypeHandler returns a handler that describes the number of entities of a type and their attributes
+func newRetrieveTypeHandler(cs *contextSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		typeName, _ := url.QueryUnescape(chi.URLParam(r, "type"))
+
+		descriptions, err := cs.describeTypes()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		description, ok := descriptions[typeName]
+		if !ok || description.entityCount == 0 {
+			writeProblemDetails(w, http.StatusNotFound, problemDetails{
+				Type: errorTypeResourceNotFound, Title: "Resource Not Found", Detail: "no entities of type " + typeName,
+			})
+			return
+		}
+
+		response := entityTypeInformation{
+			ID:               typeName,
+			Type:             "EntityTypeInformation",
+			TypeName:         typeName,
+			EntityCount:      description.entityCount,
+			AttributeDetails: []attributeDetails{},
+		}
+
+		for _, name := range description.attributeNames() {
+			response.AttributeDetails = append(response.AttributeDetails, attributeDetails{
+				ID:             name,
+				Type:           "Attribute",
+				AttributeName:  name,
+				AttributeTypes: sortedNames(description.attributes[name].attributeTypes),
+			})
+		}
+
+		writeDiscoveryResponse(w, response)
+	}
+}
+
+//describeAttributes summarizes the attributes of all types by attribute name
+func describeAttributes(descriptions map[string]*typeDescription) map[string]*attribute {
+	attributes := map[string]*attribute{}
+
+	for _, typeName := range providedTypes {
+		description := descriptions[typeName]
+
+		for _, name := range description.attributeNames() {
+			attr, ok := attributes[name]
+			if !ok {
+				attr = &attribute{ID: name, Type: "Attribute", AttributeName: name, TypeNames: []string{}}
+				attributes[name] = attr
+			}
+
+			attr.AttributeCount += description.attributes[name].count
+			attr.TypeNames = append(attr.TypeNames, typeName)
+
+			attributeTypes := map[string]bool{}
+			for _, t := range attr.AttributeTypes {
+				attributeTypes[t] = true
+			}
+			for t := range description.attributes[name].attributeTypes {
+				attributeTypes[t] = true
+			}
+			attr.AttributeTypes = sortedNames(attributeTypes)
+		}
+	}
+
+	return attributes
+}
+
+//newListAttributesHandler returns a handler that lists the names of all attributes, or when details=true
+//is given, which types each attribute belongs to
+func newListAttributesHandler(cs *contextSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		descriptions, err := cs.describeTypes()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		attributes := describeAttributes(descriptions)
+
+		names := map[string]bool{}
+		for name := range attributes {
+			names[name] = true
+		}
+
+		if r.URL.Query().Get("details") != "true" {
+			writeDiscoveryResponse(w, attributeList{
+				ID:            "urn:ngsi-ld:AttributeList:api-pointofinterest",
+				Type:          "AttributeList",
+				AttributeList: sortedNames(names),
+			})
+			return
+		}
+
+		details := []attribute{}
+		for _, name := range sortedNames(names) {
+			attr := *attributes[name]
+			attr.AttributeCount = 0
+			attr.AttributeTypes = nil
+			details = append(details, attr)
+		}
+
+		writeDiscoveryResponse(w, details)
+	}
+}
+
+//newRetrieveAttributeHandler returns a handler that describes an attribute, the number of entities
+//that have it and the types that it belongs to
+func newRetrieveAttributeHandler(cs *contextSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, _ := url.QueryUnescape(chi.URLParam(r, "attr"))
+
+		descriptions, err := cs.describeTypes()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		attr, ok := describeAttributes(descriptions)[name]
+		if !ok {
+			writeProblemDetails(w, http.StatusNotFound, problemDetails{
+				Type: errorTypeResourceNotFound, Title: "Resource Not Found", Detail: "no entities have the attribute " + name,
+			})
+			return
+		}
+
+		writeDiscoveryResponse(w, attr)
+	}
+}
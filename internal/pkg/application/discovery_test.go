@@ -0,0 +1,39 @@
+package application
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/matryer/is"
+	"github.com/rs/zerolog"
+)
+
+func TestThatTypeDescriptionsAreCachedUntilAnEntityChanges(t *testing.T) {
+	is := is.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(trailsWithAndWithoutGeometry))
+	}))
+	defer server.Close()
+
+	db, err := database.NewDatabaseConnection(server.URL, "apikey", zerolog.New(ioutil.Discard))
+	is.NoErr(err)
+
+	cs := newContextSource(db, zerolog.New(ioutil.Discard))
+	is.True(!cs.ProvidesAttribute("status"))
+
+	first, _ := cs.describeTypes()
+	second, _ := cs.describeTypes()
+	is.True(first["ExerciseTrail"] == second["ExerciseTrail"]) // the description should be reused
+
+	trail := domain.ExerciseTrail{ID: "trail-1", Name: "Slingan", Status: "open", Geometry: domain.LineString{Lines: [][]float64{{17.3, 62.4}, {17.3, 62.41}}}}
+	is.NoErr(db.CreateTrail(trail))
+
+	is.True(cs.ProvidesAttribute("status")) // the new trail should be described
+	descriptions, _ := cs.describeTypes()
+	is.Equal(descriptions["ExerciseTrail"].entityCount, 3)
+}
@@ -0,0 +1,187 @@
+package application
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+	"github.com/diwise/ngsi-ld-golang/pkg/ngsi-ld/geojson"
+	ngsitypes "github.com/diwise/ngsi-ld-golang/pkg/ngsi-ld/types"
+)
+
+const (
+	FireplaceIDPrefix string = "urn:ngsi-ld:Fireplace:"
+	FireplaceTypeName string = "Fireplace"
+
+	OutdoorGymIDPrefix string = "urn:ngsi-ld:OutdoorGym:"
+	OutdoorGymTypeName string = "OutdoorGym"
+
+	PlaygroundIDPrefix string = "urn:ngsi-ld:Playground:"
+	PlaygroundTypeName string = "Playground"
+
+	SportsFieldIDPrefix string = "urn:ngsi-ld:SportsField:"
+	SportsFieldTypeName string = "SportsField"
+)
+
+//localTimeZone is used to evaluate clock times in schedules
+var localTimeZone *time.Location = loadLocalTimeZone()
+
+func loadLocalTimeZone() *time.Location {
+	location, err := time.LoadLocation("Europe/Stockholm")
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+var entityContext []string = []string{
+	"https://schema.lab.fiware.org/ld/context",
+	"https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld",
+}
+
+//pointOfInterestEntity is the NGSI-LD representation of facilities that are located at a single point
+type pointOfInterestEntity struct {
+	ID           string                      `json:"id"`
+	Type         string                      `json:"type"`
+	Name         *ngsitypes.TextProperty     `json:"name"`
+	Description  *ngsitypes.TextProperty     `json:"description,omitempty"`
+	Location     *geojson.GeoJSONProperty    `json:"location"`
+	DateCreated  *ngsitypes.DateTimeProperty `json:"dateCreated,omitempty"`
+	DateModified *ngsitypes.DateTimeProperty `json:"dateModified,omitempty"`
+	Source       *ngsitypes.TextProperty     `json:"source,omitempty"`
+	Context      []string                    `json:"@context"`
+}
+
+func newPointOfInterestEntity(typeName, idPrefix string, poi domain.PointOfInterest) *pointOfInterestEntity {
+	entity := &pointOfInterestEntity{
+		ID:       fmt.Sprintf("%s%s", idPrefix, poi.ID),
+		Type:     typeName,
+		Name:     ngsitypes.NewTextProperty(poi.Name),
+		Location: geojson.CreateGeoJSONPropertyFromWGS84(poi.Location.Coordinates[0], poi.Location.Coordinates[1]),
+		Context:  entityContext,
+	}
+
+	if poi.Description != "" {
+		entity.Description = ngsitypes.NewTextProperty(poi.Description)
+	}
+
+	if !poi.DateCreated.IsZero() {
+		entity.DateCreated = ngsitypes.CreateDateTimeProperty(poi.DateCreated.Format(time.RFC3339))
+	}
+
+	if !poi.DateModified.IsZero() {
+		entity.DateModified = ngsitypes.CreateDateTimeProperty(poi.DateModified.Format(time.RFC3339))
+	}
+
+	if poi.Source != "" {
+		entity.Source = ngsitypes.NewTextProperty(poi.Source)
+	}
+
+	return entity
+}
+
+//booleanProperty is a property with a boolean value, for which the ngsi-ld types have no equivalent
+type booleanProperty struct {
+	Type  string `json:"type"`
+	Value bool   `json:"value"`
+}
+
+func newBooleanProperty(value bool) *booleanProperty {
+	return &booleanProperty{Type: "Property", Value: value}
+}
+
+type contactPoint struct {
+	Email     string `json:"email,omitempty"`
+	Telephone string `json:"telephone,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+//contactPointProperty is a structured property with the contact details of a point of interest
+type contactPointProperty struct {
+	Type  string       `json:"type"`
+	Value contactPoint `json:"value"`
+}
+
+func newContactPointProperty(cp domain.ContactPoint) *contactPointProperty {
+	return &contactPointProperty{
+		Type:  "Property",
+		Value: contactPoint{Email: cp.Email, Telephone: cp.Telephone, URL: cp.URL},
+	}
+}
+
+//observedNumberProperty is a number property with the time it was observed, and a sub property
+//that flags values that have not been updated for a long time
+type observedNumberProperty struct {
+	Type       string           `json:"type"`
+	Value      float64          `json:"value"`
+	ObservedAt string           `json:"observedAt,omitempty"`
+	Stale      *booleanProperty `json:"stale,omitempty"`
+}
+
+func newObservedNumberProperty(value float64, observedAt time.Time, stale bool) *observedNumberProperty {
+	p := &observedNumberProperty{
+		Type:  "Property",
+		Value: value,
+	}
+
+	if !observedAt.IsZero() {
+		p.ObservedAt = observedAt.UTC().Format(time.RFC3339)
+	}
+
+	if stale {
+		p.Stale = newBooleanProperty(true)
+	}
+
+	return p
+}
+
+type lightingSchedule struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+//lightingScheduleProperty is a structured property describing when the floodlights of a trail are lit
+type lightingScheduleProperty struct {
+	Type  string           `json:"type"`
+	Value lightingSchedule `json:"value"`
+}
+
+func newLightingScheduleProperty(schedule domain.LightingSchedule) *lightingScheduleProperty {
+	return &lightingScheduleProperty{
+		Type:  "Property",
+		Value: lightingSchedule{From: schedule.From, To: schedule.To},
+	}
+}
+
+//sportsFieldEntity is a Smart Data Models compatible representation of a SportsField
+type sportsFieldEntity struct {
+	*pointOfInterestEntity
+	Category     *ngsitypes.TextListProperty `json:"category,omitempty"`
+	Surface      *ngsitypes.TextProperty     `json:"surface,omitempty"`
+	Bookable     *booleanProperty            `json:"bookable,omitempty"`
+	OpeningHours *ngsitypes.TextListProperty `json:"openingHours,omitempty"`
+}
+
+func newSportsFieldEntity(sportsField domain.SportsField) *sportsFieldEntity {
+	entity := &sportsFieldEntity{
+		pointOfInterestEntity: newPointOfInterestEntity(SportsFieldTypeName, SportsFieldIDPrefix, sportsField.PointOfInterest),
+	}
+
+	if len(sportsField.Category) > 0 {
+		entity.Category = ngsitypes.NewTextListProperty(sportsField.Category)
+	}
+
+	if sportsField.Surface != "" {
+		entity.Surface = ngsitypes.NewTextProperty(sportsField.Surface)
+	}
+
+	if sportsField.Bookable != nil {
+		entity.Bookable = newBooleanProperty(*sportsField.Bookable)
+	}
+
+	if len(sportsField.OpeningHours) > 0 {
+		entity.OpeningHours = ngsitypes.NewTextListProperty(sportsField.OpeningHours)
+	}
+
+	return entity
+}
@@ -0,0 +1,466 @@
+package application
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/diwise"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/fiware"
+	ngsi "github.com/diwise/ngsi-ld-golang/pkg/ngsi-ld"
+)
+
+const (
+	errorTypeBadRequestData        string = "https://uri.etsi.org/ngsi-ld/errors/BadRequestData"
+	errorTypeInvalidRequest        string = "https://uri.etsi.org/ngsi-ld/errors/InvalidRequest"
+	errorTypeResourceNotFound      string = "https://uri.etsi.org/ngsi-ld/errors/ResourceNotFound"
+	errorTypeAlreadyExists         string = "https://uri.etsi.org/ngsi-ld/errors/AlreadyExists"
+	errorTypeOperationNotSupported string = "https://uri.etsi.org/ngsi-ld/errors/OperationNotSupported"
+	errorTypeInternalError         string = "https://uri.etsi.org/ngsi-ld/errors/InternalError"
+)
+
+var (
+	errBadRequestData        error = errors.New("bad request data")
+	errEntityNotFound        error = errors.New("entity not found")
+	errOperationNotSupported error = errors.New("operation not supported")
+)
+
+type problemDetails struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Detail string `json:"detail,omitempty"`
+}
+
+//newProblemDetails describes an error using the error types defined by NGSI-LD
+func newProblemDetails(err error) problemDetails {
+	if errors.Is(err, errBadRequestData) || errors.Is(err, database.ErrUnsupportedAttribute) || errors.Is(err, database.ErrInvalidAttributeValue) {
+		return problemDetails{Type: errorTypeBadRequestData, Title: "Bad Request Data", Detail: err.Error()}
+	} else if errors.Is(err, errEntityNotFound) {
+		return problemDetails{Type: errorTypeResourceNotFound, Title: "Resource Not Found", Detail: err.Error()}
+	} else if errors.Is(err, database.ErrEntityExists) {
+		return problemDetails{Type: errorTypeAlreadyExists, Title: "Already Exists", Detail: err.Error()}
+	} else if errors.Is(err, errOperationNotSupported) {
+		return problemDetails{Type: errorTypeOperationNotSupported, Title: "Operation Not Supported", Detail: err.Error()}
+	}
+
+	return problemDetails{Type: errorTypeInternalError, Title: "Internal Error", Detail: err.Error()}
+}
+
+func writeProblemDetails(w http.ResponseWriter, statusCode int, problem problemDetails) {
+	body, _ := json.Marshal(problem)
+
+	w.Header().Add("Content-Type", "application/problem+json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+type batchEntityError struct {
+	EntityID string         `json:"entityId"`
+	Error    problemDetails `json:"error"`
+}
+
+//batchOperationResult reports the outcome of a batch operation for each entity
+type batchOperationResult struct {
+	Success []string           `json:"success"`
+	Errors  []batchEntityError `json:"errors"`
+}
+
+func (result *batchOperationResult) addError(entityID string, err error) {
+	result.Errors = append(result.Errors, batchEntityError{EntityID: entityID, Error: newProblemDetails(err)})
+}
+
+func writeBatchOperationResult(w http.ResponseWriter, result batchOperationResult) {
+	body, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMultiStatus)
+	w.Write(body)
+}
+
+//decodeEntityFragments decodes a request body with an array of entities in normalized form
+func decodeEntityFragments(r *http.Request) ([]map[string]json.RawMessage, error) {
+	fragments := []map[string]json.RawMessage{}
+
+	err := json.NewDecoder(r.Body).Decode(&fragments)
+	if err != nil {
+		return nil, fmt.Errorf("request body must be an array of entities: %s", err.Error())
+	}
+
+	return fragments, nil
+}
+
+func (cs *contextSource) fragmentID(fragment map[string]json.RawMessage) (string, error) {
+	entityID, entityType := "", ""
+
+	if err := json.Unmarshal(fragment["id"], &entityID); err != nil || entityID == "" {
+		return "", fmt.Errorf("%w: entity has no id", errBadRequestData)
+	}
+
+	if t, ok := fragment["type"]; ok {
+		if err := json.Unmarshal(t, &entityType); err != nil {
+			return entityID, fmt.Errorf("%w: entity type must be a string", errBadRequestData)
+		}
+	}
+
+	if entityType != "" {
+		providedType, err := cs.GetProvidedTypeFromID(entityID)
+		if err == nil && providedType != entityType {
+			return entityID, fmt.Errorf("%w: entity %s is not of type %s", errBadRequestData, entityID, entityType)
+		}
+	}
+
+	return entityID, nil
+}
+
+//updateEntityAttributes changes the descriptive attributes of an entity from a fragment in normalized form.
+//The id, type and @context members of the fragment are ignored, as are attributes that are equal to the
+//current value, so that an entity can be written back as it was retrieved.
+func (cs *contextSource) updateEntityAttributes(entityID string, attributes map[string]json.RawMessage, overwrite bool) error {
+	typeName, err := cs.GetProvidedTypeFromID(entityID)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errEntityNotFound, entityID)
+	}
+
+	entity, err := cs.retrieveEntity(entityID)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errEntityNotFound, entityID)
+	}
+
+	current, err := json.Marshal(entity)
+	if err != nil {
+		return err
+	}
+
+	changed := changedAttributes(current, attributes)
+	delete(changed, "@context")
+	if len(changed) == 0 {
+		return nil
+	}
+
+	update, err := parseAttributeUpdate(changed)
+	if err != nil {
+		return err
+	}
+
+	if typeName == diwise.ExerciseTrailTypeName {
+		return cs.db.UpdateTrailAttributes(strings.TrimPrefix(entityID, diwise.ExerciseTrailIDPrefix), update, overwrite)
+	} else if typeName == fiware.BeachTypeName {
+		return cs.db.UpdateBeachAttributes(strings.TrimPrefix(entityID, fiware.BeachIDPrefix), update, overwrite)
+	}
+
+	return fmt.Errorf("%w: attributes of %s entities can not be updated", errOperationNotSupported, typeName)
+}
+
+//changedAttributes returns the attributes of a fragment that differ from those of an entity
+func changedAttributes(entity []byte, attributes map[string]json.RawMessage) map[string]json.RawMessage {
+	current := map[string]json.RawMessage{}
+	json.Unmarshal(entity, &current)
+
+	changed := map[string]json.RawMessage{}
+	for name, data := range attributes {
+		var value, currentValue interface{}
+		if json.Unmarshal(data, &value) == nil && json.Unmarshal(current[name], &currentValue) == nil && reflect.DeepEqual(value, currentValue) {
+			continue
+		}
+		changed[name] = data
+	}
+
+	return changed
+}
+
+func parseAttributeUpdate(attributes map[string]json.RawMessage) (database.AttributeUpdate, error) {
+	update := database.AttributeUpdate{}
+
+	for name, data := range attributes {
+		if name == "id" || name == "type" || name == "@context" {
+			continue
+		}
+
+		if name == "location" {
+			if err := parseLocationUpdate(data, &update); err != nil {
+				return update, err
+			}
+			continue
+		}
+
+		property := struct {
+			Type  string          `json:"type"`
+			Value json.RawMessage `json:"value"`
+		}{}
+
+		err := json.Unmarshal(data, &property)
+		if err != nil || property.Type != "Property" || len(property.Value) == 0 {
+			return update, fmt.Errorf("%w: %s must be a property with a value", errBadRequestData, name)
+		}
+
+		switch name {
+		case "name":
+			update.Name, err = decodeTextValue(property.Value)
+		case "description":
+			update.Description, err = decodeTextValue(property.Value)
+		case "areaServed":
+			update.AreaServed, err = decodeTextValue(property.Value)
+		case "difficulty":
+			update.Difficulty, err = decodeTextValue(property.Value)
+		case "category":
+			update.Category, err = decodeTextListValue(property.Value)
+		case "openingHours":
+			update.OpeningHours, err = decodeTextListValue(property.Value)
+		case "status":
+			update.Status, err = decodeTextValue(property.Value)
+		case "length":
+			length := 0.0
+			err = json.Unmarshal(property.Value, &length)
+			update.Length = &length
+		default:
+			return update, fmt.Errorf("%w: %s", database.ErrUnsupportedAttribute, name)
+		}
+
+		if err != nil {
+			return update, fmt.Errorf("%w: invalid value of %s", errBadRequestData, name)
+		}
+	}
+
+	return update, nil
+}
+
+//parseLocationUpdate decodes a LineString as the location of a trail, and a Polygon or MultiPolygon as
+//the location of a beach
+func parseLocationUpdate(data json.RawMessage, update *database.AttributeUpdate) error {
+	location := geoProperty{}
+	if err := json.Unmarshal(data, &location); err != nil || location.Type != "GeoProperty" {
+		return fmt.Errorf("%w: location must be a GeoProperty", errBadRequestData)
+	}
+
+	if location.Value.Type == "LineString" {
+		update.TrailGeometry = &domain.LineString{}
+		if json.Unmarshal(location.Value.Coordinates, &update.TrailGeometry.Lines) != nil {
+			return fmt.Errorf("%w: invalid value of location", errBadRequestData)
+		}
+		return nil
+	}
+
+	update.BeachGeometry = &domain.MultiPolygon{}
+	return decodeBeachGeometry(location, update.BeachGeometry)
+}
+
+func decodeTextValue(value json.RawMessage) (*string, error) {
+	text := ""
+	err := json.Unmarshal(value, &text)
+	return &text, err
+}
+
+//decodeTextListValue accepts either a single string or an array of strings
+func decodeTextListValue(value json.RawMessage) ([]string, error) {
+	list := []string{}
+	if err := json.Unmarshal(value, &list); err == nil {
+		return list, nil
+	}
+
+	text := ""
+	err := json.Unmarshal(value, &text)
+	return []string{text}, err
+}
+
+//newBatchUpsertHandler returns a handler that creates locally managed beaches and trails that do not exist
+//and updates the attributes of existing entities. Most entities are loaded from the facility source, so
+//attributes that are left out of the fragments are kept regardless of whether options=replace or
+//options=update is used. Upserting an entity as it was retrieved is accepted, so the location and status
+//of entities from the facility source may be given as long as they are unchanged. The response is 201
+//when all entities were created, 204 when all were updated and 207 otherwise.
+func newBatchUpsertHandler(cs *contextSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fragments, err := decodeEntityFragments(r)
+		if err != nil {
+			writeProblemDetails(w, http.StatusBadRequest, problemDetails{Type: errorTypeInvalidRequest, Title: "Invalid Request", Detail: err.Error()})
+			return
+		}
+
+		result := batchOperationResult{Success: []string{}, Errors: []batchEntityError{}}
+		created := []string{}
+
+		for _, fragment := range fragments {
+			entityID, err := cs.fragmentID(fragment)
+			if err == nil {
+				err = cs.updateEntityAttributes(entityID, fragment, true)
+				if errors.Is(err, errEntityNotFound) {
+					typeName, _ := cs.GetProvidedTypeFromID(entityID)
+					err = cs.createEntity(typeName, entityID, fragment)
+					if err == nil {
+						created = append(created, entityID)
+					}
+				}
+			}
+
+			if err != nil {
+				result.addError(entityID, err)
+				continue
+			}
+
+			result.Success = append(result.Success, entityID)
+		}
+
+		if len(result.Errors) > 0 || (len(created) > 0 && len(created) < len(result.Success)) {
+			writeBatchOperationResult(w, result)
+			return
+		}
+
+		if len(created) > 0 {
+			body, err := json.Marshal(created)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			w.Write(body)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+//newBatchUpdateHandler returns a handler that updates the attributes of existing entities. Attributes that
+//already have a value are kept when options=noOverwrite is given.
+func newBatchUpdateHandler(cs *contextSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fragments, err := decodeEntityFragments(r)
+		if err != nil {
+			writeProblemDetails(w, http.StatusBadRequest, problemDetails{Type: errorTypeInvalidRequest, Title: "Invalid Request", Detail: err.Error()})
+			return
+		}
+
+		overwrite := !contains(strings.Split(r.URL.Query().Get("options"), ","), "noOverwrite")
+		result := batchOperationResult{Success: []string{}, Errors: []batchEntityError{}}
+
+		for _, fragment := range fragments {
+			entityID, err := cs.fragmentID(fragment)
+			if err == nil {
+				err = cs.updateEntityAttributes(entityID, fragment, overwrite)
+			}
+
+			if err != nil {
+				result.addError(entityID, err)
+				continue
+			}
+
+			result.Success = append(result.Success, entityID)
+		}
+
+		if len(result.Errors) > 0 {
+			writeBatchOperationResult(w, result)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type entityInfo struct {
+	ID        string `json:"id,omitempty"`
+	IDPattern string `json:"idPattern,omitempty"`
+	Type      string `json:"type"`
+}
+
+type batchQuery struct {
+	Type     string       `json:"type"`
+	Entities []entityInfo `json:"entities"`
+	Attrs    []string     `json:"attrs,omitempty"`
+	Q        string       `json:"q,omitempty"`
+}
+
+//newBatchQueryHandler returns a handler that returns the entities matching any of the entity selectors in
+//the query. The q expression is applied to the entities in the same way as for GET requests, and the
+//attrs of the query and the options parameter select the attributes and representation of the entities.
+func newBatchQueryHandler(cs *contextSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := batchQuery{}
+
+		err := json.NewDecoder(r.Body).Decode(&query)
+		if err != nil || query.Type != "Query" || len(query.Entities) == 0 {
+			writeProblemDetails(w, http.StatusBadRequest, problemDetails{
+				Type: errorTypeInvalidRequest, Title: "Invalid Request", Detail: "request body must be a Query with at least one entity selector",
+			})
+			return
+		}
+
+		filter, err := parseQueryFilter(query.Q)
+		if err != nil {
+			writeProblemDetails(w, http.StatusBadRequest, problemDetails{Type: errorTypeBadRequestData, Title: "Bad Request Data", Detail: err.Error()})
+			return
+		}
+
+		representation := newEntityRepresentation(r.URL.Query())
+		representation.attributes = query.Attrs
+
+		entities := []json.RawMessage{}
+		found := map[string]bool{}
+
+		for _, selector := range query.Entities {
+			var pattern *regexp.Regexp
+			if selector.IDPattern != "" {
+				pattern, err = regexp.Compile(selector.IDPattern)
+				if err != nil {
+					writeProblemDetails(w, http.StatusBadRequest, problemDetails{Type: errorTypeBadRequestData, Title: "Bad Request Data", Detail: "invalid idPattern"})
+					return
+				}
+			}
+
+			err = cs.queryEntities([]string{selector.Type}, filter, func(entity ngsi.Entity) error {
+				body, err := json.Marshal(entity)
+				if err != nil {
+					return err
+				}
+
+				id := struct {
+					ID string `json:"id"`
+				}{}
+				json.Unmarshal(body, &id)
+
+				if found[id.ID] || (selector.ID != "" && id.ID != selector.ID) || (pattern != nil && !pattern.MatchString(id.ID)) {
+					return nil
+				}
+
+				projected, err := representation.apply(entity)
+				if err != nil {
+					return err
+				}
+
+				if body, err = json.Marshal(projected); err != nil {
+					return err
+				}
+
+				found[id.ID] = true
+				entities = append(entities, body)
+				return nil
+			})
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+
+		body, err := json.Marshal(entities)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/ld+json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
@@ -0,0 +1,63 @@
+package application
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/diwise"
+	"github.com/matryer/is"
+	"github.com/rs/zerolog"
+)
+
+func localTrailFragment(id string, coordinates string) string {
+	return `{"id":"` + diwise.ExerciseTrailIDPrefix + id + `","type":"ExerciseTrail","name":{"type":"Property","value":"Slingan"},` +
+		`"location":{"type":"GeoProperty","value":{"type":"LineString","coordinates":` + coordinates + `}},` +
+		`"status":{"type":"Property","value":"open"}}`
+}
+
+func TestThatBatchUpsertIsIdempotent(t *testing.T) {
+	is := is.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(trailsWithAndWithoutGeometry))
+	}))
+	defer server.Close()
+
+	db, err := database.NewDatabaseConnection(server.URL, "apikey", zerolog.New(ioutil.Discard))
+	is.NoErr(err)
+
+	cs := newContextSource(db, zerolog.New(ioutil.Discard))
+	upsert := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		newBatchUpsertHandler(cs)(w, httptest.NewRequest(http.MethodPost, "/ngsi-ld/v1/entityOperations/upsert", strings.NewReader(body)))
+		return w
+	}
+
+	sourceTrailID := diwise.ExerciseTrailIDPrefix + database.SundsvallAnlaggningPrefix + "701"
+	entity, err := cs.retrieveEntity(sourceTrailID)
+	is.NoErr(err)
+	retrieved, _ := json.Marshal(entity)
+
+	is.Equal(upsert("["+string(retrieved)+"]").Code, http.StatusNoContent) // an unchanged source entity should be accepted
+
+	moved := strings.Replace(string(retrieved), "17.308", "17.2", 1)
+	is.Equal(upsert("["+moved+"]").Code, http.StatusMultiStatus) // the location of a source entity can not be changed
+
+	is.Equal(upsert("["+localTrailFragment("trail-1", "[[17.3,62.4],[17.3,62.41]]")+"]").Code, http.StatusCreated)
+
+	w := upsert("[" + localTrailFragment("trail-2", "[[17.3,62.4],[17.3,62.41]]") + "," + string(retrieved) + "]")
+	is.Equal(w.Code, http.StatusMultiStatus) // a batch that both creates and updates entities
+	result := batchOperationResult{}
+	is.NoErr(json.Unmarshal(w.Body.Bytes(), &result))
+	is.Equal(len(result.Success), 2)
+	is.Equal(len(result.Errors), 0)
+
+	is.Equal(upsert("["+localTrailFragment("trail-1", "[[17.3,62.4],[17.31,62.41]]")+"]").Code, http.StatusNoContent)
+	trail, _ := db.GetTrailFromID("trail-1")
+	is.Equal(trail.Geometry.Lines[1], []float64{17.31, 62.41}) // the location of a local entity can be changed
+}
@@ -0,0 +1,296 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/diwise"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/fiware"
+	"github.com/rs/zerolog"
+)
+
+const (
+	//maxEventHistory is the number of events that are kept for clients that resume with Last-Event-ID
+	maxEventHistory        int           = 1000
+	maxPendingChanges      int           = 1000
+	eventSubscriberBuffer  int           = 64
+	eventKeepAliveInterval time.Duration = 30 * time.Second
+
+	eventNameUpdate string = "update"
+	eventNameDelete string = "delete"
+	eventNameReset  string = "reset"
+)
+
+//entityEvent is a change of an entity as it is sent to subscribers
+type entityEvent struct {
+	id         uint64
+	name       string
+	entityID   string
+	entityType string
+	data       []byte
+}
+
+//eventSubscription selects events by entity type and entity id. Empty lists match all events.
+type eventSubscription struct {
+	types  []string
+	ids    []string
+	events chan entityEvent
+}
+
+//matches is true for the events of the selected entities, and for reset events that concern all subscriptions
+func (s *eventSubscription) matches(event entityEvent) bool {
+	if event.name == eventNameReset {
+		return true
+	}
+
+	return (len(s.types) == 0 || contains(s.types, event.entityType)) && (len(s.ids) == 0 || contains(s.ids, event.entityID))
+}
+
+//entityEvents turns the changes that are applied to the datastore into numbered events, and
+//distributes them to the subscribers
+type entityEvents struct {
+	cs      *contextSource
+	changes chan database.EntityChange
+	logger  zerolog.Logger
+
+	mu          sync.Mutex
+	lastID      uint64
+	history     []entityEvent
+	subscribers map[*eventSubscription]bool
+}
+
+func newEntityEvents(cs *contextSource, logger zerolog.Logger) *entityEvents {
+	ee := &entityEvents{
+		cs:          cs,
+		changes:     make(chan database.EntityChange, maxPendingChanges),
+		logger:      logger,
+		subscribers: map[*eventSubscription]bool{},
+	}
+
+	cs.db.AddChangeListener(ee.notify)
+	go ee.run()
+
+	return ee
+}
+
+//notify is called by the datastore while it is locked, so the change is handled by run instead. When
+//too many changes are pending the change is dropped, and a reset event tells the subscribers, and the
+//clients that resume from an earlier event, that they have missed it.
+func (ee *entityEvents) notify(change database.EntityChange) {
+	select {
+	case ee.changes <- change:
+	default:
+		ee.logger.Warn().Msgf("dropped change of %s since too many changes are pending", change.EntityID)
+		ee.publish(entityEvent{name: eventNameReset, data: []byte("{}")})
+	}
+}
+
+func (ee *entityEvents) run() {
+	for change := range ee.changes {
+		event, err := ee.newEvent(change)
+		if err != nil {
+			ee.logger.Debug().Err(err).Msgf("no event created for change of %s", change.EntityID)
+			continue
+		}
+
+		ee.publish(event)
+	}
+}
+
+//changedEntity returns the NGSI-LD type and id of the entity that a change of the datastore applies to
+func changedEntity(change database.EntityChange) (string, string, error) {
+	if change.EntityType == database.EntityTypeBeach {
+		return fiware.BeachTypeName, fiware.BeachIDPrefix + change.EntityID, nil
+	} else if change.EntityType == database.EntityTypeExerciseTrail {
+		return diwise.ExerciseTrailTypeName, diwise.ExerciseTrailIDPrefix + change.EntityID, nil
+	}
+
+	return "", "", fmt.Errorf("unknown entity type %s", change.EntityType)
+}
+
+func (ee *entityEvents) newEvent(change database.EntityChange) (entityEvent, error) {
+	event := entityEvent{name: eventNameUpdate}
+
+	var err error
+	if event.entityType, event.entityID, err = changedEntity(change); err != nil {
+		return event, err
+	}
+
+	var entity interface{} = struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	}{event.entityID, event.entityType}
+
+	if change.Deleted {
+		event.name = eventNameDelete
+	} else {
+		entity, err = ee.cs.retrieveEntity(event.entityID)
+		if err != nil {
+			return event, err
+		}
+	}
+
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return event, err
+	}
+
+	event.data = data
+	return event, nil
+}
+
+//publish numbers an event and sends it to the matching subscribers. Subscribers that can not keep
+//up are disconnected, and are expected to reconnect and resume from their last event.
+func (ee *entityEvents) publish(event entityEvent) {
+	ee.mu.Lock()
+	defer ee.mu.Unlock()
+
+	if event.name == eventNameReset && len(ee.history) > 0 && ee.history[len(ee.history)-1].name == eventNameReset {
+		//no events have been sent since the previous reset, which the subscribers still have to act on
+		return
+	}
+
+	ee.lastID++
+	event.id = ee.lastID
+
+	ee.history = append(ee.history, event)
+	if len(ee.history) > maxEventHistory {
+		ee.history = ee.history[len(ee.history)-maxEventHistory:]
+	}
+
+	for subscription := range ee.subscribers {
+		if !subscription.matches(event) {
+			continue
+		}
+
+		select {
+		case subscription.events <- event:
+		default:
+			delete(ee.subscribers, subscription)
+			close(subscription.events)
+		}
+	}
+}
+
+//subscribe registers a subscription and returns the events that it has missed since lastEventID.
+//When those events are no longer available, reset is true and the client should reload its entities.
+func (ee *entityEvents) subscribe(subscription *eventSubscription, lastEventID string) (missed []entityEvent, reset bool) {
+	ee.mu.Lock()
+	defer ee.mu.Unlock()
+
+	ee.subscribers[subscription] = true
+
+	if lastEventID == "" {
+		return nil, false
+	}
+
+	last, err := strconv.ParseUint(lastEventID, 10, 64)
+	if err != nil || last > ee.lastID {
+		return nil, true
+	}
+
+	if len(ee.history) > 0 && ee.history[0].id > last+1 {
+		reset = true
+	}
+
+	for _, event := range ee.history {
+		if event.id > last && subscription.matches(event) {
+			missed = append(missed, event)
+		}
+	}
+
+	return missed, reset
+}
+
+//currentID returns the id of the latest event
+func (ee *entityEvents) currentID() uint64 {
+	ee.mu.Lock()
+	defer ee.mu.Unlock()
+
+	return ee.lastID
+}
+
+func (ee *entityEvents) unsubscribe(subscription *eventSubscription) {
+	ee.mu.Lock()
+	defer ee.mu.Unlock()
+
+	if ee.subscribers[subscription] {
+		delete(ee.subscribers, subscription)
+		close(subscription.events)
+	}
+}
+
+func splitList(values string) []string {
+	result := []string{}
+	for _, value := range strings.Split(values, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func writeEvent(w http.ResponseWriter, event entityEvent) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.id, event.name, event.data)
+}
+
+//newEntityEventsHandler returns a handler that streams changes of beaches and exercise trails as
+//server-sent events. The type and id parameters select which entities to receive events for.
+func newEntityEventsHandler(ee *entityEvents) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		params := r.URL.Query()
+		subscription := &eventSubscription{
+			types:  splitList(params.Get("type")),
+			ids:    splitList(params.Get("id")),
+			events: make(chan entityEvent, eventSubscriberBuffer),
+		}
+
+		missed, reset := ee.subscribe(subscription, r.Header.Get("Last-Event-ID"))
+		defer ee.unsubscribe(subscription)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		if reset {
+			fmt.Fprintf(w, "event: %s\ndata: {}\n\n", eventNameReset)
+		}
+
+		for _, event := range missed {
+			writeEvent(w, event)
+		}
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(eventKeepAliveInterval)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-subscription.events:
+				if !ok {
+					return
+				}
+				writeEvent(w, event)
+				flusher.Flush()
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				flusher.Flush()
+			}
+		}
+	}
+}
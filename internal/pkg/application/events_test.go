@@ -0,0 +1,162 @@
+package application
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/diwise"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/fiware"
+	"github.com/matryer/is"
+	"github.com/rs/zerolog"
+)
+
+type sentEvent struct {
+	id   string
+	name string
+	data string
+}
+
+//openEventStream requests the events handler and returns a function that reads the next event
+func openEventStream(is *is.I, serverURL, query, lastEventID string) (func() sentEvent, func()) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serverURL+"?"+query, nil)
+	is.NoErr(err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	is.NoErr(err)
+	is.Equal(resp.StatusCode, http.StatusOK)
+	is.Equal(resp.Header.Get("Content-Type"), "text/event-stream")
+
+	reader := bufio.NewReader(resp.Body)
+	next := func() sentEvent {
+		event := sentEvent{}
+		for {
+			line, err := reader.ReadString('\n')
+			is.NoErr(err) // the expected event should be sent before the stream times out
+
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" && event.name != "" {
+				return event
+			}
+
+			if strings.HasPrefix(line, "id: ") {
+				event.id = strings.TrimPrefix(line, "id: ")
+			} else if strings.HasPrefix(line, "event: ") {
+				event.name = strings.TrimPrefix(line, "event: ")
+			} else if strings.HasPrefix(line, "data: ") {
+				event.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}
+
+	return next, func() {
+		cancel()
+		resp.Body.Close()
+	}
+}
+
+func TestThatEventsAreFilteredAndResumedFromTheLastEventID(t *testing.T) {
+	is := is.New(t)
+	logger := zerolog.New(ioutil.Discard)
+
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(trailsWithAndWithoutGeometry))
+	}))
+	defer source.Close()
+
+	db, err := database.NewDatabaseConnection(source.URL, "apikey", logger)
+	is.NoErr(err)
+
+	ee := newEntityEvents(newContextSource(db, logger), logger)
+	server := httptest.NewServer(newEntityEventsHandler(ee))
+	defer server.Close()
+
+	trailID := diwise.ExerciseTrailIDPrefix + database.SundsvallAnlaggningPrefix + "701"
+	otherTrailID := diwise.ExerciseTrailIDPrefix + database.SundsvallAnlaggningPrefix + "702"
+
+	next, closeStream := openEventStream(is, server.URL, "type="+diwise.ExerciseTrailTypeName+"&id="+url.QueryEscape(trailID), "")
+	is.NoErr(db.SetTrailOpenStatus(database.SundsvallAnlaggningPrefix+"702", false))
+	is.NoErr(db.SetTrailOpenStatus(database.SundsvallAnlaggningPrefix+"701", false))
+
+	event := next()
+	is.Equal(event.id, "2") // the change of the other trail should not be sent to the subscription
+	is.Equal(event.name, eventNameUpdate)
+	is.True(strings.Contains(event.data, `"id":"`+trailID+`"`))
+	closeStream()
+
+	next, closeStream = openEventStream(is, server.URL, "type="+diwise.ExerciseTrailTypeName, "0")
+	defer closeStream()
+
+	event = next()
+	is.Equal(event.id, "1") // a resumed client should receive the events it has missed, in order
+	is.True(strings.Contains(event.data, `"id":"`+otherTrailID+`"`))
+	is.Equal(next().id, "2")
+
+	localTrail := domain.ExerciseTrail{ID: "se:timra:trails:1", Name: "Slingan", Geometry: domain.LineString{Lines: [][]float64{{17.3, 62.4}, {17.3, 62.41}}}}
+	is.NoErr(db.CreateTrail(localTrail))
+
+	event = next()
+	is.Equal(event.id, "3") // and then the events that follow
+	is.Equal(event.name, eventNameUpdate)
+
+	is.NoErr(db.DeleteTrail(localTrail.ID))
+	event = next()
+	is.Equal(event.id, "4")
+	is.Equal(event.name, eventNameDelete)
+	is.Equal(event.data, `{"id":"`+diwise.ExerciseTrailIDPrefix+localTrail.ID+`","type":"`+diwise.ExerciseTrailTypeName+`"}`)
+}
+
+func TestThatDroppedChangesResetTheSubscribers(t *testing.T) {
+	is := is.New(t)
+	logger := zerolog.New(ioutil.Discard)
+
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(trailsWithAndWithoutGeometry))
+	}))
+	defer source.Close()
+
+	db, err := database.NewDatabaseConnection(source.URL, "apikey", logger)
+	is.NoErr(err)
+
+	//the changes are not handled, so every change is dropped
+	ee := &entityEvents{
+		cs:          newContextSource(db, logger),
+		changes:     make(chan database.EntityChange),
+		logger:      logger,
+		subscribers: map[*eventSubscription]bool{},
+	}
+	server := httptest.NewServer(newEntityEventsHandler(ee))
+	defer server.Close()
+
+	next, closeStream := openEventStream(is, server.URL, "type="+diwise.ExerciseTrailTypeName, "")
+	defer closeStream()
+
+	change := database.EntityChange{EntityType: database.EntityTypeExerciseTrail, EntityID: database.SundsvallAnlaggningPrefix + "701"}
+	ee.notify(change)
+	ee.notify(change)
+
+	event := next()
+	is.Equal(event.name, eventNameReset) // a subscriber should be told that it has missed a change
+	is.Equal(event.id, "1")
+	is.Equal(ee.currentID(), uint64(1)) // subsequent drops should be covered by the same reset
+
+	resumed, closeResumed := openEventStream(is, server.URL, "type="+fiware.BeachTypeName, "0")
+	defer closeResumed()
+
+	event = resumed()
+	is.Equal(event.name, eventNameReset) // a client that resumes from before the dropped change should be reset too
+	is.Equal(event.id, "1")
+}
@@ -2,8 +2,9 @@ package application
 
 import (
 	"compress/flate"
-	"errors"
+	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"os"
 	"strings"
@@ -25,12 +26,77 @@ import (
 
 //RequestRouter needs a comment
 type RequestRouter struct {
-	impl *chi.Mux
+	impl chi.Router
 }
 
-func (router *RequestRouter) addNGSIHandlers(contextRegistry ngsi.ContextRegistry) {
-	router.Get("/ngsi-ld/v1/entities/{entity}", ngsi.NewRetrieveEntityHandler(contextRegistry))
-	router.Get("/ngsi-ld/v1/entities", ngsi.NewQueryEntitiesHandler(contextRegistry))
+func (router *RequestRouter) addNGSIHandlers(contextRegistry ngsi.ContextRegistry, contexts *jsonldContexts, caching *responseCaching) {
+	router.Get("/ngsi-ld/v1/entities/{entity}", contexts.handler(caching.handler(ngsi.NewRetrieveEntityHandler(contextRegistry))))
+	router.Get("/ngsi-ld/v1/entities", contexts.handler(caching.handler(ngsi.NewQueryEntitiesHandler(contextRegistry))))
+	router.Get(jsonldContextPath, newJSONLDContextHandler())
+}
+
+func (router *RequestRouter) addBatchQueryHandlers(cs *contextSource, contexts *jsonldContexts) {
+	router.Post("/ngsi-ld/v1/entityOperations/query", contexts.handler(newBatchQueryHandler(cs)))
+}
+
+func (router *RequestRouter) addDiscoveryHandlers(cs *contextSource) {
+	router.Get("/ngsi-ld/v1/types", newListTypesHandler(cs))
+	router.Get("/ngsi-ld/v1/types/{type}", newRetrieveTypeHandler(cs))
+	router.Get("/ngsi-ld/v1/attributes", newListAttributesHandler(cs))
+	router.Get("/ngsi-ld/v1/attributes/{attr}", newRetrieveAttributeHandler(cs))
+}
+
+func (router *RequestRouter) addEntityManagementHandlers(contextRegistry ngsi.ContextRegistry, cs *contextSource, contexts *jsonldContexts) {
+	router.Patch("/ngsi-ld/v1/entities/{entity}/attrs/", contexts.handler(ngsi.NewUpdateEntityAttributesHandler(contextRegistry)))
+	router.Post("/ngsi-ld/v1/entities", contexts.handler(ngsi.NewCreateEntityHandler(contextRegistry)))
+	router.Delete("/ngsi-ld/v1/entities/{entity}", newDeleteEntityHandler(cs))
+	router.Post("/ngsi-ld/v1/entityOperations/upsert", contexts.handler(newBatchUpsertHandler(cs)))
+	router.Post("/ngsi-ld/v1/entityOperations/update", contexts.handler(newBatchUpdateHandler(cs)))
+}
+
+func (router *RequestRouter) addTemporalHandlers(db database.Datastore, contexts *jsonldContexts, caching *responseCaching) {
+	router.Get("/ngsi-ld/v1/temporal/entities/{entity}", contexts.handler(caching.handler(newRetrieveTemporalEntityHandler(db))))
+}
+
+func (router *RequestRouter) addAdminHandlers(db database.Datastore) {
+	router.Put("/admin/trails/{entity}/status", newSetTrailStatusOverrideHandler(db))
+	router.Delete("/admin/trails/{entity}/status", newDeleteTrailStatusOverrideHandler(db))
+	router.Put("/admin/trails/{entity}/lighting", newSetTrailLightingScheduleHandler(db))
+	router.Delete("/admin/trails/{entity}/lighting", newDeleteTrailLightingScheduleHandler(db))
+	router.Put("/admin/areas/{area}/lighting", newSetAreaLightingScheduleHandler(db))
+	router.Delete("/admin/areas/{area}/lighting", newDeleteAreaLightingScheduleHandler(db))
+	router.Get("/admin/devices", newListDeviceAssignmentsHandler(db))
+	router.Get("/admin/beaches/{entity}/devices", newListDeviceAssignmentsHandler(db))
+	router.Post("/admin/beaches/{entity}/devices", newAssignDeviceHandler(db))
+	router.Delete("/admin/beaches/{entity}/devices/{device}", newUnassignDeviceHandler(db))
+	router.Put("/admin/beaches/{entity}/sensoraggregation", newSetSensorAggregationHandler(db))
+}
+
+func (router *RequestRouter) addDeadLetterHandlers(wtp *WaterTemperatureProcessor, logger zerolog.Logger) {
+	router.Get("/admin/deadletters", newListDeadLettersHandler(wtp.deadLetters))
+	router.Post("/admin/deadletters/replay", newReplayAllDeadLettersHandler(wtp, logger))
+	router.Post("/admin/deadletters/{id}/replay", newReplayDeadLetterHandler(wtp, logger))
+	router.Delete("/admin/deadletters/{id}", newDeleteDeadLetterHandler(wtp.deadLetters))
+}
+
+func (router *RequestRouter) addDataQualityHandlers(db database.Datastore) {
+	router.Get("/api/dataquality", newDataQualityReportHandler(db))
+}
+
+func (router *RequestRouter) addSearchHandlers(db database.Datastore) {
+	router.Get("/api/search", newSearchHandler(db))
+	router.Get("/api/nearest", newNearestHandler(db))
+}
+
+func (router *RequestRouter) addEventHandlers(cs *contextSource, ee *entityEvents, allowedOrigins []string, logger zerolog.Logger) {
+	router.Get("/api/events", newEntityEventsHandler(ee))
+	router.Get("/api/viewport", newViewportHandler(cs, ee, allowedOrigins, logger))
+}
+
+func (router *RequestRouter) addTrailNetworkHandlers(db database.Datastore) {
+	router.Get("/api/trails/network", newTrailNetworkHandler(db))
+	router.Get("/api/trails/routes", newTrailRoutesHandler(db))
+	router.Get("/api/trails/{entity}/elevation", newTrailElevationProfileHandler(db))
 }
 
 func (router *RequestRouter) addProbeHandlers() {
@@ -39,6 +105,11 @@ func (router *RequestRouter) addProbeHandlers() {
 	})
 }
 
+//With returns a router that registers its routes behind the middlewares
+func (router *RequestRouter) With(middlewares ...func(http.Handler) http.Handler) *RequestRouter {
+	return &RequestRouter{impl: router.impl.With(middlewares...)}
+}
+
 //Get accepts a pattern that should be routed to the handlerFn on a GET request
 func (router *RequestRouter) Get(pattern string, handlerFn http.HandlerFunc) {
 	router.impl.Get(pattern, handlerFn)
@@ -54,11 +125,21 @@ func (router *RequestRouter) Post(pattern string, handlerFn http.HandlerFunc) {
 	router.impl.Post(pattern, handlerFn)
 }
 
-func newRequestRouter() *RequestRouter {
+//Put accepts a pattern that should be routed to the handlerFn on a PUT request
+func (router *RequestRouter) Put(pattern string, handlerFn http.HandlerFunc) {
+	router.impl.Put(pattern, handlerFn)
+}
+
+//Delete accepts a pattern that should be routed to the handlerFn on a DELETE request
+func (router *RequestRouter) Delete(pattern string, handlerFn http.HandlerFunc) {
+	router.impl.Delete(pattern, handlerFn)
+}
+
+func newRequestRouter(allowedOrigins []string) *RequestRouter {
 	router := &RequestRouter{impl: chi.NewRouter()}
 
 	router.impl.Use(cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
+		AllowedOrigins:   allowedOrigins,
 		AllowCredentials: true,
 		Debug:            false,
 	}).Handler)
@@ -75,26 +156,67 @@ func newRequestRouter() *RequestRouter {
 	return router
 }
 
-func createRequestRouter(contextRegistry ngsi.ContextRegistry) *RequestRouter {
-	router := newRequestRouter()
-
-	router.addNGSIHandlers(contextRegistry)
+func createRequestRouter(contextRegistry ngsi.ContextRegistry, ctxSource *contextSource, db database.Datastore, wtp *WaterTemperatureProcessor, contexts *jsonldContexts, caching *responseCaching, allowedOrigins []string, adminToken string, logger zerolog.Logger) *RequestRouter {
+	router := newRequestRouter(allowedOrigins)
+
+	router.addNGSIHandlers(contextRegistry, contexts, caching)
+	router.addBatchQueryHandlers(ctxSource, contexts)
+	router.addDiscoveryHandlers(ctxSource)
+	router.addTemporalHandlers(db, contexts, caching)
+	router.addDataQualityHandlers(db)
+	router.addSearchHandlers(db)
+	router.addTrailNetworkHandlers(db)
+	router.addEventHandlers(ctxSource, newEntityEvents(ctxSource, logger), allowedOrigins, logger)
 	router.addProbeHandlers()
 
+	//the routes that modify entities, and the admin routes, are only served to authenticated clients
+	if adminToken == "" {
+		logger.Warn().Msg("no admin token is configured, so the routes that modify entities are not served")
+		return router
+	}
+
+	authenticated := router.With(newTokenAuthenticator(adminToken))
+	authenticated.addEntityManagementHandlers(contextRegistry, ctxSource, contexts)
+	authenticated.addAdminHandlers(db)
+	authenticated.addDeadLetterHandlers(wtp, logger)
+
 	return router
 }
 
-func createContextRegistry(db database.Datastore, logger zerolog.Logger) ngsi.ContextRegistry {
+func createContextRegistry(ctxSource *contextSource) ngsi.ContextRegistry {
 	contextRegistry := ngsi.NewContextRegistry()
-	ctxSource := contextSource{db: db, logger: logger}
-	contextRegistry.Register(&ctxSource)
+	contextRegistry.Register(ctxSource)
 	return contextRegistry
 }
 
 //CreateRouterAndStartServing sets up the NGSI-LD router and starts serving incoming requests
-func CreateRouterAndStartServing(db database.Datastore, logger zerolog.Logger) {
-	contextRegistry := createContextRegistry(db, logger)
-	router := createRequestRouter(contextRegistry)
+func CreateRouterAndStartServing(db database.Datastore, wtp *WaterTemperatureProcessor, logger zerolog.Logger) {
+	//the registry and the other handlers share the context source, and with it the cached type descriptions
+	ctxSource := newContextSource(db, logger)
+	contextRegistry := createContextRegistry(ctxSource)
+
+	//JSONLD_CONTEXT_URL is the public url of the hosted @context, when the service is behind a proxy, and
+	//JSONLD_ALLOWED_CONTEXTS is a comma separated list of other @context urls that clients may use
+	contexts, err := newJSONLDContexts(os.Getenv("JSONLD_CONTEXT_URL"), splitList(os.Getenv("JSONLD_ALLOWED_CONTEXTS")))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to load the hosted json-ld context")
+	}
+
+	//HTTP_CACHE_CONTROL is the Cache-Control header of entity responses, e.g. "public, max-age=60"
+	caching := newResponseCaching(os.Getenv("HTTP_CACHE_CONTROL"), db)
+
+	//CORS_ALLOWED_ORIGINS is a comma separated list of the origins that browsers may send requests and
+	//open websocket connections from, and defaults to any origin
+	allowedOrigins := splitList(os.Getenv("CORS_ALLOWED_ORIGINS"))
+	if len(allowedOrigins) == 0 {
+		allowedOrigins = []string{"*"}
+	}
+
+	//ADMIN_API_TOKEN is the bearer token that clients must send to modify entities and to use the admin
+	//routes. Those routes are not served when it is not set.
+	adminToken := os.Getenv("ADMIN_API_TOKEN")
+
+	router := createRequestRouter(contextRegistry, ctxSource, db, wtp, contexts, caching, allowedOrigins, adminToken, logger)
 
 	port := os.Getenv("SERVICE_PORT")
 	if port == "" {
@@ -103,7 +225,7 @@ func CreateRouterAndStartServing(db database.Datastore, logger zerolog.Logger) {
 
 	logger.Info().Str("port", port).Msg("listening for incoming connections")
 
-	err := http.ListenAndServe(":"+port, router.impl)
+	err = http.ListenAndServe(":"+port, router.impl)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to start listening on port")
 	}
@@ -111,15 +233,29 @@ func CreateRouterAndStartServing(db database.Datastore, logger zerolog.Logger) {
 
 type contextSource struct {
 	db     database.Datastore
+	types  *typeDescriptionCache
 	logger zerolog.Logger
 }
 
+func newContextSource(db database.Datastore, logger zerolog.Logger) *contextSource {
+	cs := &contextSource{db: db, types: newTypeDescriptionCache(), logger: logger}
+	db.AddChangeListener(cs.types.invalidate)
+	return cs
+}
+
 func (cs *contextSource) ProvidesAttribute(attributeName string) bool {
-	return false
+	descriptions, err := cs.describeTypes()
+	if err != nil {
+		return false
+	}
+
+	_, ok := describeAttributes(descriptions)[attributeName]
+	return ok
 }
 
 func (cs *contextSource) ProvidesEntitiesWithMatchingID(entityID string) bool {
-	return strings.HasPrefix(entityID, fiware.BeachIDPrefix) || strings.HasPrefix(entityID, diwise.ExerciseTrailIDPrefix)
+	_, err := cs.GetProvidedTypeFromID(entityID)
+	return err == nil
 }
 
 func (cs *contextSource) GetProvidedTypeFromID(entityID string) (string, error) {
@@ -131,21 +267,90 @@ func (cs *contextSource) GetProvidedTypeFromID(entityID string) (string, error)
 		return diwise.ExerciseTrailTypeName, nil
 	}
 
+	if strings.HasPrefix(entityID, FireplaceIDPrefix) {
+		return FireplaceTypeName, nil
+	}
+
+	if strings.HasPrefix(entityID, OutdoorGymIDPrefix) {
+		return OutdoorGymTypeName, nil
+	}
+
+	if strings.HasPrefix(entityID, PlaygroundIDPrefix) {
+		return PlaygroundTypeName, nil
+	}
+
+	if strings.HasPrefix(entityID, SportsFieldIDPrefix) {
+		return SportsFieldTypeName, nil
+	}
+
 	return "", fmt.Errorf("unknown entity id prefix")
 }
 
 func (cs *contextSource) ProvidesType(typeName string) bool {
-	return typeName == fiware.BeachTypeName || typeName == diwise.ExerciseTrailTypeName
+	return contains(providedTypes, typeName)
 }
 
 func (cs *contextSource) GetEntities(query ngsi.Query, callback ngsi.QueryEntitiesCallback) error {
+	filter, err := newQueryFilter(query)
+	if err != nil {
+		return err
+	}
+
+	entityTypes := query.EntityTypes()
+	if len(entityTypes) == 0 {
+		entityTypes = providedTypes
+	}
+
+	if query.Request() != nil {
+		representation := newEntityRepresentation(query.Request().URL.Query())
+		if !representation.isDefault() {
+			next := callback
+			callback = func(entity ngsi.Entity) error {
+				projected, err := representation.apply(entity)
+				if err != nil {
+					return err
+				}
+				return next(projected)
+			}
+		}
+	}
+
+	attributeNames := query.EntityAttributes()
+	if len(attributeNames) == 0 {
+		return cs.queryEntities(entityTypes, filter, callback)
+	}
+
+	//only entities that have at least one of the requested attributes match a query with attrs
+	return cs.queryEntities(entityTypes, filter, func(entity ngsi.Entity) error {
+		attributes, err := entityAttributes(entity)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range attributeNames {
+			if _, ok := attributes[name]; ok {
+				return callback(entity)
+			}
+		}
+
+		return nil
+	})
+}
+
+//queryEntities passes the entities of the given types that match the filter to the callback. Since entities
+//that lack an attribute of the filter do not match, types without any of the attributes are left out.
+func (cs *contextSource) queryEntities(entityTypes []string, filter *queryFilter, callback ngsi.QueryEntitiesCallback) error {
 	var err error
 
-	for _, entityType := range query.EntityTypes() {
+	for _, entityType := range entityTypes {
 		if entityType == fiware.BeachTypeName {
-			err = cs.getBeaches(query, callback)
+			err = cs.getBeaches(filter, callback)
 		} else if entityType == diwise.ExerciseTrailTypeName {
-			err = cs.getTrails(query, callback)
+			err = cs.getTrails(filter, callback)
+		} else if entityType == FireplaceTypeName || entityType == OutdoorGymTypeName || entityType == PlaygroundTypeName {
+			err = cs.getPointsOfInterest(entityType, filter, callback)
+		} else if entityType == SportsFieldTypeName {
+			err = cs.getSportsFields(filter, callback)
 		}
 
 		if err != nil {
@@ -156,61 +361,59 @@ func (cs *contextSource) GetEntities(query ngsi.Query, callback ngsi.QueryEntiti
 	return err
 }
 
-func (cs *contextSource) getBeaches(query ngsi.Query, callback ngsi.QueryEntitiesCallback) error {
+func (cs *contextSource) getBeaches(filter *queryFilter, callback ngsi.QueryEntitiesCallback) error {
 	pointsOfInterest, err := cs.db.GetAllBeaches()
 	if err != nil {
 		return err
 	}
 
 	for _, poi := range pointsOfInterest {
-		location := geojson.CreateGeoJSONPropertyFromMultiPolygon(poi.Geometry.Lines)
-		beach := fiware.NewBeach(poi.ID, poi.Name, location)
-
-		references := []string{}
-
-		if poi.SensorID != nil {
-			sensor := fmt.Sprintf("%s%s", fiware.DeviceIDPrefix, *poi.SensorID)
-			references = append(references, sensor)
+		if filter.matches(beachQueryAttributes(poi)) {
+			callback(convertDBBeachToFiwareBeach(poi))
 		}
+	}
 
-		if poi.NUTSCode != nil {
-			references = append(references, fmt.Sprintf("https://badplatsen.havochvatten.se/badplatsen/karta/#/bath/%s", *poi.NUTSCode))
-		}
+	return nil
+}
 
-		if poi.WikidataID != nil {
-			references = append(references, fmt.Sprintf("https://www.wikidata.org/wiki/%s", *poi.WikidataID))
-		}
+//beachQueryAttributes returns the attributes of a beach that can be used in the q parameter
+func beachQueryAttributes(beach domain.Beach) map[string]interface{} {
+	attributes := pointOfInterestQueryAttributes(domain.PointOfInterest{Name: beach.Name, Description: beach.Description})
 
-		if len(references) > 0 {
-			ref := ngsitypes.NewMultiObjectRelationship(references)
-			beach.RefSeeAlso = &ref
-		}
+	if beach.WaterTemperature != nil {
+		attributes["waterTemperature"] = *beach.WaterTemperature
+	}
 
-		if poi.WaterTemperature != nil {
-			beach.WaterTemperature = ngsitypes.NewNumberProperty(*poi.WaterTemperature)
-		}
+	if len(beach.BeachType) > 0 {
+		attributes["beachType"] = beach.BeachType
+	}
 
-		if !poi.DateCreated.IsZero() {
-			beach.DateCreated = ngsitypes.CreateDateTimeProperty(poi.DateCreated.Format(time.RFC3339))
-		}
+	if len(beach.Facilities) > 0 {
+		attributes["facilities"] = beach.Facilities
+	}
 
-		if !poi.DateModified.IsZero() {
-			beach.DateModified = ngsitypes.CreateDateTimeProperty(poi.DateModified.Format(time.RFC3339))
-		}
+	if beach.Bookable != nil {
+		attributes["bookable"] = *beach.Bookable
+	}
 
-		callback(beach.WithDescription(poi.Description))
+	if len(beach.OpeningHours) > 0 {
+		attributes["openingHours"] = beach.OpeningHours
 	}
 
-	return nil
+	return attributes
 }
 
-func (cs *contextSource) getTrails(query ngsi.Query, callback ngsi.QueryEntitiesCallback) error {
+func (cs *contextSource) getTrails(filter *queryFilter, callback ngsi.QueryEntitiesCallback) error {
 	allTrails, err := cs.db.GetAllTrails()
 	if err != nil {
 		return err
 	}
 
 	for _, t := range allTrails {
+		if !filter.matches(trailQueryAttributes(t)) {
+			continue
+		}
+
 		trail := convertDBTrailToFiwareExerciseTrail(t)
 		callback(trail)
 	}
@@ -218,7 +421,132 @@ func (cs *contextSource) getTrails(query ngsi.Query, callback ngsi.QueryEntities
 	return nil
 }
 
+//trailQueryAttributes returns the attributes of a trail that can be used in the q parameter
+func trailQueryAttributes(trail domain.ExerciseTrail) map[string]interface{} {
+	attributes := map[string]interface{}{
+		"name":       trail.Name,
+		"status":     trail.Status,
+		"length":     trail.Length,
+		"areaServed": trail.AreaServed,
+		"category":   trail.Category,
+	}
+
+	if trail.Difficulty != "" {
+		attributes["difficulty"] = trail.Difficulty
+	}
+
+	if trail.Elevation != nil {
+		attributes["totalAscent"] = trail.Elevation.TotalAscent
+		attributes["totalDescent"] = trail.Elevation.TotalDescent
+		attributes["maxGradient"] = trail.Elevation.MaxGradient
+	}
+
+	return attributes
+}
+
+func (cs *contextSource) getPointsOfInterest(typeName string, filter *queryFilter, callback ngsi.QueryEntitiesCallback) error {
+	var err error
+	pointsOfInterest := []domain.PointOfInterest{}
+	idPrefix := ""
+
+	if typeName == FireplaceTypeName {
+		var fireplaces []domain.Fireplace
+		fireplaces, err = cs.db.GetAllFireplaces()
+		for _, f := range fireplaces {
+			pointsOfInterest = append(pointsOfInterest, f.PointOfInterest)
+		}
+		idPrefix = FireplaceIDPrefix
+	} else if typeName == OutdoorGymTypeName {
+		var gyms []domain.OutdoorGym
+		gyms, err = cs.db.GetAllOutdoorGyms()
+		for _, g := range gyms {
+			pointsOfInterest = append(pointsOfInterest, g.PointOfInterest)
+		}
+		idPrefix = OutdoorGymIDPrefix
+	} else if typeName == PlaygroundTypeName {
+		var playgrounds []domain.Playground
+		playgrounds, err = cs.db.GetAllPlaygrounds()
+		for _, p := range playgrounds {
+			pointsOfInterest = append(pointsOfInterest, p.PointOfInterest)
+		}
+		idPrefix = PlaygroundIDPrefix
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, poi := range pointsOfInterest {
+		if filter.matches(pointOfInterestQueryAttributes(poi)) {
+			callback(newPointOfInterestEntity(typeName, idPrefix, poi))
+		}
+	}
+
+	return nil
+}
+
+//pointOfInterestQueryAttributes returns the attributes shared by all points of interest that can be used in the q parameter
+func pointOfInterestQueryAttributes(poi domain.PointOfInterest) map[string]interface{} {
+	attributes := map[string]interface{}{
+		"name": poi.Name,
+	}
+
+	if poi.Description != "" {
+		attributes["description"] = poi.Description
+	}
+
+	return attributes
+}
+
+func (cs *contextSource) getSportsFields(filter *queryFilter, callback ngsi.QueryEntitiesCallback) error {
+	sportsFields, err := cs.db.GetAllSportsFields()
+	if err != nil {
+		return err
+	}
+
+	for _, sf := range sportsFields {
+		if filter.matches(sportsFieldQueryAttributes(sf)) {
+			callback(newSportsFieldEntity(sf))
+		}
+	}
+
+	return nil
+}
+
+//sportsFieldQueryAttributes returns the attributes of a sports field that can be used in the q parameter
+func sportsFieldQueryAttributes(sportsField domain.SportsField) map[string]interface{} {
+	attributes := pointOfInterestQueryAttributes(sportsField.PointOfInterest)
+
+	if len(sportsField.Category) > 0 {
+		attributes["category"] = sportsField.Category
+	}
+
+	if sportsField.Surface != "" {
+		attributes["surface"] = sportsField.Surface
+	}
+
+	if sportsField.Bookable != nil {
+		attributes["bookable"] = *sportsField.Bookable
+	}
+
+	if len(sportsField.OpeningHours) > 0 {
+		attributes["openingHours"] = sportsField.OpeningHours
+	}
+
+	return attributes
+}
+
+//RetrieveEntity returns an entity with the attributes and in the representation asked for by the request
 func (cs *contextSource) RetrieveEntity(entityID string, request ngsi.Request) (ngsi.Entity, error) {
+	entity, err := cs.retrieveEntity(entityID)
+	if err != nil || request == nil || request.Request() == nil {
+		return entity, err
+	}
+
+	return newEntityRepresentation(request.Request().URL.Query()).apply(entity)
+}
+
+func (cs *contextSource) retrieveEntity(entityID string) (ngsi.Entity, error) {
 
 	if strings.HasPrefix(entityID, fiware.BeachIDPrefix) {
 		// Remove urn:ngsi-ld:Beach prefix
@@ -229,8 +557,7 @@ func (cs *contextSource) RetrieveEntity(entityID string, request ngsi.Request) (
 			return nil, err
 		}
 
-		location := geojson.CreateGeoJSONPropertyFromMultiPolygon(poi.Geometry.Lines)
-		beach := fiware.NewBeach(poi.ID, poi.Name, location).WithDescription(poi.Description)
+		beach := convertDBBeachToFiwareBeach(*poi)
 		return beach, nil
 	} else if strings.HasPrefix(entityID, diwise.ExerciseTrailIDPrefix) {
 		// Remove urn:ngsi-ld:ExerciseTrail prefix
@@ -244,22 +571,157 @@ func (cs *contextSource) RetrieveEntity(entityID string, request ngsi.Request) (
 		trail := convertDBTrailToFiwareExerciseTrail(*dbTrail)
 
 		return trail, nil
+	} else if strings.HasPrefix(entityID, FireplaceIDPrefix) {
+		fireplace, err := cs.db.GetFireplaceFromID(strings.TrimPrefix(entityID, FireplaceIDPrefix))
+		if err != nil {
+			return nil, err
+		}
+
+		return newPointOfInterestEntity(FireplaceTypeName, FireplaceIDPrefix, fireplace.PointOfInterest), nil
+	} else if strings.HasPrefix(entityID, OutdoorGymIDPrefix) {
+		gym, err := cs.db.GetOutdoorGymFromID(strings.TrimPrefix(entityID, OutdoorGymIDPrefix))
+		if err != nil {
+			return nil, err
+		}
+
+		return newPointOfInterestEntity(OutdoorGymTypeName, OutdoorGymIDPrefix, gym.PointOfInterest), nil
+	} else if strings.HasPrefix(entityID, PlaygroundIDPrefix) {
+		playground, err := cs.db.GetPlaygroundFromID(strings.TrimPrefix(entityID, PlaygroundIDPrefix))
+		if err != nil {
+			return nil, err
+		}
+
+		return newPointOfInterestEntity(PlaygroundTypeName, PlaygroundIDPrefix, playground.PointOfInterest), nil
+	} else if strings.HasPrefix(entityID, SportsFieldIDPrefix) {
+		sportsField, err := cs.db.GetSportsFieldFromID(strings.TrimPrefix(entityID, SportsFieldIDPrefix))
+		if err != nil {
+			return nil, err
+		}
+
+		return newSportsFieldEntity(*sportsField), nil
 	}
 
 	return nil, fmt.Errorf("entity %s not found", entityID)
 }
 
 func (cs *contextSource) CreateEntity(typeName, entityID string, request ngsi.Request) error {
-	return errors.New("not implemented")
+	fragment := map[string]json.RawMessage{}
+
+	err := request.DecodeBodyInto(&fragment)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errBadRequestData, err.Error())
+	}
+
+	return cs.createEntity(typeName, entityID, fragment)
 }
 
 func (cs *contextSource) UpdateEntityAttributes(entityID string, request ngsi.Request) error {
-	return errors.New("not implemented")
+	attributes := map[string]json.RawMessage{}
+
+	err := request.DecodeBodyInto(&attributes)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errBadRequestData, err.Error())
+	}
+
+	return cs.updateEntityAttributes(entityID, attributes, true)
+}
+
+//beachEntity extends the Beach data model with attributes that are specific to this service
+type beachEntity struct {
+	*fiware.Beach
+	WaterTemperature *observedNumberProperty     `json:"waterTemperature,omitempty"`
+	BeachType        *ngsitypes.TextListProperty `json:"beachType,omitempty"`
+	Facilities       *ngsitypes.TextListProperty `json:"facilities,omitempty"`
+	Bookable         *booleanProperty            `json:"bookable,omitempty"`
+	OpeningHours     *ngsitypes.TextListProperty `json:"openingHours,omitempty"`
+	ContactPoint     *contactPointProperty       `json:"contactPoint,omitempty"`
 }
 
-func convertDBTrailToFiwareExerciseTrail(trail domain.ExerciseTrail) *diwise.ExerciseTrail {
+func convertDBBeachToFiwareBeach(poi domain.Beach) *beachEntity {
+	location := geojson.CreateGeoJSONPropertyFromMultiPolygon(poi.Geometry.Lines)
+	beach := &beachEntity{
+		Beach: fiware.NewBeach(poi.ID, poi.Name, location).WithDescription(poi.Description),
+	}
+
+	references := []string{}
+
+	for _, sensorID := range poi.Sensors {
+		sensor := fmt.Sprintf("%s%s", fiware.DeviceIDPrefix, sensorID)
+		references = append(references, sensor)
+	}
+
+	if poi.NUTSCode != nil {
+		references = append(references, fmt.Sprintf("https://badplatsen.havochvatten.se/badplatsen/karta/#/bath/%s", *poi.NUTSCode))
+	}
+
+	if poi.WikidataID != nil {
+		references = append(references, fmt.Sprintf("https://www.wikidata.org/wiki/%s", *poi.WikidataID))
+	}
+
+	if len(references) > 0 {
+		ref := ngsitypes.NewMultiObjectRelationship(references)
+		beach.RefSeeAlso = &ref
+	}
+
+	if poi.WaterTemperature != nil {
+		beach.WaterTemperature = newObservedNumberProperty(*poi.WaterTemperature, poi.WaterTemperatureObservedAt, poi.WaterTemperatureStale)
+	}
+
+	if len(poi.BeachType) > 0 {
+		beach.BeachType = ngsitypes.NewTextListProperty(poi.BeachType)
+	}
+
+	if len(poi.Facilities) > 0 {
+		beach.Facilities = ngsitypes.NewTextListProperty(poi.Facilities)
+	}
+
+	if poi.Bookable != nil {
+		beach.Bookable = newBooleanProperty(*poi.Bookable)
+	}
+
+	if len(poi.OpeningHours) > 0 {
+		beach.OpeningHours = ngsitypes.NewTextListProperty(poi.OpeningHours)
+	}
+
+	if poi.ContactPoint != nil {
+		beach.ContactPoint = newContactPointProperty(*poi.ContactPoint)
+	}
+
+	if !poi.DateCreated.IsZero() {
+		beach.DateCreated = ngsitypes.CreateDateTimeProperty(poi.DateCreated.Format(time.RFC3339))
+	}
+
+	if !poi.DateModified.IsZero() {
+		beach.DateModified = ngsitypes.CreateDateTimeProperty(poi.DateModified.Format(time.RFC3339))
+	}
+
+	return beach
+}
+
+//exerciseTrailEntity extends the ExerciseTrail data model with attributes that are specific to this service
+type exerciseTrailEntity struct {
+	*diwise.ExerciseTrail
+	ComputedLength *ngsitypes.NumberProperty `json:"computedLength,omitempty"`
+
+	HoursSinceLastPreparation *ngsitypes.NumberProperty `json:"hoursSinceLastPreparation,omitempty"`
+	StatusReason              *ngsitypes.TextProperty   `json:"statusReason,omitempty"`
+	LightsOn                  *booleanProperty          `json:"lightsOn,omitempty"`
+	LightingSchedule          *lightingScheduleProperty `json:"lightingSchedule,omitempty"`
+	TotalAscent               *ngsitypes.NumberProperty `json:"totalAscent,omitempty"`
+	TotalDescent              *ngsitypes.NumberProperty `json:"totalDescent,omitempty"`
+	MaxGradient               *ngsitypes.NumberProperty `json:"maxGradient,omitempty"`
+	Difficulty                *ngsitypes.TextProperty   `json:"difficulty,omitempty"`
+}
+
+func convertDBTrailToFiwareExerciseTrail(trail domain.ExerciseTrail) *exerciseTrailEntity {
 	location := geojson.CreateGeoJSONPropertyFromLineString(trail.Geometry.Lines)
-	exerciseTrail := diwise.NewExerciseTrail(trail.ID, trail.Name, trail.Length, trail.Description, location)
+	exerciseTrail := &exerciseTrailEntity{
+		ExerciseTrail: diwise.NewExerciseTrail(trail.ID, trail.Name, trail.Length, trail.Description, location),
+	}
+
+	if trail.ComputedLength > 0 {
+		exerciseTrail.ComputedLength = ngsitypes.NewNumberProperty(math.Round(trail.ComputedLength*1000) / 1000)
+	}
 
 	if !trail.DateCreated.IsZero() {
 		exerciseTrail.DateCreated = ngsitypes.CreateDateTimeProperty(trail.DateCreated.Format(time.RFC3339))
@@ -271,6 +733,9 @@ func convertDBTrailToFiwareExerciseTrail(trail domain.ExerciseTrail) *diwise.Exe
 
 	if !trail.DateLastPrepared.IsZero() {
 		exerciseTrail.DateLastPreparation = ngsitypes.CreateDateTimeProperty(trail.DateLastPrepared.Format(time.RFC3339))
+
+		hours := time.Since(trail.DateLastPrepared).Hours()
+		exerciseTrail.HoursSinceLastPreparation = ngsitypes.NewNumberProperty(math.Round(hours*10) / 10)
 	}
 
 	if trail.AreaServed != "" {
@@ -289,5 +754,25 @@ func convertDBTrailToFiwareExerciseTrail(trail domain.ExerciseTrail) *diwise.Exe
 		exerciseTrail.Status = ngsitypes.NewTextProperty(trail.Status)
 	}
 
+	if trail.StatusReason != "" {
+		exerciseTrail.StatusReason = ngsitypes.NewTextProperty(trail.StatusReason)
+	}
+
+	if trail.LightingSchedule != nil && len(trail.Geometry.Lines) > 0 {
+		position := domain.Point{Coordinates: trail.Geometry.Lines[0]}
+		exerciseTrail.LightsOn = newBooleanProperty(trail.LightingSchedule.LightsOn(time.Now().In(localTimeZone), position))
+		exerciseTrail.LightingSchedule = newLightingScheduleProperty(*trail.LightingSchedule)
+	}
+
+	if trail.Difficulty != "" {
+		exerciseTrail.Difficulty = ngsitypes.NewTextProperty(trail.Difficulty)
+	}
+
+	if trail.Elevation != nil {
+		exerciseTrail.TotalAscent = ngsitypes.NewNumberProperty(math.Round(trail.Elevation.TotalAscent))
+		exerciseTrail.TotalDescent = ngsitypes.NewNumberProperty(math.Round(trail.Elevation.TotalDescent))
+		exerciseTrail.MaxGradient = ngsitypes.NewNumberProperty(math.Round(trail.Elevation.MaxGradient*10) / 10)
+	}
+
 	return exerciseTrail
 }
@@ -0,0 +1,678 @@
+package application
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	coreContextURL     string = "https://uri.etsi.org/ngsi-ld/v1/ngsi-ld-core-context.jsonld"
+	defaultVocabulary  string = "https://uri.etsi.org/ngsi-ld/default-context/"
+	jsonldContextRel   string = "http://www.w3.org/ns/json-ld#context"
+	jsonldContextPath  string = "/ngsi-ld/v1/jsonldContexts/pointofinterest.jsonld"
+	maxContextDepth    int    = 4
+	maxContextSize     int64  = 1 << 20
+	maxCachedContexts  int    = 100
+	errorTypeLdContext string = "https://uri.etsi.org/ngsi-ld/errors/LdContextNotAvailable"
+)
+
+//go:embed context.jsonld
+var defaultContextDocument []byte
+
+//coreTerms are the terms of the NGSI-LD core context that are used as attribute names. The core
+//context is always applied last, so these terms can not be redefined by other contexts.
+var coreTerms map[string]string = map[string]string{
+	"name":        "https://uri.etsi.org/ngsi-ld/name",
+	"description": "https://uri.etsi.org/ngsi-ld/description",
+	"location":    "https://uri.etsi.org/ngsi-ld/location",
+	"observedAt":  "https://uri.etsi.org/ngsi-ld/observedAt",
+	"createdAt":   "https://uri.etsi.org/ngsi-ld/createdAt",
+	"modifiedAt":  "https://uri.etsi.org/ngsi-ld/modifiedAt",
+}
+
+//jsonldContext holds the expanded term definitions of a JSON-LD @context
+type jsonldContext struct {
+	terms    map[string]string
+	iris     map[string]string
+	prefixes map[string]string
+}
+
+func newJSONLDContext(definitions map[string]string) *jsonldContext {
+	ctx := &jsonldContext{terms: map[string]string{}, iris: map[string]string{}, prefixes: map[string]string{}}
+
+	names := make([]string, 0, len(definitions))
+	for term := range definitions {
+		names = append(names, term)
+	}
+	sort.Strings(names)
+
+	for _, term := range names {
+		iri := expandCompactIRI(definitions[term], definitions)
+		ctx.terms[term] = iri
+
+		if strings.HasSuffix(iri, "#") || strings.HasSuffix(iri, "/") {
+			ctx.prefixes[term] = iri
+		}
+
+		if existing, ok := ctx.iris[iri]; !ok || len(term) < len(existing) {
+			ctx.iris[iri] = term
+		}
+	}
+
+	for term, iri := range coreTerms {
+		ctx.terms[term] = iri
+		ctx.iris[iri] = term
+	}
+
+	return ctx
+}
+
+//expandCompactIRI expands values such as fiware:category using the prefixes in the definitions
+func expandCompactIRI(value string, definitions map[string]string) string {
+	idx := strings.Index(value, ":")
+	if idx <= 0 || strings.HasPrefix(value[idx+1:], "//") {
+		return value
+	}
+
+	if prefix, ok := definitions[value[:idx]]; ok {
+		return prefix + value[idx+1:]
+	}
+
+	return value
+}
+
+//expand returns the IRI of a term, using the default vocabulary of NGSI-LD for terms that are not defined
+func (ctx *jsonldContext) expand(term string) string {
+	if iri, ok := ctx.terms[term]; ok {
+		return iri
+	}
+
+	if strings.Contains(term, ":") {
+		return expandCompactIRI(term, ctx.prefixes)
+	}
+
+	return defaultVocabulary + term
+}
+
+//compact returns the shortest term or compact IRI for an IRI
+func (ctx *jsonldContext) compact(iri string) string {
+	if term, ok := ctx.iris[iri]; ok {
+		return term
+	}
+
+	compacted := iri
+	for prefix, prefixIRI := range ctx.prefixes {
+		if strings.HasPrefix(iri, prefixIRI) && len(iri) > len(prefixIRI) {
+			candidate := prefix + ":" + iri[len(prefixIRI):]
+			if compacted == iri || len(candidate) < len(compacted) || (len(candidate) == len(compacted) && candidate < compacted) {
+				compacted = candidate
+			}
+		}
+	}
+
+	if compacted == iri && strings.HasPrefix(iri, defaultVocabulary) {
+		return strings.TrimPrefix(iri, defaultVocabulary)
+	}
+
+	return compacted
+}
+
+//jsonldContexts resolves the @context that clients ask for, and translates attribute names between
+//those contexts and the context that is hosted by this service. Remote contexts are only retrieved if
+//they are allowed, so that clients can not make the service request arbitrary urls.
+type jsonldContexts struct {
+	contextURL string
+	allowed    map[string]bool
+	defaults   *jsonldContext
+	client     *http.Client
+
+	mu    sync.Mutex
+	cache map[string]*jsonldContext
+}
+
+//newJSONLDContexts creates a resolver for the hosted context. When contextURL is empty, the url of the
+//hosted context is derived from the host of each request. The core context and the hosted context are
+//always available, and allowedContexts lists the urls of the other contexts that clients may use.
+func newJSONLDContexts(contextURL string, allowedContexts []string) (*jsonldContexts, error) {
+	c := &jsonldContexts{
+		contextURL: contextURL,
+		allowed:    map[string]bool{},
+		client:     &http.Client{Timeout: 5 * time.Second},
+		cache:      map[string]*jsonldContext{},
+	}
+
+	for _, allowed := range allowedContexts {
+		c.allowed[allowed] = true
+	}
+
+	document := map[string]interface{}{}
+	if err := json.Unmarshal(defaultContextDocument, &document); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the hosted context: %s", err.Error())
+	}
+
+	definitions := map[string]string{}
+	if err := c.collectDefinitions(document["@context"], definitions, 0); err != nil {
+		return nil, err
+	}
+
+	c.defaults = newJSONLDContext(definitions)
+
+	return c, nil
+}
+
+func (c *jsonldContexts) hostedContextURL(r *http.Request) string {
+	if c.contextURL != "" {
+		return c.contextURL
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	return scheme + "://" + r.Host + jsonldContextPath
+}
+
+func (c *jsonldContexts) isHostedContext(contextURL string) bool {
+	return contextURL == c.contextURL || strings.HasSuffix(contextURL, jsonldContextPath)
+}
+
+//collectDefinitions adds the term definitions of a @context value, which may be a url, an object or a
+//list of both, to the definitions. Later definitions replace earlier ones.
+func (c *jsonldContexts) collectDefinitions(value interface{}, definitions map[string]string, depth int) error {
+	if depth > maxContextDepth {
+		return fmt.Errorf("@context is nested too deeply")
+	}
+
+	switch v := value.(type) {
+	case string:
+		if v == coreContextURL {
+			return nil
+		}
+
+		if c.defaults != nil && c.isHostedContext(v) {
+			for term, iri := range c.defaults.terms {
+				definitions[term] = iri
+			}
+			return nil
+		}
+
+		if !c.allowed[v] {
+			return fmt.Errorf("@context %s is not one of the contexts that are available", v)
+		}
+
+		document, err := c.fetch(v)
+		if err != nil {
+			return err
+		}
+
+		return c.collectDefinitions(document["@context"], definitions, depth+1)
+	case []interface{}:
+		for _, item := range v {
+			if err := c.collectDefinitions(item, definitions, depth); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		for term, definition := range v {
+			if strings.HasPrefix(term, "@") {
+				continue
+			}
+
+			if iri, ok := definition.(string); ok {
+				definitions[term] = iri
+			} else if object, ok := definition.(map[string]interface{}); ok {
+				if iri, ok := object["@id"].(string); ok {
+					definitions[term] = iri
+				}
+			}
+		}
+	case nil:
+	default:
+		return fmt.Errorf("invalid @context")
+	}
+
+	return nil
+}
+
+func (c *jsonldContexts) fetch(contextURL string) (map[string]interface{}, error) {
+	u, err := url.Parse(contextURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("@context %q is not an http url", contextURL)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, contextURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/ld+json, application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve @context %s: %s", contextURL, err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to retrieve @context %s: status %d", contextURL, resp.StatusCode)
+	}
+
+	document := map[string]interface{}{}
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxContextSize)).Decode(&document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal @context %s: %s", contextURL, err.Error())
+	}
+
+	return document, nil
+}
+
+//resolve returns the context for a @context value, using a cache for contexts that are given as a url
+func (c *jsonldContexts) resolve(value interface{}) (*jsonldContext, error) {
+	contextURL, isURL := value.(string)
+
+	if isURL {
+		if c.isHostedContext(contextURL) {
+			return c.defaults, nil
+		}
+
+		c.mu.Lock()
+		ctx, ok := c.cache[contextURL]
+		c.mu.Unlock()
+
+		if ok {
+			return ctx, nil
+		}
+	}
+
+	definitions := map[string]string{}
+	if err := c.collectDefinitions(value, definitions, 0); err != nil {
+		return nil, err
+	}
+
+	ctx := newJSONLDContext(definitions)
+
+	if isURL {
+		c.mu.Lock()
+		if len(c.cache) >= maxCachedContexts {
+			c.cache = map[string]*jsonldContext{}
+		}
+		c.cache[contextURL] = ctx
+		c.mu.Unlock()
+	}
+
+	return ctx, nil
+}
+
+//linkedContext returns the url of the @context given in the Link header of a request, if any
+func linkedContext(r *http.Request) string {
+	for _, link := range strings.Split(strings.Join(r.Header.Values("Link"), ","), ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "rel=") && strings.Trim(strings.TrimPrefix(param, "rel="), "\"") == jsonldContextRel {
+				return strings.Trim(target, "<>")
+			}
+		}
+	}
+
+	return ""
+}
+
+func acceptsJSONLD(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/ld+json")
+}
+
+//contextTranslation translates attribute names and types between the context requested by a client
+//and the hosted context that is used internally
+type contextTranslation struct {
+	requested *jsonldContext
+	hosted    *jsonldContext
+}
+
+func (t contextTranslation) toInternal(term string) string {
+	return t.hosted.compact(t.requested.expand(term))
+}
+
+func (t contextTranslation) toClient(term string) string {
+	return t.requested.compact(t.hosted.expand(term))
+}
+
+func (t contextTranslation) translateList(values string, translate func(string) string) string {
+	if values == "" {
+		return values
+	}
+
+	items := strings.Split(values, ",")
+	for idx, item := range items {
+		items[idx] = translate(strings.TrimSpace(item))
+	}
+
+	return strings.Join(items, ",")
+}
+
+//translateQuery translates the attribute names of a q expression
+func (t contextTranslation) translateQuery(q string) string {
+	result := &strings.Builder{}
+	start := 0
+
+	for idx := 0; idx <= len(q); idx++ {
+		if idx < len(q) && q[idx] != ';' && q[idx] != '|' {
+			continue
+		}
+
+		expression := q[start:idx]
+		end := strings.IndexAny(expression, "=!<>")
+		if end > 0 {
+			attribute := strings.TrimSpace(expression[:end])
+			result.WriteString(t.toInternal(attribute) + expression[end:])
+		} else {
+			result.WriteString(expression)
+		}
+
+		if idx < len(q) {
+			result.WriteByte(q[idx])
+		}
+		start = idx + 1
+	}
+
+	return result.String()
+}
+
+//translateEntity renames the attributes and the type of an entity using the translate function
+func translateEntity(entity json.RawMessage, translate func(string) string) (*orderedObject, error) {
+	object, err := decodeOrderedObject(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	translated := &orderedObject{members: map[string]json.RawMessage{}}
+
+	for _, key := range object.keys {
+		value := object.members[key]
+		name := key
+
+		if key == "type" {
+			typeName := ""
+			if json.Unmarshal(value, &typeName) == nil {
+				value, _ = json.Marshal(translate(typeName))
+			}
+		} else if key != "id" && key != "@context" {
+			name = translate(key)
+		}
+
+		translated.keys = append(translated.keys, name)
+		translated.members[name] = value
+	}
+
+	return translated, nil
+}
+
+//bufferedResponseWriter keeps a response in memory so that it can be rewritten before it is sent
+type bufferedResponseWriter struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (b *bufferedResponseWriter) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponseWriter) Write(data []byte) (int, error) {
+	if b.statusCode == 0 {
+		b.statusCode = http.StatusOK
+	}
+	return b.body.Write(data)
+}
+
+func (b *bufferedResponseWriter) WriteHeader(statusCode int) {
+	if b.statusCode == 0 {
+		b.statusCode = statusCode
+	}
+}
+
+//handler wraps a handler of entities so that attribute names in requests are expanded from, and
+//attribute names in responses are compacted to, the @context given by the client. Responses include
+//the @context inline when application/ld+json is accepted, and in a Link header otherwise.
+func (c *jsonldContexts) handler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hostedURL := c.hostedContextURL(r)
+		requestedContext := interface{}(hostedURL)
+
+		if link := linkedContext(r); link != "" {
+			requestedContext = link
+		}
+
+		body := []byte{}
+		if r.Body != nil && (r.Method == http.MethodPost || r.Method == http.MethodPatch) {
+			body, _ = io.ReadAll(r.Body)
+
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "application/ld+json") {
+				if inline := inlineContext(body); inline != nil {
+					requestedContext = inline
+				}
+			}
+		}
+
+		requested, err := c.resolve(requestedContext)
+		if err != nil {
+			writeProblemDetails(w, http.StatusServiceUnavailable, problemDetails{
+				Type: errorTypeLdContext, Title: "LD Context Not Available", Detail: err.Error(),
+			})
+			return
+		}
+
+		translation := contextTranslation{requested: requested, hosted: c.defaults}
+
+		params := r.URL.Query()
+		for _, name := range []string{"attrs", "type"} {
+			if params.Has(name) {
+				params.Set(name, translation.translateList(params.Get(name), translation.toInternal))
+			}
+		}
+		if params.Has("q") {
+			params.Set("q", translation.translateQuery(params.Get("q")))
+		}
+		r.URL.RawQuery = params.Encode()
+
+		if len(body) > 0 {
+			body = translation.translateRequestBody(body)
+			r.ContentLength = int64(len(body))
+			r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		buffer := &bufferedResponseWriter{header: http.Header{}}
+		next(buffer, r)
+
+		for key, values := range buffer.header {
+			w.Header()[key] = values
+		}
+
+		response := buffer.body.Bytes()
+		contentType := buffer.header.Get("Content-Type")
+		isJSON := strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, "application/ld+json")
+
+		if buffer.statusCode >= 200 && buffer.statusCode < 300 && isJSON && len(response) > 0 {
+			if acceptsJSONLD(r) {
+				response = translateJSONEntities(response, translation.toClient, requestedContext)
+				w.Header().Set("Content-Type", "application/ld+json")
+			} else {
+				linkURL, ok := requestedContext.(string)
+				if !ok {
+					linkURL = hostedURL
+				}
+
+				response = translateJSONEntities(response, translation.toClient, nil)
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"%s\"; type=\"application/ld+json\"", linkURL, jsonldContextRel))
+			}
+
+			w.Header().Del("Content-Length")
+		}
+
+		if buffer.statusCode == 0 {
+			buffer.statusCode = http.StatusOK
+		}
+
+		w.WriteHeader(buffer.statusCode)
+		w.Write(response)
+	}
+}
+
+func inlineContext(body []byte) interface{} {
+	document := struct {
+		Context interface{} `json:"@context"`
+	}{}
+
+	if json.Unmarshal(body, &document) != nil {
+		return nil
+	}
+
+	return document.Context
+}
+
+//translateRequestBody expands the attribute names and types of the entities or entity fragments in a
+//request, or of the entity selectors, attrs and q of a batch query
+func (t contextTranslation) translateRequestBody(body []byte) []byte {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return body
+	}
+
+	query := batchQuery{}
+	if trimmed[0] == '{' && json.Unmarshal(trimmed, &query) == nil && query.Type == "Query" {
+		for idx := range query.Entities {
+			query.Entities[idx].Type = t.toInternal(query.Entities[idx].Type)
+		}
+		for idx := range query.Attrs {
+			query.Attrs[idx] = t.toInternal(query.Attrs[idx])
+		}
+		query.Q = t.translateQuery(query.Q)
+
+		translated, err := json.Marshal(query)
+		if err != nil {
+			return body
+		}
+		return translated
+	}
+
+	var result interface{}
+
+	if trimmed[0] == '[' {
+		fragments := []json.RawMessage{}
+		if json.Unmarshal(trimmed, &fragments) != nil {
+			return body
+		}
+
+		translated := []*orderedObject{}
+		for _, fragment := range fragments {
+			object, err := translateEntity(fragment, t.toInternal)
+			if err != nil {
+				return body
+			}
+			translated = append(translated, object)
+		}
+		result = translated
+	} else {
+		object, err := translateEntity(trimmed, t.toInternal)
+		if err != nil {
+			return body
+		}
+		result = object
+	}
+
+	translated, err := json.Marshal(result)
+	if err != nil {
+		return body
+	}
+
+	return translated
+}
+
+//translateJSONEntities translates an entity or a list of entities, and replaces their @context with the
+//given context, or removes it if the context is nil. Bodies that are not entities are returned unchanged.
+func translateJSONEntities(body []byte, translate func(string) string, context interface{}) []byte {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return body
+	}
+
+	translateOne := func(entity json.RawMessage) (*orderedObject, error) {
+		translated, err := translateEntity(entity, translate)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := translated.members["id"]; !ok {
+			return nil, fmt.Errorf("json object is not an entity")
+		}
+
+		translated.remove("@context")
+		if context != nil {
+			contextValue, _ := json.Marshal(context)
+			translated.keys = append(translated.keys, "@context")
+			translated.members["@context"] = contextValue
+		}
+
+		return translated, nil
+	}
+
+	var result interface{}
+
+	if trimmed[0] == '[' {
+		entities := []json.RawMessage{}
+		if json.Unmarshal(trimmed, &entities) != nil {
+			return body
+		}
+
+		translated := []*orderedObject{}
+		for _, entity := range entities {
+			object, err := translateOne(entity)
+			if err != nil {
+				return body
+			}
+			translated = append(translated, object)
+		}
+		result = translated
+	} else if trimmed[0] == '{' {
+		object, err := translateOne(trimmed)
+		if err != nil {
+			return body
+		}
+		result = object
+	} else {
+		return body
+	}
+
+	translatedBody, err := json.Marshal(result)
+	if err != nil {
+		return body
+	}
+
+	return translatedBody
+}
+
+//newJSONLDContextHandler returns a handler that serves the @context that defines the terms used by this service
+func newJSONLDContextHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/ld+json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(defaultContextDocument)
+	}
+}
@@ -0,0 +1,52 @@
+package application
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestThatOnlyAllowedContextsAreRetrieved(t *testing.T) {
+	is := is.New(t)
+
+	requests := 0
+	contextServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"@context": {"namn": "https://uri.etsi.org/ngsi-ld/name"}}`))
+	}))
+	defer contextServer.Close()
+
+	allowedURL := contextServer.URL + "/allowed.jsonld"
+	contexts, err := newJSONLDContexts("", []string{allowedURL})
+	is.NoErr(err)
+
+	handler := contexts.handler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"id": "urn:ngsi-ld:Beach:1", "type": "Beach"}`))
+	})
+
+	get := func(contextURL string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ngsi-ld/v1/entities/urn:ngsi-ld:Beach:1", nil)
+		req.Header.Set("Link", `<`+contextURL+`>; rel="http://www.w3.org/ns/json-ld#context"; type="application/ld+json"`)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	w := get(contextServer.URL + "/other.jsonld")
+	is.Equal(w.Code, http.StatusServiceUnavailable)
+	problem := problemDetails{}
+	is.NoErr(json.Unmarshal(w.Body.Bytes(), &problem))
+	is.Equal(problem.Type, errorTypeLdContext)
+	is.Equal(requests, 0) // contexts that are not allowed should never be retrieved
+
+	is.Equal(get(coreContextURL).Code, http.StatusOK)
+	is.Equal(requests, 0) // the core context is known without retrieving it
+
+	is.Equal(get(allowedURL).Code, http.StatusOK)
+	is.Equal(get(allowedURL).Code, http.StatusOK)
+	is.Equal(requests, 1) // allowed contexts should be retrieved once and cached
+}
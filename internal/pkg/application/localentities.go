@@ -0,0 +1,162 @@
+package application
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/diwise"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/fiware"
+	"github.com/go-chi/chi/v5"
+)
+
+//problemStatusCode returns the http status code that NGSI-LD uses for an error type
+func problemStatusCode(problem problemDetails) int {
+	switch problem.Type {
+	case errorTypeBadRequestData, errorTypeInvalidRequest:
+		return http.StatusBadRequest
+	case errorTypeResourceNotFound:
+		return http.StatusNotFound
+	case errorTypeAlreadyExists:
+		return http.StatusConflict
+	case errorTypeOperationNotSupported:
+		return http.StatusUnprocessableEntity
+	}
+
+	return http.StatusInternalServerError
+}
+
+type geoProperty struct {
+	Type  string `json:"type"`
+	Value struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	} `json:"value"`
+}
+
+//createEntity creates a locally managed beach or exercise trail from an entity in normalized form
+func (cs *contextSource) createEntity(typeName, entityID string, fragment map[string]json.RawMessage) error {
+	attributes := map[string]json.RawMessage{}
+	for name, value := range fragment {
+		attributes[name] = value
+	}
+
+	location := geoProperty{}
+	if err := json.Unmarshal(attributes["location"], &location); err != nil || location.Type != "GeoProperty" {
+		return fmt.Errorf("%w: location must be a GeoProperty", errBadRequestData)
+	}
+	delete(attributes, "location")
+
+	status := ""
+	if data, ok := attributes["status"]; ok {
+		property := struct {
+			Value string `json:"value"`
+		}{}
+		if err := json.Unmarshal(data, &property); err != nil {
+			return fmt.Errorf("%w: invalid value of status", errBadRequestData)
+		}
+		status = property.Value
+		delete(attributes, "status")
+	}
+
+	update, err := parseAttributeUpdate(attributes)
+	if err != nil {
+		return err
+	}
+
+	if typeName == fiware.BeachTypeName && strings.HasPrefix(entityID, fiware.BeachIDPrefix) {
+		beach := domain.Beach{ID: strings.TrimPrefix(entityID, fiware.BeachIDPrefix)}
+
+		if status != "" {
+			return fmt.Errorf("%w: status", database.ErrUnsupportedAttribute)
+		}
+
+		if err = decodeBeachGeometry(location, &beach.Geometry); err != nil {
+			return err
+		}
+
+		if err = update.ApplyToBeach(&beach, true); err != nil {
+			return err
+		}
+
+		return cs.db.CreateBeach(beach)
+	} else if typeName == diwise.ExerciseTrailTypeName && strings.HasPrefix(entityID, diwise.ExerciseTrailIDPrefix) {
+		trail := domain.ExerciseTrail{ID: strings.TrimPrefix(entityID, diwise.ExerciseTrailIDPrefix), Status: status}
+
+		if location.Value.Type != "LineString" || json.Unmarshal(location.Value.Coordinates, &trail.Geometry.Lines) != nil {
+			return fmt.Errorf("%w: the location of an exercise trail must be a LineString", errBadRequestData)
+		}
+
+		if err = update.ApplyToTrail(&trail, true); err != nil {
+			return err
+		}
+
+		return cs.db.CreateTrail(trail)
+	}
+
+	return fmt.Errorf("%w: only beaches and exercise trails can be created", errOperationNotSupported)
+}
+
+//decodeBeachGeometry accepts either a Polygon or a MultiPolygon as the location of a beach
+func decodeBeachGeometry(location geoProperty, geometry *domain.MultiPolygon) error {
+	if location.Value.Type == "MultiPolygon" {
+		if json.Unmarshal(location.Value.Coordinates, &geometry.Lines) == nil {
+			return nil
+		}
+	} else if location.Value.Type == "Polygon" {
+		polygon := [][][]float64{}
+		if json.Unmarshal(location.Value.Coordinates, &polygon) == nil {
+			geometry.Lines = [][][][]float64{polygon}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: the location of a beach must be a Polygon or a MultiPolygon", errBadRequestData)
+}
+
+//deleteEntity removes a locally managed beach or exercise trail
+func (cs *contextSource) deleteEntity(entityID string) error {
+	typeName, err := cs.GetProvidedTypeFromID(entityID)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errEntityNotFound, entityID)
+	}
+
+	if _, err = cs.retrieveEntity(entityID); err != nil {
+		return fmt.Errorf("%w: %s", errEntityNotFound, entityID)
+	}
+
+	if typeName == fiware.BeachTypeName {
+		err = cs.db.DeleteBeach(strings.TrimPrefix(entityID, fiware.BeachIDPrefix))
+	} else if typeName == diwise.ExerciseTrailTypeName {
+		err = cs.db.DeleteTrail(strings.TrimPrefix(entityID, diwise.ExerciseTrailIDPrefix))
+	} else {
+		return fmt.Errorf("%w: only beaches and exercise trails can be deleted", errOperationNotSupported)
+	}
+
+	if errors.Is(err, database.ErrNotLocallyManaged) {
+		return fmt.Errorf("%w: %s is loaded from the facility source and can not be deleted", errOperationNotSupported, entityID)
+	}
+
+	return err
+}
+
+//newDeleteEntityHandler returns a handler that deletes locally managed entities
+func newDeleteEntityHandler(cs *contextSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entityID, _ := url.QueryUnescape(chi.URLParam(r, "entity"))
+
+		err := cs.deleteEntity(entityID)
+		if err != nil {
+			problem := newProblemDetails(err)
+			writeProblemDetails(w, problemStatusCode(problem), problem)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
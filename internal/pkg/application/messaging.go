@@ -2,43 +2,112 @@ package application
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
 	"time"
 
 	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/deadletter"
 	"github.com/diwise/messaging-golang/pkg/messaging"
 	"github.com/diwise/messaging-golang/pkg/messaging/telemetry"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/rs/zerolog"
 )
 
-func CreateWaterTempReceiver(db database.Datastore) messaging.TopicMessageHandler {
-	return func(msg amqp.Delivery, logger zerolog.Logger) {
+//WaterTemperatureProcessor applies water temperature telemetry to beaches. Messages that can not be
+//applied are kept in a dead letter store, from where they can be replayed.
+type WaterTemperatureProcessor struct {
+	db          database.Datastore
+	validator   *waterTemperatureValidator
+	deadLetters deadletter.Store
+}
 
-		logger.Info().Str("body", string(msg.Body)).Msg("message received from queue")
+//errDiscarded marks messages that are intentionally not applied, and should not be dead lettered
+var errDiscarded error = errors.New("discarded")
+
+//NewWaterTemperatureProcessor creates a processor that updates beaches in the datastore
+func NewWaterTemperatureProcessor(db database.Datastore, deadLetters deadletter.Store) *WaterTemperatureProcessor {
+	return &WaterTemperatureProcessor{
+		db:          db,
+		validator:   newWaterTemperatureValidator(),
+		deadLetters: deadLetters,
+	}
+}
 
-		telTemp := &telemetry.WaterTemperature{}
-		err := json.Unmarshal(msg.Body, telTemp)
+func (p *WaterTemperatureProcessor) topic() string {
+	return (&telemetry.WaterTemperature{}).TopicName()
+}
 
-		if err != nil {
-			logger.Error().Err(err).Msg("Failed to unmarshal message")
-			return
+//process applies a water temperature message and returns the reason if it was rejected
+func (p *WaterTemperatureProcessor) process(body []byte, logger zerolog.Logger) error {
+	telTemp := &telemetry.WaterTemperature{}
+	err := json.Unmarshal(body, telTemp)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal message: %s", err.Error())
+	}
+
+	if telTemp.Timestamp == "" {
+		return fmt.Errorf("water temperature message has an empty timestamp")
+	}
+
+	device := telTemp.Origin.Device
+	temp := float64(math.Round(telTemp.Temp*10) / 10)
+	observedAt, err := time.Parse(time.RFC3339, telTemp.Timestamp)
+	if err != nil {
+		return fmt.Errorf("water temperature message has an invalid timestamp: %s", err.Error())
+	}
+
+	if err = p.validator.check(device, temp, observedAt); err != nil {
+		return err
+	}
+
+	poi, err := p.db.UpdateWaterTemperatureFromDeviceID(device, temp, observedAt)
+	if err != nil {
+		if errors.Is(err, database.ErrUnknownDevice) {
+			return err
 		}
 
-		if telTemp.Timestamp == "" {
-			logger.Info().Msgf("Ignored water temperature message with an empty timestamp.")
+		logger.Info().Err(err).Msg("temperature update was ignored")
+		return errDiscarded
+	}
+
+	p.validator.accept(device, temp, observedAt)
+	logger.Info().Msgf("updated water temperature at %s to %f degrees", poi, temp)
+
+	return nil
+}
+
+//Replay processes a dead lettered message again, and removes it from the store if it succeeds
+func (p *WaterTemperatureProcessor) Replay(id string, logger zerolog.Logger) error {
+	msg, err := p.deadLetters.Get(id)
+	if err != nil {
+		return err
+	}
+
+	err = p.process(msg.Body, logger)
+	if err != nil && err != errDiscarded {
+		p.deadLetters.RecordFailure(id, err.Error())
+		return err
+	}
+
+	return p.deadLetters.Remove(id)
+}
+
+func CreateWaterTempReceiver(p *WaterTemperatureProcessor) messaging.TopicMessageHandler {
+	return func(msg amqp.Delivery, logger zerolog.Logger) {
+
+		logger.Info().Str("body", string(msg.Body)).Msg("message received from queue")
+
+		err := p.process(msg.Body, logger)
+		if err == nil || err == errDiscarded {
 			return
 		}
 
-		device := telTemp.Origin.Device
-		temp := float64(math.Round(telTemp.Temp*10) / 10)
-		observedAt, _ := time.Parse(time.RFC3339, telTemp.Timestamp)
+		logger.Error().Err(err).Msg("moving rejected water temperature message to dead letters")
 
-		poi, err := db.UpdateWaterTemperatureFromDeviceID(device, temp, observedAt)
-		if err == nil {
-			logger.Info().Msgf("updated water temperature at %s to %f degrees", poi, temp)
-		} else {
-			logger.Error().Err(err).Msg("temperature update was ignored")
+		if _, err = p.deadLetters.Add(p.topic(), msg.Body, err.Error()); err != nil {
+			logger.Error().Err(err).Msg("failed to store dead letter")
 		}
 	}
 }
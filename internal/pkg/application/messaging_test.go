@@ -0,0 +1,61 @@
+package application
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/deadletter"
+	"github.com/matryer/is"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/rs/zerolog"
+)
+
+const beachWithoutSensor string = `{"type":"FeatureCollection","features":[
+	{"id":1545,"type":"Feature",
+	"properties":{"name":"Lillsjöns vinterbad","type":"Strandbad","created":"2020-06-04 14:26:58","updated":"2020-12-02 08:46:56","published":true,"fields":[]},
+	"geometry":{"type":"MultiPolygon","coordinates":[[[[17.47,62.43],[17.48,62.43],[17.48,62.44],[17.47,62.43]]]]}}
+]}`
+
+func TestThatDeadLetteredReadingsAreAppliedWhenReplayedAfterAssigningTheDevice(t *testing.T) {
+	is := is.New(t)
+	logger := zerolog.New(ioutil.Discard)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(beachWithoutSensor))
+	}))
+	defer server.Close()
+
+	db, err := database.NewDatabaseConnection(server.URL, "apikey", logger)
+	is.NoErr(err)
+
+	deadLetters, err := deadletter.NewStore("", deadletter.DefaultCapacity)
+	is.NoErr(err)
+
+	wtp := NewWaterTemperatureProcessor(db, deadLetters)
+	receive := CreateWaterTempReceiver(wtp)
+
+	observedAt := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	body := fmt.Sprintf(`{"origin":{"device":"sensor-new"},"timestamp":"%s","temp":18.5}`, observedAt)
+	receive(amqp.Delivery{Body: []byte(body)}, logger)
+
+	messages, _ := deadLetters.List()
+	is.Equal(len(messages), 1) // the reading from an unknown device should be dead lettered
+
+	beachID := database.SundsvallAnlaggningPrefix + "1545"
+	is.NoErr(db.AssignDeviceToBeach(domain.DeviceAssignment{DeviceID: "sensor-new", BeachID: beachID}))
+	is.NoErr(wtp.Replay(messages[0].ID, logger))
+
+	beach, err := db.GetBeachFromID(beachID)
+	is.NoErr(err)
+	is.True(beach.WaterTemperature != nil) // the replayed reading should be applied
+	is.Equal(*beach.WaterTemperature, 18.5)
+
+	messages, _ = deadLetters.List()
+	is.Equal(len(messages), 0)
+}
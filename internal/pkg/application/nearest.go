@@ -0,0 +1,268 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/diwise"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/fiware"
+)
+
+type nearbyResult struct {
+	ID       string  `json:"id"`
+	Type     string  `json:"type"`
+	Name     string  `json:"name"`
+	Distance float64 `json:"distance"`
+}
+
+//nearbyFilter contains the optional criteria that points of interest must meet to be included
+type nearbyFilter struct {
+	types               []string
+	status              string
+	category            string
+	minWaterTemperature *float64
+	maxWaterTemperature *float64
+	maxDistance         float64
+}
+
+//includesType reports if the type is requested and has the attributes needed to evaluate the filter
+func (f nearbyFilter) includesType(typeName string) bool {
+	if len(f.types) > 0 && !contains(f.types, typeName) {
+		return false
+	}
+
+	if f.hasWaterTemperatureCriteria() && typeName != fiware.BeachTypeName {
+		return false
+	}
+
+	if f.status != "" && typeName != diwise.ExerciseTrailTypeName {
+		return false
+	}
+
+	if f.category != "" && typeName != diwise.ExerciseTrailTypeName && typeName != SportsFieldTypeName {
+		return false
+	}
+
+	return true
+}
+
+func (f nearbyFilter) hasWaterTemperatureCriteria() bool {
+	return f.minWaterTemperature != nil || f.maxWaterTemperature != nil
+}
+
+func (f nearbyFilter) includesWaterTemperature(temp *float64) bool {
+	if !f.hasWaterTemperatureCriteria() {
+		return true
+	}
+
+	return temp != nil &&
+		(f.minWaterTemperature == nil || *temp >= *f.minWaterTemperature) &&
+		(f.maxWaterTemperature == nil || *temp <= *f.maxWaterTemperature)
+}
+
+func (f nearbyFilter) includesCategories(categories []string) bool {
+	return f.category == "" || contains(categories, f.category)
+}
+
+//newNearestHandler returns a handler that lists points of interest ordered by the distance from the
+//position in the lat and lon parameters to the nearest point of their geometries
+func newNearestHandler(db database.Datastore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+
+		lat, latErr := strconv.ParseFloat(params.Get("lat"), 64)
+		lon, lonErr := strconv.ParseFloat(params.Get("lon"), 64)
+		if latErr != nil || lonErr != nil || math.Abs(lat) > 90 || math.Abs(lon) > 180 {
+			http.Error(w, "lat and lon must be valid WGS84 coordinates", http.StatusBadRequest)
+			return
+		}
+
+		filter, err := parseNearbyFilter(params.Get)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		limit := 10
+		if l := params.Get("limit"); l != "" {
+			limit, err = strconv.Atoi(l)
+			if err != nil || limit <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+		}
+
+		results, err := findNearby(db, domain.Point{Coordinates: []float64{lon, lat}}, filter)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if len(results) > limit {
+			results = results[:limit]
+		}
+
+		body, err := json.Marshal(results)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
+
+func parseNearbyFilter(param func(string) string) (nearbyFilter, error) {
+	filter := nearbyFilter{
+		status:   param("status"),
+		category: param("category"),
+	}
+
+	if t := param("type"); t != "" {
+		filter.types = strings.Split(t, ",")
+	}
+
+	parseOptionalFloat := func(name string) (*float64, error) {
+		value := param(name)
+		if value == "" {
+			return nil, nil
+		}
+
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for parameter %s", name)
+		}
+
+		return &f, nil
+	}
+
+	var err error
+
+	if filter.minWaterTemperature, err = parseOptionalFloat("minWaterTemperature"); err != nil {
+		return filter, err
+	}
+
+	if filter.maxWaterTemperature, err = parseOptionalFloat("maxWaterTemperature"); err != nil {
+		return filter, err
+	}
+
+	maxDistance, err := parseOptionalFloat("maxDistance")
+	if err != nil {
+		return filter, err
+	}
+
+	if maxDistance != nil {
+		filter.maxDistance = *maxDistance
+	}
+
+	return filter, nil
+}
+
+func findNearby(db database.Datastore, p domain.Point, filter nearbyFilter) ([]nearbyResult, error) {
+	results := []nearbyResult{}
+
+	add := func(id, typeName, name string, distance float64) {
+		//entities without a geometry have no distance and can not be near anything
+		if math.IsInf(distance, 0) || math.IsNaN(distance) {
+			return
+		}
+
+		if filter.maxDistance > 0 && distance > filter.maxDistance {
+			return
+		}
+
+		results = append(results, nearbyResult{ID: id, Type: typeName, Name: name, Distance: math.Round(distance)})
+	}
+
+	if filter.includesType(fiware.BeachTypeName) {
+		beaches, err := db.GetAllBeaches()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, b := range beaches {
+			if filter.includesWaterTemperature(b.WaterTemperature) {
+				add(fiware.BeachIDPrefix+b.ID, fiware.BeachTypeName, b.Name, b.Geometry.DistanceTo(p))
+			}
+		}
+	}
+
+	if filter.includesType(diwise.ExerciseTrailTypeName) {
+		trails, err := db.GetAllTrails()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range trails {
+			if (filter.status != "" && t.Status != filter.status) || !filter.includesCategories(t.Category) {
+				continue
+			}
+
+			add(diwise.ExerciseTrailIDPrefix+t.ID, diwise.ExerciseTrailTypeName, t.Name, t.Geometry.DistanceTo(p))
+		}
+	}
+
+	if filter.includesType(SportsFieldTypeName) {
+		sportsFields, err := db.GetAllSportsFields()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, sf := range sportsFields {
+			if filter.includesCategories(sf.Category) {
+				add(SportsFieldIDPrefix+sf.ID, SportsFieldTypeName, sf.Name, sf.Location.DistanceTo(p))
+			}
+		}
+	}
+
+	if filter.includesType(FireplaceTypeName) {
+		fireplaces, err := db.GetAllFireplaces()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range fireplaces {
+			add(FireplaceIDPrefix+f.ID, FireplaceTypeName, f.Name, f.Location.DistanceTo(p))
+		}
+	}
+
+	if filter.includesType(OutdoorGymTypeName) {
+		gyms, err := db.GetAllOutdoorGyms()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, g := range gyms {
+			add(OutdoorGymIDPrefix+g.ID, OutdoorGymTypeName, g.Name, g.Location.DistanceTo(p))
+		}
+	}
+
+	if filter.includesType(PlaygroundTypeName) {
+		playgrounds, err := db.GetAllPlaygrounds()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pg := range playgrounds {
+			add(PlaygroundIDPrefix+pg.ID, PlaygroundTypeName, pg.Name, pg.Location.DistanceTo(p))
+		}
+	}
+
+	return sortByDistance(results), nil
+}
+
+func sortByDistance(results []nearbyResult) []nearbyResult {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Distance < results[j].Distance
+	})
+	return results
+}
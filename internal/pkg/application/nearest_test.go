@@ -0,0 +1,42 @@
+package application
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/diwise"
+	"github.com/matryer/is"
+	"github.com/rs/zerolog"
+)
+
+const trailsWithAndWithoutGeometry string = `{"type":"FeatureCollection","features":[
+	{"id":701,"type":"Feature",
+	"properties":{"name":"Spåret","type":"Motionsspår","created":"2019-04-05 12:39:34","updated":"2021-12-11 08:14:31","published":true,"fields":[]},
+	"geometry":{"type":"LineString","coordinates":[[17.308,62.391],[17.310,62.392]]}},
+	{"id":702,"type":"Feature",
+	"properties":{"name":"Spåret utan geometri","type":"Motionsspår","created":"2019-04-05 12:39:34","updated":"2021-12-11 08:14:31","published":true,"fields":[]},
+	"geometry":{"type":"LineString","coordinates":[]}}
+]}`
+
+func TestThatEntitiesWithoutGeometryAreNotNearby(t *testing.T) {
+	is := is.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(trailsWithAndWithoutGeometry))
+	}))
+	defer server.Close()
+
+	db, err := database.NewDatabaseConnection(server.URL, "apikey", zerolog.New(ioutil.Discard))
+	is.NoErr(err)
+
+	p := domain.Point{Coordinates: []float64{17.309, 62.391}}
+	results, err := findNearby(db, p, nearbyFilter{types: []string{diwise.ExerciseTrailTypeName}})
+	is.NoErr(err)
+
+	is.Equal(len(results), 1) // the trail without a geometry should be skipped
+	is.Equal(results[0].ID, diwise.ExerciseTrailIDPrefix+database.SundsvallAnlaggningPrefix+"701")
+}
@@ -0,0 +1,238 @@
+package application
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/diwise"
+)
+
+type geoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+type trailJunction struct {
+	ID       string          `json:"id"`
+	Location geoJSONGeometry `json:"location"`
+	Trails   []string        `json:"trails"`
+}
+
+type trailSegment struct {
+	ID       string          `json:"id"`
+	From     string          `json:"from,omitempty"`
+	To       string          `json:"to,omitempty"`
+	Trails   []string        `json:"trails"`
+	Length   float64         `json:"length"`
+	Geometry geoJSONGeometry `json:"geometry"`
+}
+
+type trailNetwork struct {
+	Junctions   []trailJunction     `json:"junctions"`
+	Segments    []trailSegment      `json:"segments"`
+	Connections map[string][]string `json:"connections"`
+}
+
+type routeSuggestion struct {
+	Trails []string `json:"trails"`
+	Length float64  `json:"length"`
+}
+
+func trailEntityIDs(trailIDs []string) []string {
+	entityIDs := make([]string, 0, len(trailIDs))
+	for _, id := range trailIDs {
+		entityIDs = append(entityIDs, diwise.ExerciseTrailIDPrefix+id)
+	}
+	return entityIDs
+}
+
+func buildTrailNetwork(db database.Datastore) ([]domain.ExerciseTrail, *domain.TrailNetwork, error) {
+	trails, err := db.GetAllTrails()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return trails, domain.NewTrailNetwork(trails), nil
+}
+
+//newTrailNetworkHandler returns a handler that describes the junctions and shared segments of
+//the exercise trails, together with which trails connect to each other
+func newTrailNetworkHandler(db database.Datastore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		trails, network, err := buildTrailNetwork(db)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		response := trailNetwork{
+			Junctions:   []trailJunction{},
+			Segments:    []trailSegment{},
+			Connections: map[string][]string{},
+		}
+
+		for _, j := range network.Junctions {
+			response.Junctions = append(response.Junctions, trailJunction{
+				ID:       j.ID,
+				Location: geoJSONGeometry{Type: "Point", Coordinates: j.Location.Coordinates},
+				Trails:   trailEntityIDs(j.Trails),
+			})
+		}
+
+		for _, s := range network.Segments {
+			response.Segments = append(response.Segments, trailSegment{
+				ID:       s.ID,
+				From:     s.From,
+				To:       s.To,
+				Trails:   trailEntityIDs(s.Trails),
+				Length:   math.Round(s.Length*1000) / 1000,
+				Geometry: geoJSONGeometry{Type: "LineString", Coordinates: s.Geometry.Lines},
+			})
+		}
+
+		for _, t := range trails {
+			response.Connections[diwise.ExerciseTrailIDPrefix+t.ID] = trailEntityIDs(network.ConnectedTrails(t.ID))
+		}
+
+		body, err := json.Marshal(response)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
+
+//newTrailRoutesHandler returns a handler that suggests combinations of connected loops with a
+//total length close to the length in km given in the length parameter
+func newTrailRoutesHandler(db database.Datastore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+
+		length, err := strconv.ParseFloat(params.Get("length"), 64)
+		if err != nil || length <= 0 {
+			http.Error(w, "length must be a positive number of km", http.StatusBadRequest)
+			return
+		}
+
+		limit := 5
+		if l := params.Get("limit"); l != "" {
+			limit, err = strconv.Atoi(l)
+			if err != nil || limit <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+		}
+
+		start := ""
+		if s := params.Get("start"); s != "" {
+			if !strings.HasPrefix(s, diwise.ExerciseTrailIDPrefix) {
+				http.Error(w, "start must be the id of an exercise trail", http.StatusBadRequest)
+				return
+			}
+			start = strings.TrimPrefix(s, diwise.ExerciseTrailIDPrefix)
+
+			if _, err := db.GetTrailFromID(start); err != nil {
+				http.Error(w, "no exercise trail found with id "+s, http.StatusNotFound)
+				return
+			}
+		}
+
+		_, network, err := buildTrailNetwork(db)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		suggestions := []routeSuggestion{}
+		for _, s := range network.SuggestLoops(start, length, limit) {
+			suggestions = append(suggestions, routeSuggestion{
+				Trails: trailEntityIDs(s.Trails),
+				Length: math.Round(s.Length*1000) / 1000,
+			})
+		}
+
+		body, err := json.Marshal(suggestions)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
+
+type elevationSample struct {
+	Distance  float64 `json:"distance"`
+	Elevation float64 `json:"elevation"`
+}
+
+type elevationProfile struct {
+	ID           string            `json:"id"`
+	TotalAscent  float64           `json:"totalAscent"`
+	TotalDescent float64           `json:"totalDescent"`
+	MaxGradient  float64           `json:"maxGradient"`
+	MinElevation float64           `json:"minElevation"`
+	MaxElevation float64           `json:"maxElevation"`
+	Profile      []elevationSample `json:"profile"`
+}
+
+//newTrailElevationProfileHandler returns a handler that lists the elevation in metres at regular
+//distances along a trail, together with its ascent, descent and steepest gradient in percent
+func newTrailElevationProfileHandler(db database.Datastore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		trailID, ok := trailIDFromRequest(r)
+		if !ok {
+			http.Error(w, "elevation profiles are only available for exercise trails", http.StatusNotFound)
+			return
+		}
+
+		trail, err := db.GetTrailFromID(trailID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		if trail.Elevation == nil {
+			http.Error(w, "no elevation profile available for "+diwise.ExerciseTrailIDPrefix+trailID, http.StatusNotFound)
+			return
+		}
+
+		response := elevationProfile{
+			ID:           diwise.ExerciseTrailIDPrefix + trail.ID,
+			TotalAscent:  math.Round(trail.Elevation.TotalAscent*10) / 10,
+			TotalDescent: math.Round(trail.Elevation.TotalDescent*10) / 10,
+			MaxGradient:  math.Round(trail.Elevation.MaxGradient*10) / 10,
+			MinElevation: math.Round(trail.Elevation.MinElevation*10) / 10,
+			MaxElevation: math.Round(trail.Elevation.MaxElevation*10) / 10,
+			Profile:      []elevationSample{},
+		}
+
+		for _, s := range trail.Elevation.Samples {
+			response.Profile = append(response.Profile, elevationSample{
+				Distance:  math.Round(s.Distance),
+				Elevation: math.Round(s.Elevation*10) / 10,
+			})
+		}
+
+		body, err := json.Marshal(response)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
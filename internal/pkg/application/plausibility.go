@@ -0,0 +1,68 @@
+package application
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	//MinPlausibleWaterTemperature is the lowest water temperature that is accepted from a sensor
+	MinPlausibleWaterTemperature float64 = -2.0
+	//MaxPlausibleWaterTemperature is the highest water temperature that is accepted from a sensor
+	MaxPlausibleWaterTemperature float64 = 35.0
+	//MaxWaterTemperatureJump is the change that is always accepted between two observations
+	MaxWaterTemperatureJump float64 = 3.0
+	//MaxWaterTemperatureChangePerHour is the additional change that is accepted for each hour between two observations
+	MaxWaterTemperatureChangePerHour float64 = 0.5
+)
+
+type temperatureObservation struct {
+	value      float64
+	observedAt time.Time
+}
+
+//waterTemperatureValidator rejects water temperatures that are out of range, or that differ too much
+//from the latest accepted observation from the same device
+type waterTemperatureValidator struct {
+	mu     sync.Mutex
+	latest map[string]temperatureObservation
+}
+
+func newWaterTemperatureValidator() *waterTemperatureValidator {
+	return &waterTemperatureValidator{latest: map[string]temperatureObservation{}}
+}
+
+func (v *waterTemperatureValidator) check(device string, temp float64, observedAt time.Time) error {
+	if math.IsNaN(temp) || temp < MinPlausibleWaterTemperature || temp > MaxPlausibleWaterTemperature {
+		return fmt.Errorf("water temperature %.1f from %s is outside of the plausible range", temp, device)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if latest, ok := v.latest[device]; ok && observedAt.After(latest.observedAt) {
+		hours := observedAt.Sub(latest.observedAt).Hours()
+		allowedChange := MaxWaterTemperatureJump + hours*MaxWaterTemperatureChangePerHour
+
+		if math.Abs(temp-latest.value) > allowedChange {
+			return fmt.Errorf(
+				"water temperature from %s changed from %.1f to %.1f in %.1f hours",
+				device, latest.value, temp, hours,
+			)
+		}
+	}
+
+	return nil
+}
+
+//accept records an observation as the latest from a device
+func (v *waterTemperatureValidator) accept(device string, temp float64, observedAt time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if latest, ok := v.latest[device]; !ok || observedAt.After(latest.observedAt) {
+		v.latest[device] = temperatureObservation{value: temp, observedAt: observedAt}
+	}
+}
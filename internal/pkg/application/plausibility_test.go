@@ -0,0 +1,57 @@
+package application
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestWaterTemperatureValidator(t *testing.T) {
+	latest := time.Date(2022, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		temp       float64
+		observedAt time.Time
+		accepted   bool
+	}{
+		{"below the plausible range", MinPlausibleWaterTemperature - 0.1, latest.Add(time.Hour), false},
+		{"above the plausible range", MaxPlausibleWaterTemperature + 0.1, latest.Add(time.Hour), false},
+		{"not a number", math.NaN(), latest.Add(time.Hour), false},
+		{"jump within the limit", 15.0 + MaxWaterTemperatureJump, latest.Add(time.Minute), true},
+		{"jump beyond the limit", 15.0 + MaxWaterTemperatureJump + 0.1, latest.Add(time.Minute), false},
+		{"drop within the limit", 15.0 - MaxWaterTemperatureJump, latest.Add(time.Minute), true},
+		{"drop beyond the limit", 15.0 - MaxWaterTemperatureJump - 0.1, latest.Add(time.Minute), false},
+		{"change within the limit after hours", 15.0 + MaxWaterTemperatureJump + 4*MaxWaterTemperatureChangePerHour, latest.Add(4 * time.Hour), true},
+		{"change beyond the limit after hours", 15.0 + MaxWaterTemperatureJump + 4*MaxWaterTemperatureChangePerHour + 0.1, latest.Add(4 * time.Hour), false},
+		{"out of order observation", 25.0, latest.Add(-time.Hour), true},
+		{"out of order observation out of range", MaxPlausibleWaterTemperature + 1, latest.Add(-time.Hour), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t)
+
+			v := newWaterTemperatureValidator()
+			v.accept("sensor", 15.0, latest)
+
+			err := v.check("sensor", test.temp, test.observedAt)
+			is.Equal(err == nil, test.accepted)
+		})
+	}
+}
+
+func TestThatOutOfOrderObservationsDoNotReplaceTheLatest(t *testing.T) {
+	is := is.New(t)
+
+	latest := time.Date(2022, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	v := newWaterTemperatureValidator()
+	v.accept("sensor", 15.0, latest)
+	v.accept("sensor", 25.0, latest.Add(-time.Hour))
+
+	is.NoErr(v.check("sensor", 15.5, latest.Add(time.Minute)))       // compared to the latest observation
+	is.True(v.check("sensor", 25.0, latest.Add(time.Minute)) != nil) // and not to the older one
+}
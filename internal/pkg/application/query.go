@@ -0,0 +1,188 @@
+package application
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	ngsi "github.com/diwise/ngsi-ld-golang/pkg/ngsi-ld"
+)
+
+//queryTerm is a single comparison in the NGSI-LD query language, such as difficulty=="easy","medium"
+type queryTerm struct {
+	attribute string
+	operator  string
+	values    []string
+}
+
+//queryFilter holds a parsed q parameter. Terms joined by ; must all match, and the groups
+//separated by | are alternatives. Parentheses are not supported.
+type queryFilter struct {
+	alternatives [][]queryTerm
+}
+
+var queryOperators []string = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+func newQueryFilter(query ngsi.Query) (*queryFilter, error) {
+	if query == nil || query.Request() == nil {
+		return &queryFilter{}, nil
+	}
+
+	return parseQueryFilter(query.Request().URL.Query().Get("q"))
+}
+
+func parseQueryFilter(q string) (*queryFilter, error) {
+	filter := &queryFilter{}
+
+	if strings.TrimSpace(q) == "" {
+		return filter, nil
+	}
+
+	if strings.ContainsAny(q, "()") {
+		return nil, fmt.Errorf("parentheses are not supported in q")
+	}
+
+	for _, alternative := range strings.Split(q, "|") {
+		terms := []queryTerm{}
+
+		for _, expression := range strings.Split(alternative, ";") {
+			term, err := parseQueryTerm(strings.TrimSpace(expression))
+			if err != nil {
+				return nil, err
+			}
+			terms = append(terms, term)
+		}
+
+		filter.alternatives = append(filter.alternatives, terms)
+	}
+
+	return filter, nil
+}
+
+func parseQueryTerm(expression string) (queryTerm, error) {
+	for idx := range expression {
+		for _, op := range queryOperators {
+			if !strings.HasPrefix(expression[idx:], op) {
+				continue
+			}
+
+			term := queryTerm{
+				attribute: strings.TrimSpace(expression[:idx]),
+				operator:  op,
+			}
+
+			for _, value := range strings.Split(expression[idx+len(op):], ",") {
+				term.values = append(term.values, strings.Trim(strings.TrimSpace(value), "\""))
+			}
+
+			if term.attribute == "" || (len(term.values) > 1 && op != "==" && op != "!=") {
+				return term, fmt.Errorf("invalid query term %q", expression)
+			}
+
+			return term, nil
+		}
+	}
+
+	return queryTerm{}, fmt.Errorf("query term %q has no comparison operator", expression)
+}
+
+//matches reports if the attributes of an entity, given as strings, numbers, booleans or lists of strings, satisfy the filter.
+//Entities that lack an attribute in a term do not satisfy that term.
+func (f *queryFilter) matches(attributes map[string]interface{}) bool {
+	if len(f.alternatives) == 0 {
+		return true
+	}
+
+	for _, terms := range f.alternatives {
+		allMatch := true
+
+		for _, term := range terms {
+			value, ok := attributes[term.attribute]
+			if !ok || !term.matches(value) {
+				allMatch = false
+				break
+			}
+		}
+
+		if allMatch {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t queryTerm) matches(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return t.compare(v)
+	case []string:
+		anyMatch := false
+		for _, item := range v {
+			anyMatch = anyMatch || t.compareEqual(item)
+		}
+		if t.operator == "!=" {
+			return !anyMatch
+		}
+		return t.operator == "==" && anyMatch
+	case float64:
+		return t.compareNumber(v)
+	case bool:
+		return (t.operator == "==" || t.operator == "!=") && t.compare(strconv.FormatBool(v))
+	}
+
+	return false
+}
+
+func (t queryTerm) compareEqual(value string) bool {
+	return contains(t.values, value)
+}
+
+func (t queryTerm) compare(value string) bool {
+	switch t.operator {
+	case "==":
+		return t.compareEqual(value)
+	case "!=":
+		return !t.compareEqual(value)
+	case ">":
+		return value > t.values[0]
+	case ">=":
+		return value >= t.values[0]
+	case "<":
+		return value < t.values[0]
+	case "<=":
+		return value <= t.values[0]
+	}
+
+	return false
+}
+
+func (t queryTerm) compareNumber(value float64) bool {
+	numbers := []float64{}
+	for _, v := range t.values {
+		number, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return false
+		}
+		numbers = append(numbers, number)
+	}
+
+	switch t.operator {
+	case "==", "!=":
+		equal := false
+		for _, number := range numbers {
+			equal = equal || value == number
+		}
+		return equal == (t.operator == "==")
+	case ">":
+		return value > numbers[0]
+	case ">=":
+		return value >= numbers[0]
+	case "<":
+		return value < numbers[0]
+	case "<=":
+		return value <= numbers[0]
+	}
+
+	return false
+}
@@ -0,0 +1,137 @@
+package application
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	ngsi "github.com/diwise/ngsi-ld-golang/pkg/ngsi-ld"
+	"github.com/matryer/is"
+	"github.com/rs/zerolog"
+)
+
+func TestParseQueryFilter(t *testing.T) {
+	testCases := []struct {
+		q        string
+		expected [][]queryTerm
+		valid    bool
+	}{
+		{"", nil, true},
+		{`difficulty=="easy"`, [][]queryTerm{{{"difficulty", "==", []string{"easy"}}}}, true},
+		{`difficulty=="easy","medium"`, [][]queryTerm{{{"difficulty", "==", []string{"easy", "medium"}}}}, true},
+		{`length>=2.5;status!="closed"`, [][]queryTerm{{{"length", ">=", []string{"2.5"}}, {"status", "!=", []string{"closed"}}}}, true},
+		{`length<3|category=="ski-classic"`, [][]queryTerm{{{"length", "<", []string{"3"}}}, {{"category", "==", []string{"ski-classic"}}}}, true},
+		{`(length<3)`, nil, false},
+		{`difficulty`, nil, false},
+		{`=="easy"`, nil, false},
+		{`length>2,3`, nil, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.q, func(t *testing.T) {
+			is := is.New(t)
+
+			filter, err := parseQueryFilter(tc.q)
+			if !tc.valid {
+				is.True(err != nil) // the query should be rejected
+				return
+			}
+
+			is.NoErr(err)
+			is.Equal(filter.alternatives, tc.expected)
+		})
+	}
+}
+
+func TestQueryFilterMatches(t *testing.T) {
+	attributes := map[string]interface{}{
+		"name":     "Spåret",
+		"length":   2.5,
+		"category": []string{"floodlit", "ski-classic"},
+		"bookable": false,
+	}
+
+	testCases := []struct {
+		q        string
+		expected bool
+	}{
+		{``, true},
+		{`name=="Spåret"`, true},
+		{`name!="Spåret"`, false},
+		{`name=="Slingan","Spåret"`, true},
+		{`length>2`, true},
+		{`length<=2.5;name=="Spåret"`, true},
+		{`length<2`, false},
+		{`length=="2.5"`, true},
+		{`length>"many"`, false},
+		{`category=="ski-classic"`, true},
+		{`category!="ski-classic"`, false},
+		{`category=="ice-skating"`, false},
+		{`category>"a"`, false},
+		{`bookable==false`, true},
+		{`bookable!=false`, false},
+		{`difficulty=="easy"`, false}, // entities that lack an attribute do not match
+		{`difficulty!="easy"`, false},
+		{`difficulty=="easy"|length>2`, true},
+		{`length<2|name=="Slingan"`, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.q, func(t *testing.T) {
+			is := is.New(t)
+
+			filter, err := parseQueryFilter(tc.q)
+			is.NoErr(err)
+			is.Equal(filter.matches(attributes), tc.expected)
+		})
+	}
+}
+
+const beachAndTrail string = `{"type":"FeatureCollection","features":[
+	{"id":1545,"type":"Feature",
+	"properties":{"name":"Stranden","type":"Strandbad","created":"2020-06-04 14:26:58","updated":"2020-12-02 08:46:56","published":true,
+		"fields":[{"id":29,"name":"Sandstrand","type":"TOGGLE","value":"Ja"}]},
+	"geometry":{"type":"MultiPolygon","coordinates":[[[[17.47,62.43],[17.48,62.43],[17.48,62.44],[17.47,62.43]]]]}},
+	{"id":701,"type":"Feature",
+	"properties":{"name":"Spåret","type":"Motionsspår","created":"2019-04-05 12:39:34","updated":"2021-12-11 08:14:31","published":true,
+		"fields":[{"id":109,"name":"Svårighetsgrad","type":"DROPDOWN","value":"Lätt"}]},
+	"geometry":{"type":"LineString","coordinates":[[17.308,62.391],[17.310,62.392]]}}
+]}`
+
+func TestThatTheQueryFilterIsAppliedToAllTypes(t *testing.T) {
+	is := is.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(beachAndTrail))
+	}))
+	defer server.Close()
+
+	db, err := database.NewDatabaseConnection(server.URL, "apikey", zerolog.New(ioutil.Discard))
+	is.NoErr(err)
+
+	cs := newContextSource(db, zerolog.New(ioutil.Discard))
+	query := func(q string) []string {
+		filter, err := parseQueryFilter(q)
+		is.NoErr(err)
+
+		types := []string{}
+		is.NoErr(cs.queryEntities(providedTypes, filter, func(entity ngsi.Entity) error {
+			body, _ := json.Marshal(entity)
+			typeName := struct {
+				Type string `json:"type"`
+			}{}
+			json.Unmarshal(body, &typeName)
+			types = append(types, typeName.Type)
+			return nil
+		}))
+		return types
+	}
+
+	is.Equal(len(query(``)), 2)
+	is.Equal(query(`difficulty=="easy"`), []string{"ExerciseTrail"}) // beaches have no difficulty
+	is.Equal(query(`beachType=="sandy"`), []string{"Beach"})
+	is.Equal(query(`name=="Stranden","Spåret"`), []string{"Beach", "ExerciseTrail"})
+}
@@ -0,0 +1,226 @@
+package application
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	ngsi "github.com/diwise/ngsi-ld-golang/pkg/ngsi-ld"
+)
+
+const (
+	representationNormalized string = "normalized"
+	representationKeyValues  string = "keyValues"
+	representationConcise    string = "concise"
+)
+
+//entityRepresentation describes how entities should be returned to a client. An empty list of
+//attributes means that all attributes are included.
+type entityRepresentation struct {
+	attributes []string
+	format     string
+}
+
+//newEntityRepresentation reads the attrs, options and format parameters of a request. Both the
+//keyValues option and the simplified format give the simplified representation.
+func newEntityRepresentation(params url.Values) entityRepresentation {
+	representation := entityRepresentation{format: representationNormalized}
+
+	for _, attr := range strings.Split(params.Get("attrs"), ",") {
+		if attr = strings.TrimSpace(attr); attr != "" {
+			representation.attributes = append(representation.attributes, attr)
+		}
+	}
+
+	options := strings.Split(params.Get("options"), ",")
+	format := params.Get("format")
+
+	if contains(options, "keyValues") || format == "simplified" || format == "keyValues" {
+		representation.format = representationKeyValues
+	} else if contains(options, "concise") || format == "concise" {
+		representation.format = representationConcise
+	}
+
+	return representation
+}
+
+func (er entityRepresentation) isDefault() bool {
+	return len(er.attributes) == 0 && er.format == representationNormalized
+}
+
+//orderedObject is a json object that keeps the order of its members when marshalled
+type orderedObject struct {
+	keys    []string
+	members map[string]json.RawMessage
+}
+
+func decodeOrderedObject(data []byte) (*orderedObject, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("entity is not a json object")
+	}
+
+	object := &orderedObject{members: map[string]json.RawMessage{}}
+
+	for decoder.More() {
+		token, err = decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		key, _ := token.(string)
+		value := json.RawMessage{}
+
+		if err = decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+
+		if _, exists := object.members[key]; !exists {
+			object.keys = append(object.keys, key)
+		}
+		object.members[key] = value
+	}
+
+	return object, nil
+}
+
+func (o *orderedObject) remove(key string) {
+	if _, ok := o.members[key]; !ok {
+		return
+	}
+
+	delete(o.members, key)
+
+	for idx, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:idx], o.keys[idx+1:]...)
+			break
+		}
+	}
+}
+
+func (o *orderedObject) MarshalJSON() ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	buffer.WriteByte('{')
+
+	for idx, key := range o.keys {
+		if idx > 0 {
+			buffer.WriteByte(',')
+		}
+
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+
+		buffer.Write(name)
+		buffer.WriteByte(':')
+		buffer.Write(o.members[key])
+	}
+
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+//apply returns the entity with only the requested attributes, in the requested representation
+func (er entityRepresentation) apply(entity ngsi.Entity) (ngsi.Entity, error) {
+	if er.isDefault() {
+		return entity, nil
+	}
+
+	body, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := decodeOrderedObject(body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range append([]string{}, object.keys...) {
+		if key == "id" || key == "type" || key == "@context" {
+			continue
+		}
+
+		if len(er.attributes) > 0 && !contains(er.attributes, key) {
+			object.remove(key)
+			continue
+		}
+
+		if er.format == representationKeyValues {
+			object.members[key] = simplifiedAttribute(object.members[key])
+		} else if er.format == representationConcise {
+			object.members[key] = conciseAttribute(object.members[key])
+		}
+	}
+
+	return object, nil
+}
+
+//simplifiedAttribute returns the value of a property or the object of a relationship
+func simplifiedAttribute(attribute json.RawMessage) json.RawMessage {
+	members := map[string]json.RawMessage{}
+	if err := json.Unmarshal(attribute, &members); err != nil {
+		return attribute
+	}
+
+	if value, ok := members["value"]; ok {
+		return value
+	}
+
+	if object, ok := members["object"]; ok {
+		return object
+	}
+
+	return attribute
+}
+
+//conciseAttribute removes the type of an attribute and its sub-attributes, and returns only the value
+//of properties that have no other members
+func conciseAttribute(attribute json.RawMessage) json.RawMessage {
+	object, err := decodeOrderedObject(attribute)
+	if err != nil {
+		return attribute
+	}
+
+	object.remove("type")
+
+	for _, key := range object.keys {
+		if key != "value" && key != "object" && isAttribute(object.members[key]) {
+			object.members[key] = conciseAttribute(object.members[key])
+		}
+	}
+
+	if value, ok := object.members["value"]; ok && len(object.keys) == 1 {
+		return value
+	}
+
+	concise, err := object.MarshalJSON()
+	if err != nil {
+		return attribute
+	}
+
+	return concise
+}
+
+//isAttribute tells properties, geo properties and relationships apart from other json values
+func isAttribute(value json.RawMessage) bool {
+	attribute := struct {
+		Type string `json:"type"`
+	}{}
+
+	if json.Unmarshal(value, &attribute) != nil {
+		return false
+	}
+
+	return attribute.Type == "Property" || attribute.Type == "GeoProperty" || attribute.Type == "Relationship"
+}
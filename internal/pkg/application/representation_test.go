@@ -0,0 +1,56 @@
+package application
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+const representedBeach string = `{"id":"urn:ngsi-ld:Beach:1","type":"Beach",` +
+	`"name":{"type":"Property","value":"Stranden"},` +
+	`"location":{"type":"GeoProperty","value":{"type":"Point","coordinates":[17.3,62.4]}},` +
+	`"refSeeAlso":{"type":"Relationship","object":"urn:ngsi-ld:Device:1"},` +
+	`"waterTemperature":{"type":"Property","value":12.5,"observedAt":"2021-07-01T10:00:00Z","stale":{"type":"Property","value":true}},` +
+	`"@context":["https://schema.lab.fiware.org/ld/context"]}`
+
+func TestEntityRepresentations(t *testing.T) {
+	testCases := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{"normalized", "", representedBeach},
+		{"projection", "attrs=name,waterTemperature",
+			`{"id":"urn:ngsi-ld:Beach:1","type":"Beach","name":{"type":"Property","value":"Stranden"},` +
+				`"waterTemperature":{"type":"Property","value":12.5,"observedAt":"2021-07-01T10:00:00Z","stale":{"type":"Property","value":true}},` +
+				`"@context":["https://schema.lab.fiware.org/ld/context"]}`},
+		{"keyValues", "options=keyValues",
+			`{"id":"urn:ngsi-ld:Beach:1","type":"Beach","name":"Stranden","location":{"type":"Point","coordinates":[17.3,62.4]},` +
+				`"refSeeAlso":"urn:ngsi-ld:Device:1","waterTemperature":12.5,"@context":["https://schema.lab.fiware.org/ld/context"]}`},
+		{"simplified format", "format=simplified&attrs=refSeeAlso",
+			`{"id":"urn:ngsi-ld:Beach:1","type":"Beach","refSeeAlso":"urn:ngsi-ld:Device:1","@context":["https://schema.lab.fiware.org/ld/context"]}`},
+		{"concise", "options=concise",
+			`{"id":"urn:ngsi-ld:Beach:1","type":"Beach","name":"Stranden","location":{"type":"Point","coordinates":[17.3,62.4]},` +
+				`"refSeeAlso":{"object":"urn:ngsi-ld:Device:1"},` +
+				`"waterTemperature":{"value":12.5,"observedAt":"2021-07-01T10:00:00Z","stale":true},` +
+				`"@context":["https://schema.lab.fiware.org/ld/context"]}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			params, err := url.ParseQuery(tc.query)
+			is.NoErr(err)
+
+			entity, err := newEntityRepresentation(params).apply(json.RawMessage(representedBeach))
+			is.NoErr(err)
+
+			body, err := json.Marshal(entity)
+			is.NoErr(err)
+			is.Equal(string(body), tc.expected)
+		})
+	}
+}
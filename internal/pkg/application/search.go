@@ -0,0 +1,170 @@
+package application
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/application/search"
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/diwise"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/fiware"
+)
+
+type searchResult struct {
+	ID    string  `json:"id"`
+	Type  string  `json:"type"`
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+//newSearchHandler returns a handler that ranks points of interest by how well their names
+//and descriptions match the text in the q parameter
+func newSearchHandler(db database.Datastore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("q")
+		if strings.TrimSpace(query) == "" {
+			http.Error(w, "missing search text in parameter q", http.StatusBadRequest)
+			return
+		}
+
+		limit := 20
+		if l := r.URL.Query().Get("limit"); l != "" {
+			var err error
+			limit, err = strconv.Atoi(l)
+			if err != nil || limit <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+		}
+
+		types := []string{}
+		if t := r.URL.Query().Get("type"); t != "" {
+			types = strings.Split(t, ",")
+		}
+
+		documents, err := collectSearchDocuments(db, types)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		results := []searchResult{}
+		for _, result := range search.Rank(query, documents, limit) {
+			results = append(results, searchResult{
+				ID:    result.ID,
+				Type:  result.Type,
+				Name:  result.Name,
+				Score: result.Score,
+			})
+		}
+
+		body, err := json.Marshal(results)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
+
+func collectSearchDocuments(db database.Datastore, types []string) ([]search.Document, error) {
+	includes := func(typeName string) bool {
+		return len(types) == 0 || contains(types, typeName)
+	}
+
+	documents := []search.Document{}
+
+	if includes(fiware.BeachTypeName) {
+		beaches, err := db.GetAllBeaches()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, b := range beaches {
+			documents = append(documents, search.Document{
+				ID: fiware.BeachIDPrefix + b.ID, Type: fiware.BeachTypeName, Name: b.Name, Description: b.Description,
+			})
+		}
+	}
+
+	if includes(diwise.ExerciseTrailTypeName) {
+		trails, err := db.GetAllTrails()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range trails {
+			documents = append(documents, search.Document{
+				ID: diwise.ExerciseTrailIDPrefix + t.ID, Type: diwise.ExerciseTrailTypeName, Name: t.Name, Description: t.Description,
+			})
+		}
+	}
+
+	if includes(FireplaceTypeName) {
+		fireplaces, err := db.GetAllFireplaces()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range fireplaces {
+			documents = append(documents, search.Document{
+				ID: FireplaceIDPrefix + f.ID, Type: FireplaceTypeName, Name: f.Name, Description: f.Description,
+			})
+		}
+	}
+
+	if includes(OutdoorGymTypeName) {
+		gyms, err := db.GetAllOutdoorGyms()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, g := range gyms {
+			documents = append(documents, search.Document{
+				ID: OutdoorGymIDPrefix + g.ID, Type: OutdoorGymTypeName, Name: g.Name, Description: g.Description,
+			})
+		}
+	}
+
+	if includes(PlaygroundTypeName) {
+		playgrounds, err := db.GetAllPlaygrounds()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range playgrounds {
+			documents = append(documents, search.Document{
+				ID: PlaygroundIDPrefix + p.ID, Type: PlaygroundTypeName, Name: p.Name, Description: p.Description,
+			})
+		}
+	}
+
+	if includes(SportsFieldTypeName) {
+		sportsFields, err := db.GetAllSportsFields()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, sf := range sportsFields {
+			documents = append(documents, search.Document{
+				ID: SportsFieldIDPrefix + sf.ID, Type: SportsFieldTypeName, Name: sf.Name, Description: sf.Description,
+			})
+		}
+	}
+
+	return documents, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+//Document is a point of interest that can be searched for
+type Document struct {
+	ID          string
+	Type        string
+	Name        string
+	Description string
+}
+
+//Result is a document that matched a search, along with its relevance
+type Result struct {
+	Document
+	Score float64
+}
+
+var diacritics = strings.NewReplacer(
+	"å", "a", "ä", "a", "á", "a", "à", "a", "â", "a",
+	"ö", "o", "ø", "o", "ó", "o", "ô", "o",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"ü", "u", "ú", "u", "í", "i", "ï", "i",
+)
+
+//Normalize lower cases a text and removes diacritics so that å, ä and ö match a and o
+func Normalize(text string) string {
+	return diacritics.Replace(strings.ToLower(text))
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(Normalize(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+//Rank returns the documents that match all terms in the query, ordered by descending relevance
+func Rank(query string, documents []Document, limit int) []Result {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return []Result{}
+	}
+
+	results := []Result{}
+
+	for _, doc := range documents {
+		nameTokens := tokenize(doc.Name)
+		descriptionTokens := tokenize(doc.Description)
+
+		score := 0.0
+
+		for _, term := range terms {
+			termScore := 2 * bestMatch(term, nameTokens)
+			if termScore == 0 {
+				termScore = bestMatch(term, descriptionTokens)
+			}
+
+			if termScore == 0 {
+				score = 0
+				break
+			}
+
+			score += termScore
+		}
+
+		if score > 0 {
+			if strings.Contains(Normalize(doc.Name), Normalize(query)) {
+				score += 1
+			}
+
+			results = append(results, Result{Document: doc, Score: score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Name < results[j].Name
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
+
+//bestMatch scores how well a search term matches the best of the tokens, from 0 (no match) to 1 (exact match)
+func bestMatch(term string, tokens []string) float64 {
+	best := 0.0
+
+	for _, token := range tokens {
+		score := 0.0
+
+		if token == term {
+			score = 1.0
+		} else if strings.HasPrefix(token, term) {
+			score = 0.9
+		} else if len(term) >= 3 && strings.Contains(token, term) {
+			score = 0.8
+		} else if distance := levenshtein(term, token); distance <= maxTypos(term) {
+			score = 0.7 - 0.1*float64(distance)
+		} else if len(token) > len(term) && levenshtein(term, token[:len(term)]) <= maxTypos(term) {
+			score = 0.5
+		}
+
+		if score > best {
+			best = score
+		}
+	}
+
+	return best
+}
+
+func maxTypos(term string) int {
+	length := len([]rune(term))
+	if length < 4 {
+		return 0
+	}
+	if length < 8 {
+		return 1
+	}
+	return 2
+}
+
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+
+	previous := make([]int, len(t)+1)
+	current := make([]int, len(t)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		current[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(t)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
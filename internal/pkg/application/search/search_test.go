@@ -0,0 +1,45 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+var documents = []Document{
+	{ID: "1", Type: "Beach", Name: "Bredsand", Description: "Populär sandstrand vid Alnösundet"},
+	{ID: "2", Type: "ExerciseTrail", Name: "Hotellslingan 5 km", Description: "Motionsspår med grusbeläggning"},
+	{ID: "3", Type: "Beach", Name: "Östtjärn", Description: "Liten badplats"},
+	{ID: "4", Type: "ExerciseTrail", Name: "Rännösjöspåret", Description: "Skidspår på Rännösjön"},
+}
+
+func TestThatSearchIsCaseAndDiacriticInsensitive(t *testing.T) {
+	is := is.New(t)
+
+	results := Rank("osttjarn", documents, 0)
+	is.Equal(len(results), 1)
+	is.Equal(results[0].ID, "3")
+
+	results = Rank("BREDSAND", documents, 0)
+	is.Equal(len(results), 1)
+	is.Equal(results[0].ID, "1")
+}
+
+func TestThatSearchToleratesTypos(t *testing.T) {
+	is := is.New(t)
+
+	results := Rank("hotelslingan", documents, 0)
+	is.Equal(len(results), 1)
+	is.Equal(results[0].ID, "2")
+}
+
+func TestThatNameMatchesRankAboveDescriptionMatches(t *testing.T) {
+	is := is.New(t)
+
+	results := Rank("rannosjo", documents, 0)
+	is.Equal(len(results), 1) // prefix of the name and the description
+
+	results = Rank("spår", documents, 0)
+	is.Equal(len(results), 2)
+	is.Equal(results[0].ID, "4") // name match should rank above description match
+}
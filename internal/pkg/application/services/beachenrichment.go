@@ -0,0 +1,82 @@
+package services
+
+import (
+	"os"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/rs/zerolog"
+)
+
+type BeachEnrichmentService interface {
+	Shutdown()
+}
+
+//NewBeachEnrichmentService loads beach enrichments from a json file and reloads it whenever the file changes
+func NewBeachEnrichmentService(zlog zerolog.Logger, path string, db database.Datastore) BeachEnrichmentService {
+	bes := &beachEnrichmentServiceImpl{
+		keepRunning: true,
+		path:        path,
+		db:          db,
+		log:         zlog,
+	}
+
+	go bes.run()
+
+	return bes
+}
+
+type beachEnrichmentServiceImpl struct {
+	keepRunning bool
+	path        string
+	lastModTime time.Time
+	db          database.Datastore
+	log         zerolog.Logger
+}
+
+func (bes *beachEnrichmentServiceImpl) run() {
+	bes.reloadIfModified()
+
+	for bes.keepRunning {
+		time.Sleep(30 * time.Second)
+		bes.reloadIfModified()
+	}
+}
+
+func (bes *beachEnrichmentServiceImpl) reloadIfModified() {
+	info, err := os.Stat(bes.path)
+	if err != nil {
+		bes.log.Error().Err(err).Msgf("failed to stat beach enrichment file %s", bes.path)
+		return
+	}
+
+	if !info.ModTime().After(bes.lastModTime) {
+		return
+	}
+
+	data, err := os.ReadFile(bes.path)
+	if err != nil {
+		bes.log.Error().Err(err).Msgf("failed to read beach enrichment file %s", bes.path)
+		return
+	}
+
+	enrichment, err := database.ParseBeachEnrichment(data)
+	if err != nil {
+		bes.log.Error().Err(err).Msgf("ignoring invalid beach enrichment file %s", bes.path)
+		bes.lastModTime = info.ModTime()
+		return
+	}
+
+	err = bes.db.UpdateBeachEnrichment(enrichment)
+	if err != nil {
+		bes.log.Error().Err(err).Msg("failed to update beach enrichment")
+		return
+	}
+
+	bes.lastModTime = info.ModTime()
+	bes.log.Info().Msgf("loaded enrichment for %d beaches from %s", len(enrichment), bes.path)
+}
+
+func (bes *beachEnrichmentServiceImpl) Shutdown() {
+	bes.keepRunning = false
+}
@@ -0,0 +1,116 @@
+package application
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/diwise"
+	"github.com/go-chi/chi/v5"
+)
+
+type dateTimeValue struct {
+	Type  string `json:"@type"`
+	Value string `json:"@value"`
+}
+
+type temporalDateTimeProperty struct {
+	Type       string        `json:"type"`
+	Value      dateTimeValue `json:"value"`
+	ObservedAt string        `json:"observedAt"`
+}
+
+type temporalExerciseTrail struct {
+	ID                  string                     `json:"id"`
+	Type                string                     `json:"type"`
+	DateLastPreparation []temporalDateTimeProperty `json:"dateLastPreparation"`
+	Context             []string                   `json:"@context"`
+}
+
+//newRetrieveTemporalEntityHandler returns a handler that serves the preparation history of a trail
+//using the temporal representation of the NGSI-LD temporal API
+func newRetrieveTemporalEntityHandler(db database.Datastore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entityID, _ := url.QueryUnescape(chi.URLParam(r, "entity"))
+
+		if !strings.HasPrefix(entityID, diwise.ExerciseTrailIDPrefix) {
+			http.Error(w, "temporal history is only available for exercise trails", http.StatusNotFound)
+			return
+		}
+
+		from, to, err := parseTemporalQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		history, err := db.GetTrailPreparationHistory(strings.TrimPrefix(entityID, diwise.ExerciseTrailIDPrefix), from, to)
+		if err != nil {
+			http.Error(w, "no entity found with id "+entityID, http.StatusNotFound)
+			return
+		}
+
+		trail := temporalExerciseTrail{
+			ID:                  entityID,
+			Type:                diwise.ExerciseTrailTypeName,
+			DateLastPreparation: []temporalDateTimeProperty{},
+			Context:             entityContext,
+		}
+
+		for _, preparedAt := range history {
+			timestamp := preparedAt.UTC().Format(time.RFC3339)
+			trail.DateLastPreparation = append(trail.DateLastPreparation, temporalDateTimeProperty{
+				Type:       "Property",
+				Value:      dateTimeValue{Type: "DateTime", Value: timestamp},
+				ObservedAt: timestamp,
+			})
+		}
+
+		body, err := json.Marshal(trail)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/ld+json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
+
+//parseTemporalQuery translates the timerel, timeAt and endTimeAt parameters to a time interval
+//where a zero time means that the interval is open in that direction
+func parseTemporalQuery(params url.Values) (time.Time, time.Time, error) {
+	var from, to time.Time
+
+	timerel := params.Get("timerel")
+	if timerel == "" {
+		return from, to, nil
+	}
+
+	timeAt, err := time.Parse(time.RFC3339, params.Get("timeAt"))
+	if err != nil {
+		return from, to, errors.New("timeAt must be a valid RFC3339 timestamp")
+	}
+
+	switch timerel {
+	case "before":
+		to = timeAt
+	case "after":
+		from = timeAt
+	case "between":
+		endTimeAt, err := time.Parse(time.RFC3339, params.Get("endTimeAt"))
+		if err != nil {
+			return from, to, errors.New("endTimeAt must be a valid RFC3339 timestamp")
+		}
+		from, to = timeAt, endTimeAt
+	default:
+		return from, to, errors.New("timerel must be one of before, after or between")
+	}
+
+	return from, to, nil
+}
@@ -0,0 +1,449 @@
+package application
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	ngsi "github.com/diwise/ngsi-ld-golang/pkg/ngsi-ld"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+)
+
+const (
+	viewportPingInterval time.Duration = 30 * time.Second
+
+	//viewportWriteTimeout is how long a message may take to write before the client is considered unresponsive
+	viewportWriteTimeout time.Duration = 10 * time.Second
+
+	//viewportMaxMessageSize is the largest message that is accepted from a client
+	viewportMaxMessageSize int64 = 64 * 1024
+
+	//maxViewportSubscriptions is the number of subscriptions that a client may have at the same time
+	maxViewportSubscriptions int = 16
+
+	viewportActionSubscribe   string = "subscribe"
+	viewportActionUnsubscribe string = "unsubscribe"
+)
+
+//viewportCommand is a message from a map client. A subscribe command with the id of an existing
+//subscription replaces its bounding box and types, which is how a client follows its viewport.
+type viewportCommand struct {
+	Action string    `json:"action"`
+	ID     string    `json:"id"`
+	BBox   []float64 `json:"bbox,omitempty"`
+	Types  []string  `json:"types,omitempty"`
+}
+
+//viewportMessage is a message to a map client. Entities that enter a viewport are sent in full, while
+//updates only contain the attributes that have changed or been removed since they were last sent.
+type viewportMessage struct {
+	Type         string                     `json:"type"`
+	Subscription string                     `json:"subscription,omitempty"`
+	EntityID     string                     `json:"id,omitempty"`
+	Entity       json.RawMessage            `json:"entity,omitempty"`
+	Changed      map[string]json.RawMessage `json:"changed,omitempty"`
+	Removed      []string                   `json:"removed,omitempty"`
+	Error        string                     `json:"error,omitempty"`
+}
+
+//viewportSubscription tracks the entities inside a bounding box, as they were last sent to the client
+type viewportSubscription struct {
+	id       string
+	bbox     [4]float64
+	types    []string
+	entities map[string]map[string]json.RawMessage
+
+	//since is the last event that is included in the entities that were sent when subscribing
+	since uint64
+}
+
+//viewportClient is a websocket connection from a map client with its subscriptions. All state is
+//handled by the goroutine that runs serve.
+type viewportClient struct {
+	cs            *contextSource
+	ee            *entityEvents
+	conn          *websocket.Conn
+	subscriptions map[string]*viewportSubscription
+	logger        zerolog.Logger
+}
+
+//decodeEntity returns the id, type and attributes of an entity in normalized form
+func decodeEntity(data []byte) (string, string, map[string]json.RawMessage, error) {
+	attributes := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &attributes); err != nil {
+		return "", "", nil, err
+	}
+
+	entityID, entityType := "", ""
+	json.Unmarshal(attributes["id"], &entityID)
+	json.Unmarshal(attributes["type"], &entityType)
+
+	delete(attributes, "id")
+	delete(attributes, "type")
+	delete(attributes, "@context")
+
+	return entityID, entityType, attributes, nil
+}
+
+//geometryBounds returns the bounding box of the coordinates of a GeoJSON geometry
+func geometryBounds(coordinates interface{}, bounds *[4]float64, found bool) bool {
+	items, ok := coordinates.([]interface{})
+	if !ok || len(items) == 0 {
+		return found
+	}
+
+	if lon, ok := items[0].(float64); ok && len(items) >= 2 {
+		lat, ok := items[1].(float64)
+		if !ok {
+			return found
+		}
+
+		if !found {
+			*bounds = [4]float64{lon, lat, lon, lat}
+			return true
+		}
+
+		if lon < bounds[0] {
+			bounds[0] = lon
+		}
+		if lat < bounds[1] {
+			bounds[1] = lat
+		}
+		if lon > bounds[2] {
+			bounds[2] = lon
+		}
+		if lat > bounds[3] {
+			bounds[3] = lat
+		}
+		return true
+	}
+
+	for _, item := range items {
+		found = geometryBounds(item, bounds, found)
+	}
+
+	return found
+}
+
+//intersects reports if the location of an entity overlaps a bounding box
+func (s *viewportSubscription) intersects(attributes map[string]json.RawMessage) bool {
+	location := struct {
+		Value struct {
+			Coordinates interface{} `json:"coordinates"`
+		} `json:"value"`
+	}{}
+
+	if json.Unmarshal(attributes["location"], &location) != nil {
+		return false
+	}
+
+	bounds := [4]float64{}
+	if !geometryBounds(location.Value.Coordinates, &bounds, false) {
+		return false
+	}
+
+	return bounds[0] <= s.bbox[2] && bounds[2] >= s.bbox[0] && bounds[1] <= s.bbox[3] && bounds[3] >= s.bbox[1]
+}
+
+func (c *viewportClient) send(message viewportMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(viewportWriteTimeout))
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+//track sends an entity that is inside a viewport, in full if it is new to the subscription, and
+//otherwise as the difference to what was last sent
+func (c *viewportClient) track(s *viewportSubscription, entityID string, data []byte, attributes map[string]json.RawMessage) error {
+	previous, ok := s.entities[entityID]
+	s.entities[entityID] = attributes
+
+	if !ok {
+		return c.send(viewportMessage{Type: "add", Subscription: s.id, Entity: data})
+	}
+
+	update := viewportMessage{Type: "update", Subscription: s.id, EntityID: entityID, Changed: map[string]json.RawMessage{}}
+
+	for name, value := range attributes {
+		if !bytes.Equal(previous[name], value) {
+			update.Changed[name] = value
+		}
+	}
+
+	for _, name := range sortedAttributeNames(previous) {
+		if _, ok := attributes[name]; !ok {
+			update.Removed = append(update.Removed, name)
+		}
+	}
+
+	if len(update.Changed) == 0 && len(update.Removed) == 0 {
+		return nil
+	}
+
+	return c.send(update)
+}
+
+func (c *viewportClient) untrack(s *viewportSubscription, entityID string) error {
+	if _, ok := s.entities[entityID]; !ok {
+		return nil
+	}
+
+	delete(s.entities, entityID)
+	return c.send(viewportMessage{Type: "remove", Subscription: s.id, EntityID: entityID})
+}
+
+func sortedAttributeNames(attributes map[string]json.RawMessage) []string {
+	names := map[string]bool{}
+	for name := range attributes {
+		names[name] = true
+	}
+	return sortedNames(names)
+}
+
+func (c *viewportClient) subscribe(command viewportCommand) error {
+	if command.ID == "" || len(command.BBox) != 4 || command.BBox[0] > command.BBox[2] || command.BBox[1] > command.BBox[3] {
+		return fmt.Errorf("a subscription needs an id and a bbox of [minLon, minLat, maxLon, maxLat]")
+	}
+
+	types := command.Types
+	if len(types) == 0 {
+		types = providedTypes
+	}
+
+	for _, typeName := range types {
+		if !contains(providedTypes, typeName) {
+			return fmt.Errorf("unknown type %s", typeName)
+		}
+	}
+
+	s, ok := c.subscriptions[command.ID]
+	if !ok {
+		if len(c.subscriptions) >= maxViewportSubscriptions {
+			return fmt.Errorf("a client may have at most %d subscriptions", maxViewportSubscriptions)
+		}
+
+		s = &viewportSubscription{id: command.ID, entities: map[string]map[string]json.RawMessage{}}
+		c.subscriptions[command.ID] = s
+	}
+
+	copy(s.bbox[:], command.BBox)
+	s.types = types
+	s.since = c.ee.currentID()
+
+	if err := c.send(viewportMessage{Type: "subscribed", Subscription: s.id}); err != nil {
+		return err
+	}
+
+	type entityData struct {
+		data       []byte
+		attributes map[string]json.RawMessage
+	}
+
+	inside := map[string]entityData{}
+	ids := []string{}
+
+	err := c.cs.queryEntities(types, &queryFilter{}, func(entity ngsi.Entity) error {
+		data, err := json.Marshal(entity)
+		if err != nil {
+			return err
+		}
+
+		entityID, _, attributes, err := decodeEntity(data)
+		if err == nil && s.intersects(attributes) {
+			inside[entityID] = entityData{data: data, attributes: attributes}
+			ids = append(ids, entityID)
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for entityID := range s.entities {
+		if _, ok := inside[entityID]; !ok {
+			if err = c.untrack(s, entityID); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, entityID := range ids {
+		if err = c.track(s, entityID, inside[entityID].data, inside[entityID].attributes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *viewportClient) handleCommand(message []byte) error {
+	command := viewportCommand{}
+	if err := json.Unmarshal(message, &command); err != nil {
+		return c.send(viewportMessage{Type: "error", Error: "invalid message: " + err.Error()})
+	}
+
+	var err error
+
+	switch command.Action {
+	case viewportActionSubscribe:
+		err = c.subscribe(command)
+	case viewportActionUnsubscribe:
+		if _, ok := c.subscriptions[command.ID]; ok {
+			delete(c.subscriptions, command.ID)
+			return c.send(viewportMessage{Type: "unsubscribed", Subscription: command.ID})
+		}
+		err = fmt.Errorf("no subscription with id %s", command.ID)
+	default:
+		err = fmt.Errorf("unknown action %q", command.Action)
+	}
+
+	if err != nil {
+		return c.send(viewportMessage{Type: "error", Subscription: command.ID, Error: err.Error()})
+	}
+
+	return nil
+}
+
+func (c *viewportClient) handleEvent(event entityEvent) error {
+	for _, s := range c.subscriptions {
+		if event.id <= s.since || !contains(s.types, event.entityType) {
+			continue
+		}
+
+		if event.name == eventNameDelete {
+			if err := c.untrack(s, event.entityID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		_, _, attributes, err := decodeEntity(event.data)
+		if err != nil {
+			continue
+		}
+
+		if s.intersects(attributes) {
+			err = c.track(s, event.entityID, event.data, attributes)
+		} else {
+			err = c.untrack(s, event.entityID)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//serve handles the commands of the client and the changes of the datastore until the connection is
+//closed. Clients that can not keep up with the changes are disconnected.
+func (c *viewportClient) serve() {
+	defer c.conn.Close()
+
+	events := &eventSubscription{events: make(chan entityEvent, eventSubscriberBuffer)}
+	c.ee.subscribe(events, "")
+	defer c.ee.unsubscribe(events)
+
+	commands := make(chan []byte)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(commands)
+		for {
+			_, message, err := c.conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			select {
+			case commands <- message:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(viewportPingInterval)
+	defer ping.Stop()
+
+	for {
+		var err error
+
+		select {
+		case message, ok := <-commands:
+			if !ok {
+				return
+			}
+			err = c.handleCommand(message)
+		case event, ok := <-events.events:
+			if !ok {
+				message := websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "too many pending changes")
+				c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(viewportWriteTimeout))
+				return
+			}
+			err = c.handleEvent(event)
+		case <-ping.C:
+			err = c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(viewportWriteTimeout))
+		}
+
+		if err != nil {
+			c.logger.Debug().Err(err).Msg("closing viewport connection")
+			return
+		}
+	}
+}
+
+//viewportOriginAllowed checks the Origin header that browsers send against the allowed origins, in the
+//same way as CORS. Clients that are not browsers do not send an Origin, and are not restricted.
+func viewportOriginAllowed(allowedOrigins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+
+		for _, allowed := range allowedOrigins {
+			if allowed == "*" || strings.EqualFold(allowed, origin) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+//newViewportHandler returns a handler that upgrades requests to websocket connections, where map
+//clients subscribe to the beaches, exercise trails and other points of interest inside bounding boxes.
+//Browsers may only connect from the origins that are allowed by CORS.
+func newViewportHandler(cs *contextSource, ee *entityEvents, allowedOrigins []string, logger zerolog.Logger) http.HandlerFunc {
+	upgrader := websocket.Upgrader{CheckOrigin: viewportOriginAllowed(allowedOrigins)}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.SetReadLimit(viewportMaxMessageSize)
+
+		client := &viewportClient{
+			cs:            cs,
+			ee:            ee,
+			conn:          conn,
+			subscriptions: map[string]*viewportSubscription{},
+			logger:        logger,
+		}
+
+		client.serve()
+	}
+}
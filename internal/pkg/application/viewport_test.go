@@ -0,0 +1,105 @@
+package application
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/infrastructure/repositories/database"
+	"github.com/diwise/ngsi-ld-golang/pkg/datamodels/diwise"
+	"github.com/gorilla/websocket"
+	"github.com/matryer/is"
+	"github.com/rs/zerolog"
+)
+
+func newViewportTestServer(is *is.I) (*httptest.Server, func()) {
+	logger := zerolog.New(ioutil.Discard)
+
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(trailsWithAndWithoutGeometry))
+	}))
+
+	db, err := database.NewDatabaseConnection(source.URL, "apikey", logger)
+	is.NoErr(err)
+
+	cs := newContextSource(db, logger)
+	server := httptest.NewServer(newViewportHandler(cs, newEntityEvents(cs, logger), []string{"https://karta.sundsvall.se"}, logger))
+
+	return server, func() {
+		server.Close()
+		source.Close()
+	}
+}
+
+func TestThatViewportConnectionsFromOtherOriginsAreRejected(t *testing.T) {
+	is := is.New(t)
+
+	server, closeServer := newViewportTestServer(is)
+	defer closeServer()
+
+	dial := func(origin string) (*websocket.Conn, *http.Response, error) {
+		header := http.Header{}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		return websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	}
+
+	_, resp, err := dial("https://evil.example.com")
+	is.True(err != nil)
+	is.Equal(resp.StatusCode, http.StatusForbidden)
+
+	conn, _, err := dial("https://karta.sundsvall.se")
+	is.NoErr(err)
+	conn.Close()
+
+	conn, _, err = dial("")
+	is.NoErr(err) // clients that are not browsers send no origin
+	conn.Close()
+}
+
+func TestThatViewportClientsReceiveTheEntitiesInsideTheirSubscriptions(t *testing.T) {
+	is := is.New(t)
+
+	server, closeServer := newViewportTestServer(is)
+	defer closeServer()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	is.NoErr(err)
+	defer conn.Close()
+
+	receive := func() viewportMessage {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		message := viewportMessage{}
+		is.NoErr(conn.ReadJSON(&message))
+		return message
+	}
+
+	is.NoErr(conn.WriteJSON(viewportCommand{Action: viewportActionSubscribe, ID: "map", BBox: []float64{17.3, 62.39, 17.32, 62.4}}))
+	is.Equal(receive().Type, "subscribed")
+
+	added := receive()
+	is.Equal(added.Type, "add")
+	is.True(strings.Contains(string(added.Entity), `"id":"`+diwise.ExerciseTrailIDPrefix+database.SundsvallAnlaggningPrefix+"701"+`"`))
+
+	for i := 1; i < maxViewportSubscriptions; i++ {
+		is.NoErr(conn.WriteJSON(viewportCommand{Action: viewportActionSubscribe, ID: fmt.Sprintf("empty-%d", i), BBox: []float64{0, 0, 0.1, 0.1}}))
+		is.Equal(receive().Type, "subscribed")
+	}
+
+	is.NoErr(conn.WriteJSON(viewportCommand{Action: viewportActionSubscribe, ID: "one-too-many", BBox: []float64{0, 0, 0.1, 0.1}}))
+	rejected := receive()
+	is.Equal(rejected.Type, "error") // a client should not exceed the maximum number of subscriptions
+	is.Equal(rejected.Subscription, "one-too-many")
+
+	is.NoErr(conn.WriteJSON(viewportCommand{Action: viewportActionSubscribe, ID: "map", BBox: []float64{0, 0, 0.1, 0.1}}))
+	is.Equal(receive().Type, "subscribed") // but may still move the viewports it has
+
+	removed := receive()
+	is.Equal(removed.Type, "remove")
+	is.Equal(removed.EntityID, diwise.ExerciseTrailIDPrefix+database.SundsvallAnlaggningPrefix+"701")
+}
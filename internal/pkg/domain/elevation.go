@@ -0,0 +1,132 @@
+package domain
+
+import "math"
+
+//ElevationSampleInterval is the distance in metres between samples in an elevation profile
+const ElevationSampleInterval float64 = 10.0
+
+//ElevationNoiseThreshold is the change in metres that the elevation must exceed before it is
+//counted as ascent or descent, so that noise in the elevation model does not add up
+const ElevationNoiseThreshold float64 = 1.0
+
+//GradientDistance is the shortest distance in metres that a gradient is computed over
+const GradientDistance float64 = 50.0
+
+//ElevationModel returns the elevation in metres above sea level at a WGS84 position
+type ElevationModel interface {
+	ElevationAt(position []float64) (float64, bool)
+}
+
+//ElevationSample is the elevation at a distance in metres along a trail
+type ElevationSample struct {
+	Distance  float64
+	Elevation float64
+}
+
+//ElevationProfile contains the elevation samples along a trail, together with statistics in metres
+//and the steepest gradient in percent
+type ElevationProfile struct {
+	Samples      []ElevationSample
+	TotalAscent  float64
+	TotalDescent float64
+	MaxGradient  float64
+	MinElevation float64
+	MaxElevation float64
+}
+
+//NewElevationProfile samples the elevation model along the line string. It returns nil if
+//the elevation model does not cover any part of the line.
+func NewElevationProfile(ls LineString, model ElevationModel) *ElevationProfile {
+	profile := &ElevationProfile{
+		MinElevation: math.Inf(1),
+		MaxElevation: math.Inf(-1),
+	}
+
+	sample := func(position []float64, distance float64) {
+		if elevation, ok := model.ElevationAt(position); ok {
+			profile.Samples = append(profile.Samples, ElevationSample{Distance: distance, Elevation: elevation})
+			profile.MinElevation = math.Min(profile.MinElevation, elevation)
+			profile.MaxElevation = math.Max(profile.MaxElevation, elevation)
+		}
+	}
+
+	travelled := 0.0
+	nextSample := 0.0
+
+	for idx := 1; idx < len(ls.Lines); idx++ {
+		from, to := ls.Lines[idx-1], ls.Lines[idx]
+		length := Distance(from, to)
+		if math.IsInf(length, 1) {
+			continue
+		}
+
+		for nextSample <= travelled+length && length > 0 {
+			t := (nextSample - travelled) / length
+			sample([]float64{from[0] + t*(to[0]-from[0]), from[1] + t*(to[1]-from[1])}, nextSample)
+			nextSample += ElevationSampleInterval
+		}
+
+		travelled += length
+	}
+
+	if len(ls.Lines) > 0 && (len(profile.Samples) == 0 || profile.Samples[len(profile.Samples)-1].Distance < travelled) {
+		sample(ls.Lines[len(ls.Lines)-1], travelled)
+	}
+
+	if len(profile.Samples) == 0 {
+		return nil
+	}
+
+	profile.computeAscentAndDescent()
+	profile.computeMaxGradient()
+
+	return profile
+}
+
+func (p *ElevationProfile) computeAscentAndDescent() {
+	reference := p.Samples[0].Elevation
+
+	for _, s := range p.Samples[1:] {
+		if s.Elevation-reference >= ElevationNoiseThreshold {
+			p.TotalAscent += s.Elevation - reference
+			reference = s.Elevation
+		} else if reference-s.Elevation >= ElevationNoiseThreshold {
+			p.TotalDescent += reference - s.Elevation
+			reference = s.Elevation
+		}
+	}
+}
+
+func (p *ElevationProfile) computeMaxGradient() {
+	last := len(p.Samples) - 1
+	if last < 1 {
+		return
+	}
+
+	if p.Samples[last].Distance-p.Samples[0].Distance < GradientDistance {
+		p.MaxGradient = gradient(p.Samples[0], p.Samples[last])
+		return
+	}
+
+	j := 0
+	for i := 0; i <= last; i++ {
+		for j <= last && p.Samples[j].Distance-p.Samples[i].Distance < GradientDistance {
+			j++
+		}
+
+		if j > last {
+			break
+		}
+
+		p.MaxGradient = math.Max(p.MaxGradient, gradient(p.Samples[i], p.Samples[j]))
+	}
+}
+
+func gradient(from, to ElevationSample) float64 {
+	distance := to.Distance - from.Distance
+	if distance <= 0 {
+		return 0
+	}
+
+	return math.Abs(to.Elevation-from.Elevation) / distance * 100
+}
@@ -1,6 +1,9 @@
 package domain
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 type LineString struct {
 	Lines [][]float64
@@ -10,18 +13,52 @@ type MultiPolygon struct {
 	Lines [][][][]float64
 }
 
+type Point struct {
+	Coordinates []float64
+}
+
 //Beach contains a point of interest of type Beach
 type Beach struct {
-	ID               string
-	Name             string
-	Description      string
-	Geometry         MultiPolygon
-	WikidataID       *string
-	NUTSCode         *string
-	SensorID         *string
-	WaterTemperature *float64
-	DateCreated      time.Time
-	DateModified     time.Time
+	ID                         string
+	Name                       string
+	Description                string
+	Geometry                   MultiPolygon
+	WikidataID                 *string
+	NUTSCode                   *string
+	SensorID                   *string
+	Sensors                    []string
+	SensorAggregation          string
+	WaterTemperature           *float64
+	WaterTemperatureObservedAt time.Time
+	WaterTemperatureStale      bool
+	BeachType                  []string
+	Facilities                 []string
+	Bookable                   *bool
+	OpeningHours               []string
+	ContactPoint               *ContactPoint
+	DateCreated                time.Time
+	DateModified               time.Time
+}
+
+//DeviceAssignment binds a sensor to a beach from a point in time until, if set, another
+type DeviceAssignment struct {
+	DeviceID string
+	BeachID  string
+	Location *Point
+	From     time.Time
+	To       time.Time
+}
+
+//ActiveAt reports if the device was assigned to the beach at the given time
+func (a DeviceAssignment) ActiveAt(t time.Time) bool {
+	return !t.Before(a.From) && (a.To.IsZero() || t.Before(a.To))
+}
+
+//ContactPoint contains the contact details published for a point of interest
+type ContactPoint struct {
+	URL       string
+	Telephone string
+	Email     string
 }
 
 type ExerciseTrail struct {
@@ -30,11 +67,91 @@ type ExerciseTrail struct {
 	Description      string
 	Category         []string
 	Length           float64
+	ComputedLength   float64
 	AreaServed       string
 	Geometry         LineString
 	Status           string
+	StatusReason     string
+	Season           *Season
+	LightingSchedule *LightingSchedule
+	Elevation        *ElevationProfile
+	Difficulty       string
 	DateCreated      time.Time
 	DateModified     time.Time
 	DateLastPrepared time.Time
 	Source           string
 }
+
+//PointOfInterest contains the attributes shared by facilities that are located at a single point
+type PointOfInterest struct {
+	ID           string
+	Name         string
+	Description  string
+	Location     Point
+	DateCreated  time.Time
+	DateModified time.Time
+	Source       string
+}
+
+//Playground contains a point of interest of type Playground
+type Playground struct {
+	PointOfInterest
+}
+
+//OutdoorGym contains a point of interest of type OutdoorGym
+type OutdoorGym struct {
+	PointOfInterest
+}
+
+//Fireplace contains a point of interest of type Fireplace, such as a barbecue spot
+type Fireplace struct {
+	PointOfInterest
+}
+
+//SportsField contains a point of interest of type SportsField, such as a football pitch or an ice rink
+type SportsField struct {
+	PointOfInterest
+	Category     []string
+	Surface      string
+	Bookable     *bool
+	OpeningHours []string
+}
+
+//DataQualityIssue describes a problem found in the data loaded from a source
+type DataQualityIssue struct {
+	EntityID  string
+	Attribute string
+	Message   string
+}
+
+//Season is a recurring period of the year, such as the ski season, that may span the new year
+type Season struct {
+	FromMonth time.Month
+	FromDay   int
+	ToMonth   time.Month
+	ToDay     int
+}
+
+//Contains reports if the time is within the season, including the first and the last day
+func (s Season) Contains(t time.Time) bool {
+	day := int(t.Month())*100 + t.Day()
+	from := int(s.FromMonth)*100 + s.FromDay
+	to := int(s.ToMonth)*100 + s.ToDay
+
+	if from <= to {
+		return day >= from && day <= to
+	}
+
+	return day >= from || day <= to
+}
+
+func (s Season) String() string {
+	return fmt.Sprintf("%02d-%02d to %02d-%02d", s.FromMonth, s.FromDay, s.ToMonth, s.ToDay)
+}
+
+//StatusOverride is a manually set status that takes precedence over the status reported by sources
+type StatusOverride struct {
+	Status string
+	Reason string
+	Until  time.Time
+}
@@ -0,0 +1,186 @@
+package domain
+
+import "math"
+
+const earthRadiusInMetres float64 = 6371008.8
+
+//Length returns the geodesic length of the line string in metres, ignoring segments with invalid positions
+func (ls LineString) Length() float64 {
+	length := 0.0
+
+	for idx := 1; idx < len(ls.Lines); idx++ {
+		if d := Distance(ls.Lines[idx-1], ls.Lines[idx]); !math.IsInf(d, 1) {
+			length += d
+		}
+	}
+
+	return length
+}
+
+//Distance returns the great circle distance in metres between two WGS84 positions, or an infinite
+//distance if any of the positions is invalid
+func Distance(from, to []float64) float64 {
+	if len(from) < 2 || len(to) < 2 {
+		return math.Inf(1)
+	}
+
+	lat1 := from[1] * math.Pi / 180
+	lat2 := to[1] * math.Pi / 180
+	deltaLat := (to[1] - from[1]) * math.Pi / 180
+	deltaLon := (to[0] - from[0]) * math.Pi / 180
+
+	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(deltaLon/2)*math.Sin(deltaLon/2)
+
+	return 2 * earthRadiusInMetres * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+//Centroid returns the average position of the vertices in the outer rings of the multi polygon
+func (mp MultiPolygon) Centroid() Point {
+	lon, lat, count := 0.0, 0.0, 0.0
+
+	for _, polygon := range mp.Lines {
+		if len(polygon) == 0 {
+			continue
+		}
+
+		for _, position := range polygon[0] {
+			if len(position) >= 2 {
+				lon += position[0]
+				lat += position[1]
+				count++
+			}
+		}
+	}
+
+	if count == 0 {
+		return Point{}
+	}
+
+	return Point{Coordinates: []float64{lon / count, lat / count}}
+}
+
+//DistanceTo returns the distance in metres from the point to another point
+func (p Point) DistanceTo(other Point) float64 {
+	return Distance(p.Coordinates, other.Coordinates)
+}
+
+//DistanceTo returns the distance in metres from a point to the nearest point on the line string
+func (ls LineString) DistanceTo(p Point) float64 {
+	if len(ls.Lines) == 1 {
+		return Distance(ls.Lines[0], p.Coordinates)
+	}
+
+	proj := newLocalProjection(p)
+	nearest := math.Inf(1)
+
+	for idx := 1; idx < len(ls.Lines); idx++ {
+		d := proj.distanceToSegment(ls.Lines[idx-1], ls.Lines[idx])
+		if d < nearest {
+			nearest = d
+		}
+	}
+
+	return nearest
+}
+
+//DistanceTo returns the distance in metres from a point to the nearest edge of the multi polygon,
+//or zero if the point is inside any of the polygons
+func (mp MultiPolygon) DistanceTo(p Point) float64 {
+	proj := newLocalProjection(p)
+	nearest := math.Inf(1)
+
+	for _, polygon := range mp.Lines {
+		if proj.insidePolygon(polygon) {
+			return 0
+		}
+
+		for _, ring := range polygon {
+			for idx := 1; idx < len(ring); idx++ {
+				d := proj.distanceToSegment(ring[idx-1], ring[idx])
+				if d < nearest {
+					nearest = d
+				}
+			}
+		}
+	}
+
+	return nearest
+}
+
+//localProjection is an equirectangular projection centered on a point, which is accurate
+//enough for distances within a municipality
+type localProjection struct {
+	lon0, lat0, cosLat0 float64
+}
+
+func newLocalProjection(origin Point) localProjection {
+	if len(origin.Coordinates) < 2 {
+		return localProjection{cosLat0: 1}
+	}
+
+	return localProjection{
+		lon0:    origin.Coordinates[0],
+		lat0:    origin.Coordinates[1],
+		cosLat0: math.Cos(origin.Coordinates[1] * math.Pi / 180),
+	}
+}
+
+func (lp localProjection) project(position []float64) (float64, float64) {
+	x := (position[0] - lp.lon0) * math.Pi / 180 * earthRadiusInMetres * lp.cosLat0
+	y := (position[1] - lp.lat0) * math.Pi / 180 * earthRadiusInMetres
+	return x, y
+}
+
+//distanceToSegment returns the distance from the origin of the projection to a line segment
+func (lp localProjection) distanceToSegment(from, to []float64) float64 {
+	if len(from) < 2 || len(to) < 2 {
+		return math.Inf(1)
+	}
+
+	x1, y1 := lp.project(from)
+	x2, y2 := lp.project(to)
+
+	dx, dy := x2-x1, y2-y1
+	lengthSquared := dx*dx + dy*dy
+
+	t := 0.0
+	if lengthSquared > 0 {
+		t = math.Max(0, math.Min(1, -(x1*dx+y1*dy)/lengthSquared))
+	}
+
+	return math.Hypot(x1+t*dx, y1+t*dy)
+}
+
+//insidePolygon reports if the origin of the projection is inside the outer ring, but not inside any hole, of a polygon
+func (lp localProjection) insidePolygon(polygon [][][]float64) bool {
+	for idx, ring := range polygon {
+		inside := lp.insideRing(ring)
+		if idx == 0 && !inside {
+			return false
+		} else if idx > 0 && inside {
+			return false
+		}
+	}
+
+	return len(polygon) > 0
+}
+
+func (lp localProjection) insideRing(ring [][]float64) bool {
+	inside := false
+
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		if len(ring[i]) < 2 || len(ring[j]) < 2 {
+			continue
+		}
+
+		xi, yi := lp.project(ring[i])
+		xj, yj := lp.project(ring[j])
+
+		if (yi > 0) != (yj > 0) && 0 < (xj-xi)*(0-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"math"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestLineStringLength(t *testing.T) {
+	is := is.New(t)
+
+	// one hundredth of a degree of latitude is roughly 1112 metres
+	ls := LineString{Lines: [][]float64{{17.3, 62.39}, {17.3, 62.40}}}
+	is.True(math.Abs(ls.Length()-1112) < 1)
+}
+
+func TestThatInvalidPositionsAreInfinitelyFarAway(t *testing.T) {
+	is := is.New(t)
+
+	p := Point{Coordinates: []float64{17.3, 62.39}}
+	is.True(math.IsInf(p.DistanceTo(Point{}), 1)) // a point without coordinates should never be nearest
+	is.True(math.IsInf(Distance([]float64{17.3}, p.Coordinates), 1))
+
+	ls := LineString{Lines: [][]float64{{17.3, 62.39}, {}, {17.3, 62.39}, {17.3, 62.40}}}
+	is.True(math.Abs(ls.Length()-1112) < 1) // segments with invalid positions should not add to the length
+}
+
+func TestDistanceToLineString(t *testing.T) {
+	is := is.New(t)
+
+	ls := LineString{Lines: [][]float64{{17.30, 62.39}, {17.30, 62.40}}}
+	p := Point{Coordinates: []float64{17.31, 62.395}}
+
+	// one hundredth of a degree of longitude at this latitude is roughly 515 metres
+	is.True(math.Abs(ls.DistanceTo(p)-515) < 2)
+}
+
+func TestDistanceToMultiPolygon(t *testing.T) {
+	is := is.New(t)
+
+	mp := MultiPolygon{Lines: [][][][]float64{{{{17.30, 62.39}, {17.31, 62.39}, {17.31, 62.40}, {17.30, 62.40}, {17.30, 62.39}}}}}
+
+	is.Equal(mp.DistanceTo(Point{Coordinates: []float64{17.305, 62.395}}), 0.0) // point inside polygon
+	is.True(math.Abs(mp.DistanceTo(Point{Coordinates: []float64{17.305, 62.41}})-1112) < 2)
+}
+
+type slopeModel struct{}
+
+//ElevationAt returns an elevation that rises one metre for every ten metres north of latitude 62.39
+func (slopeModel) ElevationAt(position []float64) (float64, bool) {
+	return (position[1] - 62.39) * 11120, true
+}
+
+func TestElevationProfileOfSteadyClimb(t *testing.T) {
+	is := is.New(t)
+
+	ls := LineString{Lines: [][]float64{{17.3, 62.39}, {17.3, 62.40}}}
+	profile := NewElevationProfile(ls, slopeModel{})
+
+	is.True(profile != nil)
+	is.True(math.Abs(profile.TotalAscent-111.2) < 0.5)
+	is.Equal(profile.TotalDescent, 0.0)
+	is.True(math.Abs(profile.MaxGradient-10) < 0.1)
+	is.True(len(profile.Samples) > 100) // one sample every ten metres
+}
@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	Sunrise string = "sunrise"
+	Sunset  string = "sunset"
+)
+
+//LightingSchedule describes when the floodlights of a trail are lit, using either a clock time
+//formatted as HH:MM in the local time zone or the sunrise and sunset at the trail
+type LightingSchedule struct {
+	From string
+	To   string
+}
+
+//Validate returns an error if the bounds of the schedule are neither clock times nor sun events
+func (ls LightingSchedule) Validate() error {
+	for _, bound := range []string{ls.From, ls.To} {
+		if bound == Sunrise || bound == Sunset {
+			continue
+		}
+
+		if _, err := time.Parse("15:04", bound); err != nil {
+			return fmt.Errorf("%q is neither a time formatted as HH:MM, %s nor %s", bound, Sunrise, Sunset)
+		}
+	}
+
+	return nil
+}
+
+//LightsOn reports if the lights are on at the time t, for a trail at the position p
+func (ls LightingSchedule) LightsOn(t time.Time, p Point) bool {
+	if len(p.Coordinates) < 2 {
+		return false
+	}
+
+	sunrise, sunset := sunEventsAsMinutes(t, p.Coordinates[1], p.Coordinates[0])
+
+	toMinutes := func(bound string) int {
+		if bound == Sunrise {
+			return sunrise
+		} else if bound == Sunset {
+			return sunset
+		}
+		clock, _ := time.Parse("15:04", bound)
+		return clock.Hour()*60 + clock.Minute()
+	}
+
+	from, to := toMinutes(ls.From), toMinutes(ls.To)
+	now := t.Hour()*60 + t.Minute()
+
+	// a schedule spans midnight when it ends before it starts, such as 18:00 to 01:00, sunset to 06:00
+	// or 18:00 to sunrise. A schedule that mixes a sun event with a clock time in the evening, such as
+	// sunset to 22:00, does not span midnight but is not lit at all during light summer evenings.
+	fromIsSunEvent := ls.From == Sunrise || ls.From == Sunset
+	toIsSunEvent := ls.To == Sunrise || ls.To == Sunset
+	endsInTheEvening := to >= 12*60
+
+	if to <= from && (fromIsSunEvent == toIsSunEvent || !endsInTheEvening) {
+		return now >= from || now < to
+	}
+
+	return now >= from && now < to
+}
+
+//sunEventsAsMinutes returns the sunrise and sunset as minutes after midnight in the time zone of t
+func sunEventsAsMinutes(t time.Time, lat, lon float64) (int, int) {
+	sunrise, sunset, ok := SunriseAndSunset(t, lat, lon)
+	if !ok {
+		if sunset.IsZero() {
+			// polar night, the sun does not rise
+			return 24 * 60, 0
+		}
+		// midnight sun, the sun does not set
+		return 0, 24 * 60
+	}
+
+	sunrise, sunset = sunrise.In(t.Location()), sunset.In(t.Location())
+	return sunrise.Hour()*60 + sunrise.Minute(), sunset.Hour()*60 + sunset.Minute()
+}
+
+//SunriseAndSunset calculates the sunrise and sunset at a position for the date of t, using the
+//NOAA general solar position equations. When the sun does not rise or set during the day ok is
+//false and sunset is zero during polar night and non-zero during midnight sun.
+func SunriseAndSunset(t time.Time, lat, lon float64) (sunrise, sunset time.Time, ok bool) {
+	year, month, day := t.Date()
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+	gamma := 2 * math.Pi / 365 * float64(t.YearDay()-1)
+
+	eqtime := 229.18 * (0.000075 + 0.001868*math.Cos(gamma) - 0.032077*math.Sin(gamma) -
+		0.014615*math.Cos(2*gamma) - 0.040849*math.Sin(2*gamma))
+
+	decl := 0.006918 - 0.399912*math.Cos(gamma) + 0.070257*math.Sin(gamma) -
+		0.006758*math.Cos(2*gamma) + 0.000907*math.Sin(2*gamma) -
+		0.002697*math.Cos(3*gamma) + 0.00148*math.Sin(3*gamma)
+
+	latRad := lat * math.Pi / 180
+	zenith := 90.833 * math.Pi / 180
+
+	cosHourAngle := math.Cos(zenith)/(math.Cos(latRad)*math.Cos(decl)) - math.Tan(latRad)*math.Tan(decl)
+
+	if cosHourAngle > 1 {
+		return time.Time{}, time.Time{}, false
+	} else if cosHourAngle < -1 {
+		return midnight, midnight.Add(24 * time.Hour), false
+	}
+
+	hourAngle := math.Acos(cosHourAngle) * 180 / math.Pi
+
+	sunriseMinutes := 720 - 4*(lon+hourAngle) - eqtime
+	sunsetMinutes := 720 - 4*(lon-hourAngle) - eqtime
+
+	sunrise = midnight.Add(time.Duration(sunriseMinutes * float64(time.Minute)))
+	sunset = midnight.Add(time.Duration(sunsetMinutes * float64(time.Minute)))
+
+	return sunrise, sunset, true
+}
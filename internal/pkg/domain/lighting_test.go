@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestSunsetInSundsvall(t *testing.T) {
+	is := is.New(t)
+
+	stockholm, _ := time.LoadLocation("Europe/Stockholm")
+
+	_, sunset, ok := SunriseAndSunset(time.Date(2021, 12, 21, 12, 0, 0, 0, stockholm), 62.39, 17.31)
+	is.True(ok)
+	is.Equal(sunset.In(stockholm).Hour(), 14) // sunset around 14:00 at winter solstice
+
+	_, sunset, ok = SunriseAndSunset(time.Date(2022, 6, 21, 12, 0, 0, 0, stockholm), 62.39, 17.31)
+	is.True(ok)
+	is.True(sunset.In(stockholm).Hour() >= 22) // sunset after 22:00 at summer solstice
+}
+
+func TestLightsOnFromSunsetTo22(t *testing.T) {
+	is := is.New(t)
+
+	stockholm, _ := time.LoadLocation("Europe/Stockholm")
+	schedule := LightingSchedule{From: Sunset, To: "22:00"}
+	trail := Point{Coordinates: []float64{17.31, 62.39}}
+
+	is.True(schedule.LightsOn(time.Date(2021, 12, 21, 17, 0, 0, 0, stockholm), trail))  // dark winter evening
+	is.True(!schedule.LightsOn(time.Date(2021, 12, 21, 23, 0, 0, 0, stockholm), trail)) // after 22:00
+	is.True(!schedule.LightsOn(time.Date(2021, 12, 21, 11, 0, 0, 0, stockholm), trail)) // daytime
+	is.True(!schedule.LightsOn(time.Date(2022, 6, 21, 21, 0, 0, 0, stockholm), trail))  // light summer evening
+
+	night := LightingSchedule{From: "18:00", To: "01:00"}
+	is.True(night.LightsOn(time.Date(2021, 12, 21, 0, 30, 0, 0, stockholm), trail)) // schedule spans midnight
+}
+
+func TestLightsOnFromSunsetTo06(t *testing.T) {
+	is := is.New(t)
+
+	stockholm, _ := time.LoadLocation("Europe/Stockholm")
+	schedule := LightingSchedule{From: Sunset, To: "06:00"}
+	trail := Point{Coordinates: []float64{17.31, 62.39}}
+
+	is.True(schedule.LightsOn(time.Date(2021, 12, 21, 17, 0, 0, 0, stockholm), trail))  // winter evening
+	is.True(schedule.LightsOn(time.Date(2021, 12, 21, 2, 0, 0, 0, stockholm), trail))   // schedule spans midnight
+	is.True(!schedule.LightsOn(time.Date(2021, 12, 21, 7, 0, 0, 0, stockholm), trail))  // after 06:00
+	is.True(!schedule.LightsOn(time.Date(2021, 12, 21, 12, 0, 0, 0, stockholm), trail)) // before sunset
+}
+
+func TestLightsOnFrom18ToSunrise(t *testing.T) {
+	is := is.New(t)
+
+	stockholm, _ := time.LoadLocation("Europe/Stockholm")
+	schedule := LightingSchedule{From: "18:00", To: Sunrise}
+	trail := Point{Coordinates: []float64{17.31, 62.39}}
+
+	is.True(schedule.LightsOn(time.Date(2021, 12, 21, 19, 0, 0, 0, stockholm), trail))  // winter evening
+	is.True(schedule.LightsOn(time.Date(2021, 12, 21, 8, 0, 0, 0, stockholm), trail))   // before sunrise around 09:45
+	is.True(!schedule.LightsOn(time.Date(2021, 12, 21, 11, 0, 0, 0, stockholm), trail)) // after sunrise
+	is.True(!schedule.LightsOn(time.Date(2021, 12, 21, 17, 0, 0, 0, stockholm), trail)) // before 18:00
+}
@@ -0,0 +1,486 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+//JunctionTolerance is the distance in metres within which vertices of different trails are
+//considered to be the same position in the trail network
+const JunctionTolerance float64 = 10.0
+
+//MaxLoopsInSuggestion is the largest number of loops that are combined into a route suggestion
+const MaxLoopsInSuggestion int = 4
+
+//snapCellSize is the size in metres of the grid cells that segments are indexed by when snapping
+//vertices onto the segments of other trails
+const snapCellSize float64 = 100.0
+
+//Junction is a position in the trail network where three or more segments meet
+type Junction struct {
+	ID       string
+	Location Point
+	Trails   []string
+}
+
+//Segment is a section of the trail network between two junctions or trail ends, that is
+//shared by all of the trails it lists
+type Segment struct {
+	ID       string
+	From     string
+	To       string
+	Trails   []string
+	Geometry LineString
+	Length   float64
+}
+
+//LoopSuggestion is a combination of connected loops, where each loop shares at least one
+//position with a loop earlier in the list
+type LoopSuggestion struct {
+	Trails []string
+	Length float64
+}
+
+//TrailNetwork is a graph of the junctions and shared segments of a set of exercise trails
+type TrailNetwork struct {
+	Junctions []Junction
+	Segments  []Segment
+
+	connections map[string]map[string]bool
+	lengths     map[string]float64
+	loops       map[string]bool
+}
+
+type networkNode struct {
+	position  []float64
+	trails    map[string]bool
+	neighbors map[int]bool
+}
+
+//NewTrailNetwork builds a trail network by merging vertices of the trail geometries that are
+//within JunctionTolerance of each other, after snapping vertices onto nearby segments of other trails
+func NewTrailNetwork(trails []ExerciseTrail) *TrailNetwork {
+	network := &TrailNetwork{
+		Junctions:   []Junction{},
+		Segments:    []Segment{},
+		connections: map[string]map[string]bool{},
+		lengths:     map[string]float64{},
+		loops:       map[string]bool{},
+	}
+
+	nodes := []*networkNode{}
+	sequences := map[string][]int{}
+	edgeTrails := map[[2]int]map[string]bool{}
+	geometries := snapToOtherTrails(trails)
+
+	var proj *localProjection
+	grid := map[[2]int][]int{}
+
+	nodeAt := func(position []float64) int {
+		if proj == nil {
+			p := newLocalProjection(Point{Coordinates: position})
+			proj = &p
+		}
+
+		x, y := proj.project(position)
+		cx, cy := int(math.Floor(x/JunctionTolerance)), int(math.Floor(y/JunctionTolerance))
+
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				for _, idx := range grid[[2]int{cx + dx, cy + dy}] {
+					if Distance(nodes[idx].position, position) <= JunctionTolerance {
+						return idx
+					}
+				}
+			}
+		}
+
+		nodes = append(nodes, &networkNode{position: position, trails: map[string]bool{}, neighbors: map[int]bool{}})
+		grid[[2]int{cx, cy}] = append(grid[[2]int{cx, cy}], len(nodes)-1)
+		return len(nodes) - 1
+	}
+
+	for _, trail := range trails {
+		sequence := []int{}
+
+		for _, position := range geometries[trail.ID] {
+			idx := nodeAt(position)
+			if len(sequence) > 0 && sequence[len(sequence)-1] == idx {
+				continue
+			}
+
+			nodes[idx].trails[trail.ID] = true
+			if len(sequence) > 0 {
+				prev := sequence[len(sequence)-1]
+				nodes[prev].neighbors[idx] = true
+				nodes[idx].neighbors[prev] = true
+
+				edge := edgeKey(prev, idx)
+				if edgeTrails[edge] == nil {
+					edgeTrails[edge] = map[string]bool{}
+				}
+				edgeTrails[edge][trail.ID] = true
+			}
+
+			sequence = append(sequence, idx)
+		}
+
+		if len(sequence) < 2 {
+			continue
+		}
+
+		sequences[trail.ID] = sequence
+		network.connections[trail.ID] = map[string]bool{}
+		network.lengths[trail.ID] = trail.Length
+		if trail.Length == 0 {
+			network.lengths[trail.ID] = trail.ComputedLength
+		}
+		network.loops[trail.ID] = sequence[0] == sequence[len(sequence)-1]
+	}
+
+	for _, node := range nodes {
+		for trailID := range node.trails {
+			for otherID := range node.trails {
+				if trailID != otherID {
+					network.connections[trailID][otherID] = true
+				}
+			}
+		}
+	}
+
+	junctionIDs := map[int]string{}
+	boundaries := map[int]bool{}
+
+	for idx, node := range nodes {
+		if len(node.neighbors) > 2 {
+			boundaries[idx] = true
+			junctionIDs[idx] = fmt.Sprintf("junction:%d", len(network.Junctions)+1)
+			network.Junctions = append(network.Junctions, Junction{
+				ID:       junctionIDs[idx],
+				Location: Point{Coordinates: node.position},
+				Trails:   sortedKeys(node.trails),
+			})
+		}
+	}
+
+	for _, sequence := range sequences {
+		boundaries[sequence[0]] = true
+		boundaries[sequence[len(sequence)-1]] = true
+	}
+
+	endpointID := func(idx int) string {
+		if id, ok := junctionIDs[idx]; ok {
+			return id
+		}
+		return ""
+	}
+
+	segments := map[string]bool{}
+
+	trailIDs := make([]string, 0, len(sequences))
+	for trailID := range sequences {
+		trailIDs = append(trailIDs, trailID)
+	}
+	sort.Strings(trailIDs)
+
+	for _, trailID := range trailIDs {
+		sequence := sequences[trailID]
+		start := 0
+
+		for idx := 1; idx < len(sequence); idx++ {
+			if !boundaries[sequence[idx]] && idx < len(sequence)-1 {
+				continue
+			}
+
+			run := sequence[start : idx+1]
+			start = idx
+
+			key := segmentKey(run)
+			if segments[key] {
+				continue
+			}
+			segments[key] = true
+
+			segment := Segment{
+				ID:     fmt.Sprintf("segment:%d", len(network.Segments)+1),
+				From:   endpointID(run[0]),
+				To:     endpointID(run[len(run)-1]),
+				Trails: sharedTrails(edgeTrails, run),
+			}
+
+			for _, n := range run {
+				segment.Geometry.Lines = append(segment.Geometry.Lines, nodes[n].position)
+			}
+			segment.Length = segment.Geometry.Length() / 1000.0
+
+			network.Segments = append(network.Segments, segment)
+		}
+	}
+
+	return network
+}
+
+//ConnectedTrails returns the IDs of the trails that share at least one position with a trail
+func (n *TrailNetwork) ConnectedTrails(trailID string) []string {
+	return sortedKeys(n.connections[trailID])
+}
+
+//SuggestLoops returns combinations of connected loops whose total length in km is as close as
+//possible to the target length. If a start trail is given, all suggestions begin with that loop.
+func (n *TrailNetwork) SuggestLoops(startTrailID string, targetLength float64, limit int) []LoopSuggestion {
+	starts := []string{}
+	if startTrailID != "" {
+		if n.loops[startTrailID] {
+			starts = append(starts, startTrailID)
+		}
+	} else {
+		for trailID, isLoop := range n.loops {
+			if isLoop {
+				starts = append(starts, trailID)
+			}
+		}
+		sort.Strings(starts)
+	}
+
+	seen := map[string]bool{}
+	suggestions := []LoopSuggestion{}
+
+	var combine func(trails []string, length float64)
+	combine = func(trails []string, length float64) {
+		key := combinationKey(trails)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+
+		suggestions = append(suggestions, LoopSuggestion{
+			Trails: append([]string{}, trails...),
+			Length: length,
+		})
+
+		if len(trails) >= MaxLoopsInSuggestion || length >= targetLength {
+			return
+		}
+
+		for _, candidate := range n.connectedLoops(trails) {
+			combine(append(trails, candidate), length+n.lengths[candidate])
+		}
+	}
+
+	for _, start := range starts {
+		combine([]string{start}, n.lengths[start])
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		di := math.Abs(suggestions[i].Length - targetLength)
+		dj := math.Abs(suggestions[j].Length - targetLength)
+		if di != dj {
+			return di < dj
+		}
+		return len(suggestions[i].Trails) < len(suggestions[j].Trails)
+	})
+
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+
+	return suggestions
+}
+
+//connectedLoops returns the loops, not already in the combination, that connect to any of its trails
+func (n *TrailNetwork) connectedLoops(trails []string) []string {
+	candidates := map[string]bool{}
+
+	for _, trailID := range trails {
+		for other := range n.connections[trailID] {
+			if n.loops[other] && !contains(trails, other) {
+				candidates[other] = true
+			}
+		}
+	}
+
+	return sortedKeys(candidates)
+}
+
+//sharedTrails returns the trails that traverse every edge of a run of nodes
+func sharedTrails(edgeTrails map[[2]int]map[string]bool, run []int) []string {
+	shared := map[string]bool{}
+	for trailID := range edgeTrails[edgeKey(run[0], run[1])] {
+		shared[trailID] = true
+	}
+
+	for idx := 2; idx < len(run); idx++ {
+		traversing := edgeTrails[edgeKey(run[idx-1], run[idx])]
+		for trailID := range shared {
+			if !traversing[trailID] {
+				delete(shared, trailID)
+			}
+		}
+	}
+
+	return sortedKeys(shared)
+}
+
+//edgeKey identifies the edge between two nodes regardless of the direction it is traversed in
+func edgeKey(a, b int) [2]int {
+	if b < a {
+		return [2]int{b, a}
+	}
+	return [2]int{a, b}
+}
+
+//snapToOtherTrails returns the positions of each trail, with the vertices of other trails that are
+//within JunctionTolerance of one of its segments, but not of its vertices, inserted into that segment.
+//This lets a trail that joins another trail in the middle of a long segment share a junction with it.
+func snapToOtherTrails(trails []ExerciseTrail) map[string][][]float64 {
+	type segmentRef struct {
+		trail int
+		index int
+	}
+
+	type insertion struct {
+		position []float64
+		distance float64
+	}
+
+	geometries := make([][][]float64, len(trails))
+	for idx, trail := range trails {
+		for _, position := range trail.Geometry.Lines {
+			if len(position) >= 2 {
+				geometries[idx] = append(geometries[idx], position)
+			}
+		}
+	}
+
+	var proj *localProjection
+	grid := map[[2]int][]segmentRef{}
+
+	cellOf := func(x, y float64) [2]int {
+		return [2]int{int(math.Floor(x / snapCellSize)), int(math.Floor(y / snapCellSize))}
+	}
+
+	for t, geometry := range geometries {
+		for i := 1; i < len(geometry); i++ {
+			if proj == nil {
+				p := newLocalProjection(Point{Coordinates: geometry[0]})
+				proj = &p
+			}
+
+			x1, y1 := proj.project(geometry[i-1])
+			x2, y2 := proj.project(geometry[i])
+			low := cellOf(math.Min(x1, x2)-JunctionTolerance, math.Min(y1, y2)-JunctionTolerance)
+			high := cellOf(math.Max(x1, x2)+JunctionTolerance, math.Max(y1, y2)+JunctionTolerance)
+
+			for cx := low[0]; cx <= high[0]; cx++ {
+				for cy := low[1]; cy <= high[1]; cy++ {
+					grid[[2]int{cx, cy}] = append(grid[[2]int{cx, cy}], segmentRef{t, i})
+				}
+			}
+		}
+	}
+
+	insertions := map[segmentRef][]insertion{}
+
+	for t, geometry := range geometries {
+		for _, position := range geometry {
+			if len(grid) == 0 {
+				break
+			}
+
+			vertex := newLocalProjection(Point{Coordinates: position})
+			nearest := map[int]segmentRef{}
+			distances := map[int]float64{}
+
+			for _, ref := range grid[cellOf(proj.project(position))] {
+				if ref.trail == t {
+					continue
+				}
+
+				from, to := geometries[ref.trail][ref.index-1], geometries[ref.trail][ref.index]
+				if Distance(from, position) <= JunctionTolerance || Distance(to, position) <= JunctionTolerance {
+					// the vertex is merged with the vertex of the other trail when the graph is built
+					distances[ref.trail] = 0
+					delete(nearest, ref.trail)
+					continue
+				}
+
+				d := vertex.distanceToSegment(from, to)
+				if previous, ok := distances[ref.trail]; d <= JunctionTolerance && (!ok || d < previous) {
+					distances[ref.trail] = d
+					nearest[ref.trail] = ref
+				}
+			}
+
+			for _, ref := range nearest {
+				from := geometries[ref.trail][ref.index-1]
+				insertions[ref] = append(insertions[ref], insertion{position, Distance(from, position)})
+			}
+		}
+	}
+
+	snapped := map[string][][]float64{}
+
+	for t, geometry := range geometries {
+		result := [][]float64{}
+
+		for i, position := range geometry {
+			if i > 0 {
+				inserted := insertions[segmentRef{t, i}]
+				sort.SliceStable(inserted, func(a, b int) bool { return inserted[a].distance < inserted[b].distance })
+
+				for _, ins := range inserted {
+					result = append(result, ins.position)
+				}
+			}
+
+			result = append(result, position)
+		}
+
+		snapped[trails[t].ID] = result
+	}
+
+	return snapped
+}
+
+//segmentKey identifies a run of nodes regardless of the direction it was traversed in
+func segmentKey(run []int) string {
+	forward := make([]string, len(run))
+	backward := make([]string, len(run))
+
+	for idx, n := range run {
+		forward[idx] = fmt.Sprint(n)
+		backward[len(run)-1-idx] = fmt.Sprint(n)
+	}
+
+	f, b := strings.Join(forward, ","), strings.Join(backward, ",")
+	if b < f {
+		return b
+	}
+	return f
+}
+
+func combinationKey(trails []string) string {
+	sorted := append([]string{}, trails...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, "|")
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestTrailNetworkWithSharedSection(t *testing.T) {
+	is := is.New(t)
+
+	// two square loops that share their eastern and western edges respectively
+	west := ExerciseTrail{ID: "west", Length: 2.5, Geometry: LineString{Lines: [][]float64{
+		{17.30, 62.39}, {17.31, 62.39}, {17.31, 62.40}, {17.30, 62.40}, {17.30, 62.39},
+	}}}
+	east := ExerciseTrail{ID: "east", Length: 3.0, Geometry: LineString{Lines: [][]float64{
+		{17.31, 62.39}, {17.32, 62.39}, {17.32, 62.40}, {17.31, 62.40}, {17.31, 62.39},
+	}}}
+
+	network := NewTrailNetwork([]ExerciseTrail{west, east})
+
+	is.Equal(len(network.Junctions), 2) // the ends of the shared edge should be junctions
+	is.Equal(network.ConnectedTrails("west"), []string{"east"})
+
+	shared := 0
+	for _, segment := range network.Segments {
+		if len(segment.Trails) == 2 {
+			shared++
+		}
+	}
+	is.Equal(shared, 1) // the shared edge should be a single segment used by both trails
+
+	suggestions := network.SuggestLoops("west", 5.0, 3)
+	is.Equal(suggestions[0].Trails, []string{"west", "east"})
+	is.Equal(suggestions[0].Length, 5.5)
+}
+
+func TestThatTrailsJoiningInTheMiddleOfASegmentShareAJunction(t *testing.T) {
+	is := is.New(t)
+
+	// a long straight trail and a spur that starts a few metres from its middle
+	main := ExerciseTrail{ID: "main", Length: 1.1, Geometry: LineString{Lines: [][]float64{
+		{17.30, 62.39}, {17.32, 62.39},
+	}}}
+	spur := ExerciseTrail{ID: "spur", Length: 0.6, Geometry: LineString{Lines: [][]float64{
+		{17.31, 62.39004}, {17.31, 62.395},
+	}}}
+
+	network := NewTrailNetwork([]ExerciseTrail{main, spur})
+
+	is.Equal(len(network.Junctions), 1) // the spur should join the main trail at a junction
+	is.Equal(network.Junctions[0].Trails, []string{"main", "spur"})
+	is.Equal(network.ConnectedTrails("spur"), []string{"main"})
+	is.Equal(len(network.Segments), 3) // the main trail should be split at the junction
+}
+
+func TestThatSegmentsAreOnlyAttributedToTrailsThatTraverseThem(t *testing.T) {
+	is := is.New(t)
+
+	// both trails start and end at the same positions, but only the direct one follows the straight line
+	direct := ExerciseTrail{ID: "direct", Geometry: LineString{Lines: [][]float64{
+		{17.30, 62.39}, {17.31, 62.39},
+	}}}
+	detour := ExerciseTrail{ID: "detour", Geometry: LineString{Lines: [][]float64{
+		{17.30, 62.39}, {17.305, 62.395}, {17.31, 62.39},
+	}}}
+
+	network := NewTrailNetwork([]ExerciseTrail{direct, detour})
+
+	is.Equal(len(network.Segments), 2)
+	for _, segment := range network.Segments {
+		is.Equal(len(segment.Trails), 1) // no segment is traversed by both trails
+	}
+}
@@ -0,0 +1,116 @@
+package elevation
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//parseASCIIGrid parses an ESRI ASCII grid with a header of key value pairs followed by rows of values
+func parseASCIIGrid(data []byte, crs string) (*Grid, error) {
+	project, err := projectionFor(crs)
+	if err != nil {
+		return nil, err
+	}
+
+	grid := &Grid{project: project}
+	header := map[string]float64{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	scanner.Split(bufio.ScanWords)
+
+	for scanner.Scan() {
+		token := scanner.Text()
+
+		if _, err := strconv.ParseFloat(token, 64); err == nil {
+			if len(header) == 0 {
+				return nil, fmt.Errorf("ascii grid is missing a header")
+			}
+			if err := grid.applyASCIIHeader(header); err != nil {
+				return nil, err
+			}
+			grid.values = make([]float64, 0, grid.columns*grid.rows)
+			break
+		}
+
+		if !scanner.Scan() {
+			return nil, fmt.Errorf("ascii grid header %s has no value", token)
+		}
+
+		value, err := strconv.ParseFloat(scanner.Text(), 64)
+		if err != nil {
+			return nil, fmt.Errorf("ascii grid header %s has an invalid value", token)
+		}
+
+		header[strings.ToLower(token)] = value
+	}
+
+	if grid.values == nil {
+		return nil, fmt.Errorf("ascii grid contains no values")
+	}
+
+	for {
+		value, err := strconv.ParseFloat(scanner.Text(), 64)
+		if err != nil {
+			return nil, fmt.Errorf("ascii grid contains an invalid value %s", scanner.Text())
+		}
+
+		grid.values = append(grid.values, value)
+
+		if !scanner.Scan() {
+			break
+		}
+	}
+
+	if len(grid.values) != grid.columns*grid.rows {
+		return nil, fmt.Errorf("ascii grid has %d values, expected %d", len(grid.values), grid.columns*grid.rows)
+	}
+
+	return grid, nil
+}
+
+func (g *Grid) applyASCIIHeader(header map[string]float64) error {
+	g.columns = int(header["ncols"])
+	g.rows = int(header["nrows"])
+	if g.columns <= 0 || g.rows <= 0 {
+		return fmt.Errorf("ascii grid must have positive ncols and nrows")
+	}
+
+	if cellSize, ok := header["cellsize"]; ok {
+		g.cellWidth, g.cellHeight = cellSize, cellSize
+	} else {
+		g.cellWidth, g.cellHeight = header["dx"], header["dy"]
+	}
+
+	if g.cellWidth <= 0 || g.cellHeight <= 0 {
+		return fmt.Errorf("ascii grid must have a positive cell size")
+	}
+
+	if x, ok := header["xllcorner"]; ok {
+		g.left = x
+	} else if x, ok := header["xllcenter"]; ok {
+		g.left = x - g.cellWidth/2
+	} else {
+		return fmt.Errorf("ascii grid is missing xllcorner or xllcenter")
+	}
+
+	bottom := 0.0
+	if y, ok := header["yllcorner"]; ok {
+		bottom = y
+	} else if y, ok := header["yllcenter"]; ok {
+		bottom = y - g.cellHeight/2
+	} else {
+		return fmt.Errorf("ascii grid is missing yllcorner or yllcenter")
+	}
+
+	g.top = bottom + float64(g.rows)*g.cellHeight
+
+	if noData, ok := header["nodata_value"]; ok {
+		g.noData = &noData
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package elevation
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	//WGS84 is the coordinate reference system of grids with cells in degrees of longitude and latitude
+	WGS84 string = "EPSG:4326"
+	//SWEREF99TM is the national coordinate reference system of Sweden, used by Lantmäteriet's elevation data
+	SWEREF99TM string = "EPSG:3006"
+)
+
+//Grid is a digital elevation model of regularly spaced cells, ordered row by row from the top
+type Grid struct {
+	columns, rows int
+	left, top     float64
+	cellWidth     float64
+	cellHeight    float64
+	values        []float64
+	noData        *float64
+	project       func(position []float64) (float64, float64)
+}
+
+//LoadFromFile loads an elevation model from an ESRI ASCII grid (.asc) or an uncompressed GeoTIFF (.tif).
+//The coordinate reference system is read from GeoTIFF files and must be given for ASCII grids.
+func LoadFromFile(path, crs string) (*Grid, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".asc":
+		return parseASCIIGrid(data, crs)
+	case ".tif", ".tiff":
+		return parseGeoTIFF(data)
+	}
+
+	return nil, fmt.Errorf("unsupported elevation model format %s", filepath.Ext(path))
+}
+
+func projectionFor(crs string) (func([]float64) (float64, float64), error) {
+	switch strings.ToUpper(crs) {
+	case "", SWEREF99TM:
+		return toSWEREF99TM, nil
+	case WGS84:
+		return func(position []float64) (float64, float64) { return position[0], position[1] }, nil
+	}
+
+	return nil, fmt.Errorf("unsupported coordinate reference system %s", crs)
+}
+
+func (g *Grid) valueAt(col, row int) (float64, bool) {
+	if col < 0 || row < 0 || col >= g.columns || row >= g.rows {
+		return 0, false
+	}
+
+	value := g.values[row*g.columns+col]
+	if math.IsNaN(value) || (g.noData != nil && value == *g.noData) {
+		return 0, false
+	}
+
+	return value, true
+}
+
+//ElevationAt returns the bilinearly interpolated elevation at a WGS84 position, or the value of the
+//nearest cell if any of the surrounding cells lack data
+func (g *Grid) ElevationAt(position []float64) (float64, bool) {
+	if len(position) < 2 {
+		return 0, false
+	}
+
+	x, y := g.project(position)
+
+	// position in cell units relative to the center of the top left cell
+	fx := (x-g.left)/g.cellWidth - 0.5
+	fy := (g.top-y)/g.cellHeight - 0.5
+
+	if fx < -0.5 || fy < -0.5 || fx > float64(g.columns)-0.5 || fy > float64(g.rows)-0.5 {
+		return 0, false
+	}
+
+	col, row := int(math.Floor(fx)), int(math.Floor(fy))
+	tx, ty := fx-float64(col), fy-float64(row)
+
+	v00, ok00 := g.valueAt(col, row)
+	v10, ok10 := g.valueAt(col+1, row)
+	v01, ok01 := g.valueAt(col, row+1)
+	v11, ok11 := g.valueAt(col+1, row+1)
+
+	if ok00 && ok10 && ok01 && ok11 {
+		top := v00 + tx*(v10-v00)
+		bottom := v01 + tx*(v11-v01)
+		return top + ty*(bottom-top), true
+	}
+
+	return g.valueAt(int(math.Round(fx)), int(math.Round(fy)))
+}
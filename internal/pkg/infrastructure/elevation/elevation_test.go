@@ -0,0 +1,141 @@
+package elevation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestProjectionAlongCentralMeridian(t *testing.T) {
+	is := is.New(t)
+
+	easting, northing := toSWEREF99TM([]float64{15.0, 62.39})
+
+	is.True(math.Abs(easting-500000) < 0.001)
+	is.True(math.Abs(northing-6917627.77) < 0.01) // scaled meridian arc length from the equator
+}
+
+func TestASCIIGridInterpolation(t *testing.T) {
+	is := is.New(t)
+
+	grid, err := parseASCIIGrid([]byte(asciiGrid), WGS84)
+	is.NoErr(err)
+
+	elevation, ok := grid.ElevationAt([]float64{17.305, 62.395})
+	is.True(ok)
+	is.True(math.Abs(elevation-25) < 1e-6) // center of the grid should be the average of the four cells
+
+	elevation, ok = grid.ElevationAt([]float64{17.3025, 62.3975})
+	is.True(ok)
+	is.True(math.Abs(elevation-10) < 1e-6) // center of the top left cell
+
+	grid.values[2] = -9999
+	_, ok = grid.ElevationAt([]float64{17.3025, 62.3925})
+	is.True(!ok) // cells with no data should not be interpolated
+
+	elevation, _ = grid.ElevationAt([]float64{17.3035, 62.3965})
+	is.Equal(elevation, 10.0) // nearest cell with data should be used next to cells with no data
+
+	_, ok = grid.ElevationAt([]float64{17.4, 62.395})
+	is.True(!ok) // outside of the grid
+}
+
+func TestLoadGeoTIFF(t *testing.T) {
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "dem.tif")
+	is.NoErr(os.WriteFile(path, createGeoTIFF([]float32{10, 20, 30, 40}), 0644))
+
+	grid, err := LoadFromFile(path, "")
+	is.NoErr(err)
+
+	elevation, ok := grid.ElevationAt([]float64{17.305, 62.395})
+	is.True(ok)
+	is.True(math.Abs(elevation-25) < 1e-6)
+}
+
+const asciiGrid string = `ncols 2
+nrows 2
+xllcorner 17.30
+yllcorner 62.39
+cellsize 0.005
+NODATA_value -9999
+10 20
+30 40
+`
+
+//createGeoTIFF creates a little endian 2x2 float32 geotiff in WGS84 with the same extent as asciiGrid
+func createGeoTIFF(values []float32) []byte {
+	const entries = 11
+	const dataOffset = 8 + 2 + entries*12 + 4
+
+	type entry struct {
+		tag, dataType uint16
+		count         uint32
+		value         []byte
+	}
+
+	le := binary.LittleEndian
+	u16 := func(v ...uint16) []byte {
+		b := make([]byte, 2*len(v))
+		for i, x := range v {
+			le.PutUint16(b[i*2:], x)
+		}
+		return b
+	}
+	u32 := func(v uint32) []byte { b := make([]byte, 4); le.PutUint32(b, v); return b }
+	f64 := func(v ...float64) []byte {
+		b := make([]byte, 8*len(v))
+		for i, x := range v {
+			le.PutUint64(b[i*8:], math.Float64bits(x))
+		}
+		return b
+	}
+
+	pixels := &bytes.Buffer{}
+	binary.Write(pixels, le, values)
+
+	tiepoint := f64(0, 0, 0, 17.30, 62.40, 0)
+	scale := f64(0.005, 0.005, 0)
+	geokeys := u16(1, 1, 0, 1, 2048, 0, 1, 4326)
+
+	extra := &bytes.Buffer{}
+	offsetOf := func(data []byte) []byte {
+		offset := uint32(dataOffset + extra.Len())
+		extra.Write(data)
+		return u32(offset)
+	}
+
+	directory := []entry{
+		{256, 3, 1, u16(2, 0)},
+		{257, 3, 1, u16(2, 0)},
+		{258, 3, 1, u16(32, 0)},
+		{259, 3, 1, u16(1, 0)},
+		{273, 4, 1, offsetOf(pixels.Bytes())},
+		{277, 3, 1, u16(1, 0)},
+		{279, 4, 1, u32(uint32(pixels.Len()))},
+		{339, 3, 1, u16(3, 0)},
+		{33550, 12, 3, offsetOf(scale)},
+		{33922, 12, 6, offsetOf(tiepoint)},
+		{34735, 3, 8, offsetOf(geokeys)},
+	}
+
+	out := &bytes.Buffer{}
+	out.WriteString("II")
+	out.Write(u16(42))
+	out.Write(u32(8))
+	out.Write(u16(entries))
+	for _, e := range directory {
+		out.Write(u16(e.tag, e.dataType))
+		out.Write(u32(e.count))
+		out.Write(e.value)
+	}
+	out.Write(u32(0))
+	out.Write(extra.Bytes())
+	return out.Bytes()
+}
@@ -0,0 +1,266 @@
+package elevation
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	tagImageWidth        uint16 = 256
+	tagImageLength       uint16 = 257
+	tagBitsPerSample     uint16 = 258
+	tagCompression       uint16 = 259
+	tagStripOffsets      uint16 = 273
+	tagSamplesPerPixel   uint16 = 277
+	tagRowsPerStrip      uint16 = 278
+	tagStripByteCounts   uint16 = 279
+	tagTileWidth         uint16 = 322
+	tagSampleFormat      uint16 = 339
+	tagModelPixelScale   uint16 = 33550
+	tagModelTiepoint     uint16 = 33922
+	tagGeoKeyDirectory   uint16 = 34735
+	tagGDALNoData        uint16 = 42113
+	geoKeyGeographicType uint16 = 2048
+	geoKeyProjectedType  uint16 = 3072
+)
+
+type tiffField struct {
+	dataType uint16
+	count    uint32
+	data     []byte
+}
+
+//tiffReader reads the fields of the first image file directory of a classic (not BigTIFF) TIFF file
+type tiffReader struct {
+	data   []byte
+	order  binary.ByteOrder
+	fields map[uint16]tiffField
+}
+
+var tiffTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+func newTIFFReader(data []byte) (*tiffReader, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("file is too short to be a tiff")
+	}
+
+	r := &tiffReader{data: data, fields: map[uint16]tiffField{}}
+
+	switch string(data[0:2]) {
+	case "II":
+		r.order = binary.LittleEndian
+	case "MM":
+		r.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("file is not a tiff")
+	}
+
+	if r.order.Uint16(data[2:4]) != 42 {
+		return nil, fmt.Errorf("only classic tiff files are supported")
+	}
+
+	offset := r.order.Uint32(data[4:8])
+	if uint64(offset)+2 > uint64(len(data)) {
+		return nil, fmt.Errorf("invalid tiff directory offset")
+	}
+
+	entries := uint32(r.order.Uint16(data[offset:]))
+	if uint64(offset)+2+uint64(entries)*12 > uint64(len(data)) {
+		return nil, fmt.Errorf("truncated tiff directory")
+	}
+
+	for idx := uint32(0); idx < entries; idx++ {
+		entry := data[offset+2+idx*12:]
+		field := tiffField{dataType: r.order.Uint16(entry[2:4]), count: r.order.Uint32(entry[4:8])}
+
+		size, ok := tiffTypeSizes[field.dataType]
+		if !ok {
+			continue
+		}
+
+		length := uint64(size) * uint64(field.count)
+		if length <= 4 {
+			field.data = entry[8 : 8+length]
+		} else {
+			valueOffset := uint64(r.order.Uint32(entry[8:12]))
+			if valueOffset+length > uint64(len(data)) {
+				return nil, fmt.Errorf("truncated tiff field")
+			}
+			field.data = data[valueOffset : valueOffset+length]
+		}
+
+		r.fields[r.order.Uint16(entry[0:2])] = field
+	}
+
+	return r, nil
+}
+
+//uints returns the values of a field with unsigned integer values
+func (r *tiffReader) uints(tag uint16) []uint64 {
+	field, ok := r.fields[tag]
+	if !ok {
+		return nil
+	}
+
+	values := make([]uint64, 0, field.count)
+	for idx := uint32(0); idx < field.count; idx++ {
+		switch field.dataType {
+		case 1:
+			values = append(values, uint64(field.data[idx]))
+		case 3:
+			values = append(values, uint64(r.order.Uint16(field.data[idx*2:])))
+		case 4:
+			values = append(values, uint64(r.order.Uint32(field.data[idx*4:])))
+		}
+	}
+
+	return values
+}
+
+func (r *tiffReader) uint(tag uint16, defaultValue uint64) uint64 {
+	if values := r.uints(tag); len(values) > 0 {
+		return values[0]
+	}
+	return defaultValue
+}
+
+func (r *tiffReader) doubles(tag uint16) []float64 {
+	field, ok := r.fields[tag]
+	if !ok || field.dataType != 12 {
+		return nil
+	}
+
+	values := make([]float64, field.count)
+	for idx := range values {
+		values[idx] = math.Float64frombits(r.order.Uint64(field.data[idx*8:]))
+	}
+
+	return values
+}
+
+//parseGeoTIFF parses a single band, uncompressed and stripped GeoTIFF in WGS84 or SWEREF 99 TM
+func parseGeoTIFF(data []byte) (*Grid, error) {
+	r, err := newTIFFReader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.uint(tagCompression, 1) != 1 {
+		return nil, fmt.Errorf("only uncompressed geotiff files are supported")
+	}
+
+	if r.uint(tagSamplesPerPixel, 1) != 1 {
+		return nil, fmt.Errorf("only single band geotiff files are supported")
+	}
+
+	if _, tiled := r.fields[tagTileWidth]; tiled {
+		return nil, fmt.Errorf("only stripped geotiff files are supported")
+	}
+
+	grid := &Grid{
+		columns: int(r.uint(tagImageWidth, 0)),
+		rows:    int(r.uint(tagImageLength, 0)),
+	}
+
+	if grid.columns <= 0 || grid.rows <= 0 {
+		return nil, fmt.Errorf("geotiff is missing image dimensions")
+	}
+
+	scale := r.doubles(tagModelPixelScale)
+	tiepoint := r.doubles(tagModelTiepoint)
+	if len(scale) < 2 || len(tiepoint) < 6 {
+		return nil, fmt.Errorf("geotiff is missing pixel scale or tiepoint")
+	}
+
+	grid.cellWidth, grid.cellHeight = scale[0], scale[1]
+	grid.left = tiepoint[3] - tiepoint[0]*grid.cellWidth
+	grid.top = tiepoint[4] + tiepoint[1]*grid.cellHeight
+
+	grid.project, err = projectionFor(geoTIFFCoordinateSystem(r))
+	if err != nil {
+		return nil, err
+	}
+
+	if field, ok := r.fields[tagGDALNoData]; ok {
+		if noData, err := strconv.ParseFloat(strings.Trim(string(field.data), "\x00 "), 64); err == nil {
+			grid.noData = &noData
+		}
+	}
+
+	grid.values, err = readGeoTIFFSamples(r, grid.columns*grid.rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return grid, nil
+}
+
+func geoTIFFCoordinateSystem(r *tiffReader) string {
+	keys := r.uints(tagGeoKeyDirectory)
+
+	for idx := 4; idx+3 < len(keys); idx += 4 {
+		key, location, value := uint16(keys[idx]), keys[idx+1], keys[idx+3]
+		if location != 0 {
+			continue
+		}
+
+		if key == geoKeyProjectedType || key == geoKeyGeographicType {
+			return fmt.Sprintf("EPSG:%d", value)
+		}
+	}
+
+	return ""
+}
+
+func readGeoTIFFSamples(r *tiffReader, count int) ([]float64, error) {
+	bits := r.uint(tagBitsPerSample, 1)
+	format := r.uint(tagSampleFormat, 1)
+
+	var decode func([]byte) float64
+
+	switch {
+	case format == 3 && bits == 32:
+		decode = func(b []byte) float64 { return float64(math.Float32frombits(r.order.Uint32(b))) }
+	case format == 3 && bits == 64:
+		decode = func(b []byte) float64 { return math.Float64frombits(r.order.Uint64(b)) }
+	case format == 2 && bits == 16:
+		decode = func(b []byte) float64 { return float64(int16(r.order.Uint16(b))) }
+	case format == 2 && bits == 32:
+		decode = func(b []byte) float64 { return float64(int32(r.order.Uint32(b))) }
+	case format == 1 && bits == 16:
+		decode = func(b []byte) float64 { return float64(r.order.Uint16(b)) }
+	case format == 1 && bits == 32:
+		decode = func(b []byte) float64 { return float64(r.order.Uint32(b)) }
+	default:
+		return nil, fmt.Errorf("unsupported geotiff sample format %d with %d bits", format, bits)
+	}
+
+	size := int(bits / 8)
+	offsets := r.uints(tagStripOffsets)
+	byteCounts := r.uints(tagStripByteCounts)
+	if len(offsets) == 0 || len(offsets) != len(byteCounts) {
+		return nil, fmt.Errorf("geotiff is missing strip offsets")
+	}
+
+	values := make([]float64, 0, count)
+
+	for idx, offset := range offsets {
+		end := offset + byteCounts[idx]
+		if end > uint64(len(r.data)) {
+			return nil, fmt.Errorf("truncated geotiff strip")
+		}
+
+		for pos := offset; pos+uint64(size) <= end && len(values) < count; pos += uint64(size) {
+			values = append(values, decode(r.data[pos:]))
+		}
+	}
+
+	if len(values) != count {
+		return nil, fmt.Errorf("geotiff has %d samples, expected %d", len(values), count)
+	}
+
+	return values, nil
+}
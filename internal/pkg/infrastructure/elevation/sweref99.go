@@ -0,0 +1,55 @@
+package elevation
+
+import "math"
+
+//toSWEREF99TM projects a WGS84 position to SWEREF 99 TM easting and northing, using the
+//Gauss-Krüger formulas published by Lantmäteriet
+func toSWEREF99TM(position []float64) (float64, float64) {
+	const (
+		axis            = 6378137.0
+		flattening      = 1.0 / 298.257222101
+		centralMeridian = 15.0
+		scale           = 0.9996
+		falseNorthing   = 0.0
+		falseEasting    = 500000.0
+	)
+
+	e2 := flattening * (2.0 - flattening)
+	n := flattening / (2.0 - flattening)
+	aRoof := axis / (1.0 + n) * (1.0 + n*n/4.0 + n*n*n*n/64.0)
+
+	A := e2
+	B := (5.0*e2*e2 - e2*e2*e2) / 6.0
+	C := (104.0*e2*e2*e2 - 45.0*e2*e2*e2*e2) / 120.0
+	D := (1237.0 * e2 * e2 * e2 * e2) / 1260.0
+
+	beta1 := n/2.0 - 2.0*n*n/3.0 + 5.0*n*n*n/16.0 + 41.0*n*n*n*n/180.0
+	beta2 := 13.0*n*n/48.0 - 3.0*n*n*n/5.0 + 557.0*n*n*n*n/1440.0
+	beta3 := 61.0*n*n*n/240.0 - 103.0*n*n*n*n/140.0
+	beta4 := 49561.0 * n * n * n * n / 161280.0
+
+	phi := position[1] * math.Pi / 180.0
+	lambda := position[0] * math.Pi / 180.0
+	lambda0 := centralMeridian * math.Pi / 180.0
+
+	sinPhi := math.Sin(phi)
+	phiStar := phi - sinPhi*math.Cos(phi)*(A+B*math.Pow(sinPhi, 2)+C*math.Pow(sinPhi, 4)+D*math.Pow(sinPhi, 6))
+	deltaLambda := lambda - lambda0
+
+	xiPrim := math.Atan(math.Tan(phiStar) / math.Cos(deltaLambda))
+	etaPrim := math.Atanh(math.Cos(phiStar) * math.Sin(deltaLambda))
+
+	northing := scale*aRoof*(xiPrim+
+		beta1*math.Sin(2.0*xiPrim)*math.Cosh(2.0*etaPrim)+
+		beta2*math.Sin(4.0*xiPrim)*math.Cosh(4.0*etaPrim)+
+		beta3*math.Sin(6.0*xiPrim)*math.Cosh(6.0*etaPrim)+
+		beta4*math.Sin(8.0*xiPrim)*math.Cosh(8.0*etaPrim)) + falseNorthing
+
+	easting := scale*aRoof*(etaPrim+
+		beta1*math.Cos(2.0*xiPrim)*math.Sinh(2.0*etaPrim)+
+		beta2*math.Cos(4.0*xiPrim)*math.Sinh(4.0*etaPrim)+
+		beta3*math.Cos(6.0*xiPrim)*math.Sinh(6.0*etaPrim)+
+		beta4*math.Cos(8.0*xiPrim)*math.Sinh(8.0*etaPrim)) + falseEasting
+
+	return easting, northing
+}
@@ -0,0 +1,250 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+)
+
+//ErrUnsupportedAttribute is returned when an update contains attributes that can not be changed for an entity type
+var ErrUnsupportedAttribute error = errors.New("attribute can not be updated")
+
+//ErrInvalidAttributeValue is returned when an update contains a value that is not valid for the attribute
+var ErrInvalidAttributeValue error = errors.New("invalid attribute value")
+
+//AttributeUpdate contains new values for the descriptive attributes of an entity. Attributes that are
+//nil are left unchanged. The location and status can only be changed for locally managed entities, while
+//entities from the facility source accept them as long as they are unchanged.
+type AttributeUpdate struct {
+	Name         *string
+	Description  *string
+	AreaServed   *string
+	Category     []string
+	Length       *float64
+	Difficulty   *string
+	OpeningHours []string
+
+	TrailGeometry *domain.LineString
+	BeachGeometry *domain.MultiPolygon
+	Status        *string
+}
+
+//descriptive returns the update without the location and status
+func (u AttributeUpdate) descriptive() AttributeUpdate {
+	u.TrailGeometry = nil
+	u.BeachGeometry = nil
+	u.Status = nil
+	return u
+}
+
+func (u AttributeUpdate) unsupported(supported ...string) error {
+	given := map[string]bool{
+		"name":         u.Name != nil,
+		"description":  u.Description != nil,
+		"areaServed":   u.AreaServed != nil,
+		"category":     u.Category != nil,
+		"length":       u.Length != nil,
+		"difficulty":   u.Difficulty != nil,
+		"openingHours": u.OpeningHours != nil,
+		"location":     u.TrailGeometry != nil || u.BeachGeometry != nil,
+		"status":       u.Status != nil,
+	}
+
+	for _, attr := range supported {
+		delete(given, attr)
+	}
+
+	unsupported := []string{}
+	for attr, isGiven := range given {
+		if isGiven {
+			unsupported = append(unsupported, attr)
+		}
+	}
+
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return fmt.Errorf("%w: %s", ErrUnsupportedAttribute, strings.Join(unsupported, ", "))
+	}
+
+	return nil
+}
+
+//ApplyToTrail changes the descriptive attributes of a trail. When overwrite is false, only attributes
+//that do not have a value yet are changed. The trail is left unchanged if the update is invalid.
+func (u AttributeUpdate) ApplyToTrail(trail *domain.ExerciseTrail, overwrite bool) error {
+	err := u.unsupported("name", "description", "areaServed", "category", "length", "difficulty")
+	if err != nil {
+		return err
+	}
+
+	difficulty := ""
+	if u.Difficulty != nil {
+		var ok bool
+		difficulty, ok = sourceDifficulties[strings.ToLower(strings.TrimSpace(*u.Difficulty))]
+		if !ok {
+			return fmt.Errorf("%w: unknown difficulty %q", ErrInvalidAttributeValue, *u.Difficulty)
+		}
+	}
+
+	if u.Length != nil && *u.Length <= 0 {
+		return fmt.Errorf("%w: length must be a positive number of km", ErrInvalidAttributeValue)
+	}
+
+	updateText(&trail.Name, u.Name, overwrite)
+	updateText(&trail.Description, u.Description, overwrite)
+	updateText(&trail.AreaServed, u.AreaServed, overwrite)
+
+	if u.Category != nil && (overwrite || len(trail.Category) == 0) {
+		trail.Category = append([]string{}, u.Category...)
+	}
+
+	if u.Length != nil && (overwrite || trail.Length == 0) {
+		trail.Length = *u.Length
+	}
+
+	if u.Difficulty != nil && (overwrite || trail.Difficulty == "") {
+		trail.Difficulty = difficulty
+	}
+
+	return nil
+}
+
+//ApplyToBeach changes the descriptive attributes of a beach. When overwrite is false, only attributes
+//that do not have a value yet are changed. The beach is left unchanged if the update is invalid.
+func (u AttributeUpdate) ApplyToBeach(beach *domain.Beach, overwrite bool) error {
+	err := u.unsupported("name", "description", "openingHours")
+	if err != nil {
+		return err
+	}
+
+	updateText(&beach.Name, u.Name, overwrite)
+	updateText(&beach.Description, u.Description, overwrite)
+
+	if u.OpeningHours != nil && (overwrite || len(beach.OpeningHours) == 0) {
+		beach.OpeningHours = append([]string{}, u.OpeningHours...)
+	}
+
+	return nil
+}
+
+func updateText(current *string, value *string, overwrite bool) {
+	if value != nil && (overwrite || *current == "") {
+		*current = *value
+	}
+}
+
+func (db *myDB) UpdateTrailAttributes(trailID string, update AttributeUpdate, overwrite bool) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for idx, trail := range db.trails {
+		if trail.ID != trailID {
+			continue
+		}
+
+		if update.BeachGeometry != nil {
+			return fmt.Errorf("%w: the location of an exercise trail must be a LineString", ErrInvalidAttributeValue)
+		}
+
+		//attributes that always have a value are kept as they are when not overwriting
+		geometryChanged := overwrite && update.TrailGeometry != nil && !reflect.DeepEqual(update.TrailGeometry.Lines, trail.Geometry.Lines)
+		statusChanged := overwrite && update.Status != nil && *update.Status != db.withEffectiveStatus(trail).Status
+
+		if (geometryChanged || statusChanged) && !db.localEntities[trailID] {
+			return fmt.Errorf("%w: the location and status of %s are managed by the facility source", ErrUnsupportedAttribute, trailID)
+		}
+
+		if geometryChanged && len(update.TrailGeometry.Lines) < 2 {
+			return fmt.Errorf("%w: the location of a trail must have at least two positions", ErrInvalidAttributeValue)
+		}
+
+		if statusChanged && *update.Status != TrailStatusOpen && *update.Status != TrailStatusClosed {
+			return fmt.Errorf("%w: status must be either %s or %s", ErrInvalidAttributeValue, TrailStatusOpen, TrailStatusClosed)
+		}
+
+		//only a given difficulty is a value of its own, a classified difficulty follows the other attributes
+		given := db.givenDifficulties[trailID]
+		trail.Difficulty = sourceDifficulties[strings.ToLower(strings.TrimSpace(given))]
+
+		err := update.descriptive().ApplyToTrail(&trail, overwrite)
+		if err != nil {
+			return err
+		}
+
+		if trail.Difficulty != "" {
+			given = trail.Difficulty
+		}
+
+		if geometryChanged {
+			trail.Geometry = *update.TrailGeometry
+			trail.ComputedLength = trail.Geometry.Length() / 1000.0
+			db.removeIssues(trailID, "length")
+			db.verifyTrailLength(&trail)
+			db.updateElevationProfile(&trail)
+		}
+
+		if statusChanged {
+			db.trailStatuses[trailID].source = *update.Status
+		}
+
+		//length, category and location are all used to classify the difficulty
+		db.removeIssues(trailID, "difficulty")
+		db.updateDifficulty(&trail, given)
+
+		trail.DateModified = db.now().UTC()
+		db.trails[idx] = trail
+		db.notifyTrailChanged(trailID)
+
+		return db.saveLocalEntitiesIfManaged(trailID)
+	}
+
+	return errors.New("not found")
+}
+
+func (db *myDB) UpdateBeachAttributes(beachID string, update AttributeUpdate, overwrite bool) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	idx := db.beachIndex(beachID)
+	if idx < 0 {
+		return errors.New("not found")
+	}
+
+	beach := db.beaches[idx]
+
+	if update.Status != nil {
+		return fmt.Errorf("%w: status", ErrUnsupportedAttribute)
+	}
+
+	if update.TrailGeometry != nil {
+		return fmt.Errorf("%w: the location of a beach must be a Polygon or a MultiPolygon", ErrInvalidAttributeValue)
+	}
+
+	geometryChanged := overwrite && update.BeachGeometry != nil && !reflect.DeepEqual(update.BeachGeometry.Lines, beach.Geometry.Lines)
+	if geometryChanged && !db.localEntities[beachID] {
+		return fmt.Errorf("%w: the location of %s is managed by the facility source", ErrUnsupportedAttribute, beachID)
+	}
+
+	if geometryChanged && len(update.BeachGeometry.Lines) == 0 {
+		return fmt.Errorf("%w: the location of a beach must have at least one polygon", ErrInvalidAttributeValue)
+	}
+
+	err := update.descriptive().ApplyToBeach(&beach, overwrite)
+	if err != nil {
+		return err
+	}
+
+	if geometryChanged {
+		beach.Geometry = *update.BeachGeometry
+	}
+
+	beach.DateModified = db.now().UTC()
+	db.beaches[idx] = beach
+	db.notifyBeachChanged(beachID)
+
+	return db.saveLocalEntitiesIfManaged(beachID)
+}
@@ -0,0 +1,42 @@
+package database
+
+const (
+	EntityTypeBeach         string = "Beach"
+	EntityTypeExerciseTrail string = "ExerciseTrail"
+)
+
+//EntityChange describes a change that the datastore has applied to a beach or an exercise trail
+type EntityChange struct {
+	EntityType string
+	EntityID   string
+	Deleted    bool
+}
+
+//ChangeListener is called for every change that the datastore applies. Listeners are called while
+//the datastore is locked, and must return quickly without calling the datastore.
+type ChangeListener func(change EntityChange)
+
+//AddChangeListener registers a listener that is notified of changes from telemetry, the trail status
+//feed, enrichment and manual updates
+func (db *myDB) AddChangeListener(listener ChangeListener) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.listeners = append(db.listeners, listener)
+}
+
+func (db *myDB) notifyChange(entityType, entityID string, deleted bool) {
+	change := EntityChange{EntityType: entityType, EntityID: entityID, Deleted: deleted}
+
+	for _, listener := range db.listeners {
+		listener(change)
+	}
+}
+
+func (db *myDB) notifyTrailChanged(trailID string) {
+	db.notifyChange(EntityTypeExerciseTrail, trailID, false)
+}
+
+func (db *myDB) notifyBeachChanged(beachID string) {
+	db.notifyChange(EntityTypeBeach, beachID, false)
+}
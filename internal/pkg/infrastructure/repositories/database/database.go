@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -17,6 +20,16 @@ import (
 
 const (
 	SundsvallAnlaggningPrefix string = "se:sundsvall:facilities:"
+
+	//DefaultSensorIDPrefix is prepended to the sensor names published by the source and the enrichment
+	DefaultSensorIDPrefix string = "se:servanet:lora:"
+
+	//TrailLengthDeviationThreshold is the largest relative difference between the declared
+	//and the computed length of a trail that is accepted without being reported
+	TrailLengthDeviationThreshold float64 = 0.1
+
+	//MaxPreparationHistoryLength is the number of preparation events that are kept for each trail
+	MaxPreparationHistoryLength int = 1000
 )
 
 type FeatureGeom struct {
@@ -54,19 +67,114 @@ type Datastore interface {
 	GetBeachFromID(id string) (*domain.Beach, error)
 	GetAllBeaches() ([]domain.Beach, error)
 	UpdateWaterTemperatureFromDeviceID(device string, temp float64, observedAt time.Time) (string, error)
+	CreateBeach(beach domain.Beach) error
+	DeleteBeach(beachID string) error
+
+	AssignDeviceToBeach(assignment domain.DeviceAssignment) error
+	UnassignDeviceFromBeach(deviceID, beachID string, at time.Time) error
+	GetDeviceAssignments(beachID string) ([]domain.DeviceAssignment, error)
+	SetBeachSensorAggregation(beachID, method string) error
 
 	GetTrailFromID(id string) (*domain.ExerciseTrail, error)
 	GetAllTrails() ([]domain.ExerciseTrail, error)
 	SetTrailOpenStatus(trailID string, isOpen bool) error
+	SetTrailStatusOverride(trailID string, override *domain.StatusOverride) error
+	SetTrailLightingSchedule(trailID string, schedule *domain.LightingSchedule) error
+	SetAreaLightingSchedule(area string, schedule *domain.LightingSchedule) error
 	UpdateTrailLastPreparationTime(trailID string, dateLastPreparation time.Time) error
+	GetTrailPreparationHistory(trailID string, from, to time.Time) ([]time.Time, error)
+	UpdateTrailAttributes(trailID string, update AttributeUpdate, overwrite bool) error
+	CreateTrail(trail domain.ExerciseTrail) error
+	DeleteTrail(trailID string) error
+
+	GetPlaygroundFromID(id string) (*domain.Playground, error)
+	GetAllPlaygrounds() ([]domain.Playground, error)
+
+	GetOutdoorGymFromID(id string) (*domain.OutdoorGym, error)
+	GetAllOutdoorGyms() ([]domain.OutdoorGym, error)
+
+	GetFireplaceFromID(id string) (*domain.Fireplace, error)
+	GetAllFireplaces() ([]domain.Fireplace, error)
+
+	GetSportsFieldFromID(id string) (*domain.SportsField, error)
+	GetAllSportsFields() ([]domain.SportsField, error)
+
+	AddChangeListener(listener ChangeListener)
+
+	GetDataQualityReport() ([]domain.DataQualityIssue, error)
+	UpdateBeachEnrichment(enrichment map[int64]BeachEnrichment) error
+	UpdateBeachAttributes(beachID string, update AttributeUpdate, overwrite bool) error
+}
+
+//Option configures optional behaviour of the datastore
+type Option func(*options)
+
+type options struct {
+	fieldMapping    FieldMapping
+	elevationModel  domain.ElevationModel
+	difficultyRules *DifficultyRules
+	trailSeasons    TrailSeasons
+	staleness       *WaterTemperatureStaleness
+	sensorIDPrefix  *string
+
+	localEntitiesPath      string
+	deviceRegistryPath     string
+	preparationHistoryPath string
+}
+
+//WithFieldMapping replaces the default mapping of source fields to domain attributes
+func WithFieldMapping(mapping FieldMapping) Option {
+	return func(opts *options) {
+		opts.fieldMapping = mapping
+	}
 }
 
 //NewDatabaseConnection does not open a new connection ...
-func NewDatabaseConnection(sourceURL, apiKey string, logger zerolog.Logger) (Datastore, error) {
+func NewDatabaseConnection(sourceURL, apiKey string, logger zerolog.Logger, opt ...Option) (Datastore, error) {
 	if sourceURL == "" || apiKey == "" {
 		return nil, fmt.Errorf("all environment variables must be set")
 	}
 
+	opts := &options{}
+	for _, o := range opt {
+		o(opts)
+	}
+
+	if opts.fieldMapping == nil {
+		mapping, err := ParseFieldMapping(defaultFieldMapping)
+		if err != nil {
+			return nil, err
+		}
+		opts.fieldMapping = mapping
+	}
+
+	if opts.difficultyRules == nil {
+		rules, err := ParseDifficultyRules(defaultDifficultyRules)
+		if err != nil {
+			return nil, err
+		}
+		opts.difficultyRules = &rules
+	}
+
+	if opts.trailSeasons == nil {
+		seasons, err := ParseTrailSeasons(defaultTrailSeasons)
+		if err != nil {
+			return nil, err
+		}
+		opts.trailSeasons = seasons
+	}
+
+	if opts.staleness == nil {
+		opts.staleness = &WaterTemperatureStaleness{MaxAge: DefaultWaterTemperatureMaxAge, Action: StaleWaterTemperatureFlag}
+	} else if err := opts.staleness.Validate(); err != nil {
+		return nil, err
+	}
+
+	if opts.sensorIDPrefix == nil {
+		prefix := DefaultSensorIDPrefix
+		opts.sensorIDPrefix = &prefix
+	}
+
 	logger.Info().Msgf("loading data from %s ...", sourceURL)
 
 	req, err := http.NewRequest("GET", sourceURL+"/list", nil)
@@ -95,36 +203,127 @@ func NewDatabaseConnection(sourceURL, apiKey string, logger zerolog.Logger) (Dat
 		return nil, fmt.Errorf("failed to unmarshal response from %s. (%s)", sourceURL, err.Error())
 	}
 
-	db := &myDB{}
+	db := &myDB{
+		sourceSensors:          map[string]*string{},
+		preparations:           map[string][]time.Time{},
+		trailStatuses:          map[string]*trailStatusInputs{},
+		trailSchedules:         map[string]domain.LightingSchedule{},
+		areaSchedules:          map[string]domain.LightingSchedule{},
+		elevationModel:         opts.elevationModel,
+		elevationProfiles:      map[string]elevationProfileEntry{},
+		difficultyRules:        *opts.difficultyRules,
+		givenDifficulties:      map[string]string{},
+		trailSeasons:           map[string]domain.Season{},
+		staleness:              *opts.staleness,
+		sensorIDPrefix:         *opts.sensorIDPrefix,
+		sensorReadings:         map[string]map[string]sensorReading{},
+		sensorAggregation:      map[string]string{},
+		localEntities:          map[string]bool{},
+		localEntitiesPath:      opts.localEntitiesPath,
+		deviceRegistryPath:     opts.deviceRegistryPath,
+		preparationHistoryPath: opts.preparationHistoryPath,
+		now:                    time.Now,
+		log:                    logger,
+	}
+
+	for category, sd := range opts.trailSeasons {
+		season, _ := sd.parse()
+		db.trailSeasons[category] = *season
+	}
 
 	for _, feature := range featureCollection.Features {
-		if feature.Properties.Published {
-			if feature.Properties.Type == "Strandbad" {
-				beach, err := parsePublishedBeach(logger, feature)
-				if err != nil {
-					logger.Error().Err(err).Msg("failed to parse strandbad")
-					continue
-				}
+		ftm, ok := opts.fieldMapping[feature.Properties.Type]
+		if !ok || !feature.Properties.Published {
+			continue
+		}
 
-				db.beaches = append(db.beaches, *beach)
-			} else if feature.Properties.Type == "Motionsspår" || feature.Properties.Type == "Skidspår" || feature.Properties.Type == "Långfärdsskridskoled" {
-				exerciseTrail, err := parsePublishedExerciseTrail(logger, feature)
-				if err != nil {
-					logger.Error().Err(err).Msg("failed to parse motionsspår")
-					continue
-				}
+		if ftm.Entity == "Beach" {
+			beach, err := parsePublishedBeach(logger, feature, ftm)
+			if err != nil {
+				logger.Error().Err(err).Msgf("failed to parse %s", strings.ToLower(feature.Properties.Type))
+				continue
+			}
+
+			if beach.SensorID != nil {
+				sensor := db.sensorIDPrefix + *beach.SensorID
+				beach.SensorID = &sensor
+				logger.Info().Msgf("assigning sensor %s to beach %s", sensor, beach.ID)
+			}
+
+			db.sourceSensors[beach.ID] = beach.SensorID
+			db.beaches = append(db.beaches, *beach)
+		} else if ftm.Entity == "ExerciseTrail" {
+			exerciseTrail, err := parsePublishedExerciseTrail(logger, feature, ftm)
+			if err != nil {
+				logger.Error().Err(err).Msgf("failed to parse %s", strings.ToLower(feature.Properties.Type))
+				continue
+			}
+
+			exerciseTrail.Source = fmt.Sprintf("%s/get/%d", sourceURL, feature.ID)
 
-				exerciseTrail.Source = fmt.Sprintf("%s/get/%d", sourceURL, feature.ID)
+			db.verifyTrailLength(exerciseTrail)
+			db.updateElevationProfile(exerciseTrail)
+			db.updateDifficulty(exerciseTrail, exerciseTrail.Difficulty)
 
-				db.trails = append(db.trails, *exerciseTrail)
+			db.trailStatuses[exerciseTrail.ID] = &trailStatusInputs{source: exerciseTrail.Status}
+			db.trails = append(db.trails, *exerciseTrail)
+		} else if ftm.Entity == "Playground" || ftm.Entity == "OutdoorGym" || ftm.Entity == "Fireplace" {
+			poi, err := parsePublishedPointOfInterest(logger, feature, ftm)
+			if err != nil {
+				logger.Error().Err(err).Msgf("failed to parse %s", strings.ToLower(feature.Properties.Type))
+				continue
 			}
+
+			poi.Source = fmt.Sprintf("%s/get/%d", sourceURL, feature.ID)
+
+			if ftm.Entity == "Playground" {
+				db.playgrounds = append(db.playgrounds, domain.Playground{PointOfInterest: *poi})
+			} else if ftm.Entity == "OutdoorGym" {
+				db.outdoorGyms = append(db.outdoorGyms, domain.OutdoorGym{PointOfInterest: *poi})
+			} else {
+				db.fireplaces = append(db.fireplaces, domain.Fireplace{PointOfInterest: *poi})
+			}
+		} else if ftm.Entity == "SportsField" {
+			sportsField, err := parsePublishedSportsField(logger, feature, ftm)
+			if err != nil {
+				logger.Error().Err(err).Msgf("failed to parse %s", strings.ToLower(feature.Properties.Type))
+				continue
+			}
+
+			sportsField.Source = fmt.Sprintf("%s/get/%d", sourceURL, feature.ID)
+
+			db.sportsFields = append(db.sportsFields, *sportsField)
 		}
 	}
 
+	enrichment, err := ParseBeachEnrichment(defaultBeachEnrichment)
+	if err != nil {
+		return nil, err
+	}
+
+	db.applyBeachEnrichment(enrichment)
+
+	//locally managed entities are loaded after the source, and their ids can not collide with source ids
+	err = db.loadLocalEntities()
+	if err != nil {
+		return nil, err
+	}
+
+	//devices can be assigned to local beaches, and local trails can be prepared, so these are loaded last
+	err = db.loadDeviceRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.loadPreparationHistory()
+	if err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
-func parsePublishedBeach(log zerolog.Logger, feature Feature) (*domain.Beach, error) {
+func parsePublishedBeach(log zerolog.Logger, feature Feature, ftm FacilityTypeMapping) (*domain.Beach, error) {
 	log.Info().Msgf("found published beach %d %s\n", feature.ID, feature.Properties.Name)
 
 	beach := &domain.Beach{
@@ -154,36 +353,51 @@ func parsePublishedBeach(log zerolog.Logger, feature Feature) (*domain.Beach, er
 		return nil, fmt.Errorf("failed to unmarshal geometry %s: %s", string(feature.Geometry.Coordinates), err.Error())
 	}
 
-	fields := []FeaturePropField{}
-	err = json.Unmarshal(feature.Properties.Fields, &fields)
+	fields, err := decodeMappedFields(log, feature, ftm, beach.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal property fields %s: %s", string(feature.Properties.Fields), err.Error())
+		return nil, err
 	}
 
+	contactPoint := domain.ContactPoint{}
+
 	for _, field := range fields {
-		if field.ID == 1 {
-			beach.Description = string(field.Value[1 : len(field.Value)-1])
-		} else if field.ID == 230 {
-			sensor := "se:servanet:lora:" + string(field.Value[1:len(field.Value)-1])
+		fd, value := field.definition, field.value
+
+		if fd.Attribute == "description" {
+			beach.Description = value.text
+		} else if fd.Attribute == "sensor" {
+			sensor := value.text
 			beach.SensorID = &sensor
-			log.Info().Msgf("assigning sensor %s to beach %s", sensor, beach.ID)
+		} else if fd.Attribute == "beachType" {
+			if value.toggle {
+				beach.BeachType = append(beach.BeachType, fd.Value)
+			}
+		} else if fd.Attribute == "facilities" {
+			if value.toggle {
+				beach.Facilities = append(beach.Facilities, fd.Value)
+			}
+		} else if fd.Attribute == "bookable" {
+			bookable := value.toggle
+			beach.Bookable = &bookable
+		} else if fd.Attribute == "openingHours" {
+			beach.OpeningHours = normalizeOpeningHours(value.text)
+		} else if fd.Attribute == "contactURL" {
+			contactPoint.URL = value.text
+		} else if fd.Attribute == "contactTelephone" {
+			contactPoint.Telephone = value.text
+		} else if fd.Attribute == "contactEmail" {
+			contactPoint.Email = value.text
 		}
 	}
 
-	if ref, ok := seeAlsoRefs[feature.ID]; ok {
-		if len(ref.nuts) > 0 {
-			beach.NUTSCode = &ref.nuts
-		}
-
-		if len(ref.wikidata) > 0 {
-			beach.WikidataID = &ref.wikidata
-		}
+	if contactPoint != (domain.ContactPoint{}) {
+		beach.ContactPoint = &contactPoint
 	}
 
 	return beach, nil
 }
 
-func parsePublishedExerciseTrail(log zerolog.Logger, feature Feature) (*domain.ExerciseTrail, error) {
+func parsePublishedExerciseTrail(log zerolog.Logger, feature Feature, ftm FacilityTypeMapping) (*domain.ExerciseTrail, error) {
 	log.Info().Msgf("found published exercise trail %d %s\n", feature.ID, feature.Properties.Name)
 
 	trail := &domain.ExerciseTrail{
@@ -219,36 +433,35 @@ func parsePublishedExerciseTrail(log zerolog.Logger, feature Feature) (*domain.E
 		return nil, fmt.Errorf("failed to unmarshal property fields %s: %s", string(feature.Properties.Fields), err.Error())
 	}
 
-	categories := []string{}
-
-	if feature.Properties.Type == "Långfärdsskridskoled" {
-		categories = append(categories, "ice-skating")
-	}
+	categories := append([]string{}, ftm.Categories...)
 
 	for _, field := range fields {
-		if field.ID == 99 {
-			length, _ := strconv.ParseInt(string(field.Value[0:len(field.Value)]), 10, 64)
-			trail.Length = float64(length) / 1000.0
-		} else if field.ID == 102 {
-			isOpen := string(field.Value[1 : len(field.Value)-1])
-			openStatus := map[string]string{"Ja": "open", "Nej": "closed"}
-			trail.Status = openStatus[isOpen]
-		} else if field.ID == 103 {
-			if propertyValueMatches(field, "Ja") {
-				categories = append(categories, "floodlit")
-			}
-		} else if field.ID == 110 {
-			trail.Description = string(field.Value[1 : len(field.Value)-1])
-		} else if field.ID == 134 {
-			trail.AreaServed = string(field.Value[1 : len(field.Value)-1])
-		} else if field.ID == 248 || field.ID == 250 {
-			if propertyValueMatches(field, "Ja") {
-				categories = append(categories, "ski-classic")
-			}
-		} else if field.ID == 249 || field.ID == 251 {
-			if propertyValueMatches(field, "Ja") {
-				categories = append(categories, "ski-skate")
+		fd, ok := ftm.definitionFor(field.ID)
+		if !ok {
+			continue
+		}
+
+		value, err := fd.decode(field.Value)
+		if err != nil {
+			log.Warn().Err(err).Msgf("ignoring %s of trail %s", fd.Attribute, trail.ID)
+			continue
+		}
+
+		if fd.Attribute == "length" {
+			trail.Length = float64(value.number) / 1000.0
+		} else if fd.Attribute == "status" {
+			openStatus := map[bool]string{true: TrailStatusOpen, false: TrailStatusClosed}
+			trail.Status = openStatus[value.toggle]
+		} else if fd.Attribute == "category" {
+			if value.toggle {
+				categories = append(categories, fd.Value)
 			}
+		} else if fd.Attribute == "description" {
+			trail.Description = value.text
+		} else if fd.Attribute == "areaServed" {
+			trail.AreaServed = value.text
+		} else if fd.Attribute == "difficulty" {
+			trail.Difficulty = value.text
 		}
 	}
 
@@ -256,155 +469,449 @@ func parsePublishedExerciseTrail(log zerolog.Logger, feature Feature) (*domain.E
 		trail.Category = categories
 	}
 
+	trail.ComputedLength = trail.Geometry.Length() / 1000.0
+
 	return trail, nil
 }
 
-func propertyValueMatches(field FeaturePropField, expectation string) bool {
-	value := string(field.Value[0:len(field.Value)])
-	return value == expectation || value == ("\""+expectation+"\"")
-}
-
-type extraInfo struct {
-	nuts     string
-	wikidata string
-	sensorID string
-}
-
-var seeAlsoRefs map[int64]extraInfo = map[int64]extraInfo{
-	// Slädaviken
-	283: {nuts: "SE0712281000003473", sensorID: "sk-elt-temp-21", wikidata: "Q10671745"},
-	// Hartungviken
-	284: {nuts: "SE0712281000003472", sensorID: "sk-elt-temp-28", wikidata: "Q680645"},
-	// Tranviken
-	295: {nuts: "SE0712281000003474", sensorID: "sk-elt-temp-22", wikidata: "Q106657132"},
-	// Bänkåsviken
-	315: {nuts: "SE0712281000003471", sensorID: "sk-elt-temp-26", wikidata: "Q106657054"},
-	// Stekpannan, Hornsjön
-	322: {nuts: "SE0712281000003478", sensorID: "sk-elt-temp-17", wikidata: "Q106710721"},
-	// Dyket
-	323: {nuts: "SE0712281000003477", sensorID: "sk-elt-temp-02", wikidata: "Q106710719"},
-	// Fläsian, Nord
-	337: {nuts: "SE0712281000003450", sensorID: "sk-elt-temp-25"},
-	// Sodom
-	357: {nuts: "SE0712281000003479", sensorID: "sk-elt-temp-27", wikidata: "Q106710722"},
-	// Rännö
-	414: {nuts: "SE0712281000003464", sensorID: "sk-elt-temp-08", wikidata: "Q106710690"},
-	// Lucksta
-	421: {nuts: "SE0712281000003461", sensorID: "sk-elt-temp-10", wikidata: "Q106710684"},
-	// Norrhassel
-	430: {nuts: "SE0712281000003462", sensorID: "sk-elt-temp-13", wikidata: "Q106710685"},
-	// Viggesand
-	442: {nuts: "SE0712281000003469", sensorID: "sk-elt-temp-12", wikidata: "Q106710700"},
-	// Räveln
-	456: {nuts: "SE0712281000003468", sensorID: "sk-elt-temp-19", wikidata: "Q106710698"},
-	// Segersjön
-	469: {nuts: "SE0712281000003452", sensorID: "sk-elt-temp-09", wikidata: "Q106710670"},
-	// Vången
-	488: {nuts: "SE0712281000003470", sensorID: "sk-elt-temp-16", wikidata: "Q106710701"},
-	// Edeforsens badplats
-	495: {nuts: "SE0712281000003467", sensorID: "sk-elt-temp-04", wikidata: "Q106710696"},
-	// Pallviken
-	513: {nuts: "SE0712281000003463", sensorID: "sk-elt-temp-11", wikidata: "Q106710688"},
-	// Östtjärn
-	526: {nuts: "SE0712281000003466", sensorID: "sk-elt-temp-18", wikidata: "Q106710694"},
-	// Bergafjärden
-	553: {nuts: "SE0712281000003475", sensorID: "sk-elt-temp-24", wikidata: "Q16498519"},
-	// Brudsjön
-	560: {nuts: "SE0712281000003455", sensorID: "sk-elt-temp-03", wikidata: "Q106710675"},
-	// Sandnäset
-	656: {nuts: "SE0712281000003459", sensorID: "sk-elt-temp-14", wikidata: "Q106710678"},
-	657: {sensorID: "sk-elt-temp-07"}, // Abborrviken, Sidsjön
-	// Västbyn
-	658: {nuts: "SE0712281000003460", sensorID: "sk-elt-temp-15", wikidata: "Q106710681"},
-	// Väster-Lövsjön
-	659: {nuts: "SE0712281000003453", sensorID: "sk-elt-temp-05", wikidata: "Q106710672"},
-	// Sidsjöns hundbad
-	660: {nuts: "SE0712281000004229", sensorID: "sk-elt-temp-01"},
-	// Kävstabadet, Indal
-	897: {nuts: "SE0712281000003456", wikidata: "Q106710677"},
-	// Bredsand
-	1234: {nuts: "SE0712281000003476", sensorID: "sk-elt-temp-23", wikidata: "Q106710717"},
-	// Bjässjön
-	1618: {nuts: "SE0712281000003454", sensorID: "sk-elt-temp-06", wikidata: "Q106947945"},
-	// Fläsian, Syd
-	1631: {nuts: "SE0712281000003480", sensorID: "sk-elt-temp-20"},
+func parsePublishedPointOfInterest(log zerolog.Logger, feature Feature, ftm FacilityTypeMapping) (*domain.PointOfInterest, error) {
+	poi, _, err := parsePointOfInterestAndFields(log, feature, ftm)
+	return poi, err
+}
+
+//parsePointOfInterestAndFields parses the attributes shared by point like facilities, and returns the
+//decoded fields so that facility types with more attributes do not have to decode them again
+func parsePointOfInterestAndFields(log zerolog.Logger, feature Feature, ftm FacilityTypeMapping) (*domain.PointOfInterest, []mappedField, error) {
+	log.Info().Msgf("found published %s %d %s\n", strings.ToLower(feature.Properties.Type), feature.ID, feature.Properties.Name)
+
+	poi := &domain.PointOfInterest{
+		ID:          fmt.Sprintf("%s%d", SundsvallAnlaggningPrefix, feature.ID),
+		Name:        feature.Properties.Name,
+		Description: "",
+	}
+
+	var timeFormat string = "2006-01-02 15:04:05"
+
+	if feature.Properties.Created != nil {
+		created, err := time.Parse(timeFormat, *feature.Properties.Created)
+		if err == nil {
+			poi.DateCreated = created.UTC()
+		}
+	}
+
+	if feature.Properties.Updated != nil {
+		modified, err := time.Parse(timeFormat, *feature.Properties.Updated)
+		if err == nil {
+			poi.DateModified = modified.UTC()
+		}
+	}
+
+	if feature.Geometry.Type == "Point" {
+		err := json.Unmarshal(feature.Geometry.Coordinates, &poi.Location.Coordinates)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal geometry %s: %s", string(feature.Geometry.Coordinates), err.Error())
+		}
+	} else if feature.Geometry.Type == "MultiPolygon" {
+		area := domain.MultiPolygon{}
+		err := json.Unmarshal(feature.Geometry.Coordinates, &area.Lines)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal geometry %s: %s", string(feature.Geometry.Coordinates), err.Error())
+		}
+		poi.Location = area.Centroid()
+	} else {
+		return nil, nil, fmt.Errorf("unsupported geometry type %s", feature.Geometry.Type)
+	}
+
+	if len(poi.Location.Coordinates) < 2 {
+		return nil, nil, fmt.Errorf("feature %d has no valid location", feature.ID)
+	}
+
+	fields, err := decodeMappedFields(log, feature, ftm, poi.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, field := range fields {
+		if field.definition.Attribute == "description" {
+			poi.Description = field.value.text
+		}
+	}
+
+	return poi, fields, nil
+}
+
+func parsePublishedSportsField(log zerolog.Logger, feature Feature, ftm FacilityTypeMapping) (*domain.SportsField, error) {
+	poi, fields, err := parsePointOfInterestAndFields(log, feature, ftm)
+	if err != nil {
+		return nil, err
+	}
+
+	sportsField := &domain.SportsField{PointOfInterest: *poi}
+	categories := append([]string{}, ftm.Categories...)
+
+	for _, field := range fields {
+		if field.definition.Attribute == "category" {
+			if field.value.toggle {
+				categories = append(categories, field.definition.Value)
+			}
+		} else if field.definition.Attribute == "surface" {
+			sportsField.Surface = field.value.text
+		} else if field.definition.Attribute == "bookable" {
+			bookable := field.value.toggle
+			sportsField.Bookable = &bookable
+		} else if field.definition.Attribute == "openingHours" {
+			sportsField.OpeningHours = normalizeOpeningHours(field.value.text)
+		}
+	}
+
+	if len(categories) > 0 {
+		sportsField.Category = categories
+	}
+
+	return sportsField, nil
+}
+
+//normalizeOpeningHours translates well known availability values to opening hours
+func normalizeOpeningHours(availability string) []string {
+	openingHours := map[string]string{"Hela dygnet": "Mo-Su 00:00-24:00"}
+	if hours, ok := openingHours[availability]; ok {
+		return []string{hours}
+	}
+	return []string{availability}
+}
+
+type mappedField struct {
+	definition *FieldDefinition
+	value      fieldValue
+}
+
+//decodeMappedFields returns the values of all fields that are present in the facility type mapping
+func decodeMappedFields(log zerolog.Logger, feature Feature, ftm FacilityTypeMapping, entityID string) ([]mappedField, error) {
+	fields := []FeaturePropField{}
+	err := json.Unmarshal(feature.Properties.Fields, &fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal property fields %s: %s", string(feature.Properties.Fields), err.Error())
+	}
+
+	result := []mappedField{}
+
+	for _, field := range fields {
+		fd, ok := ftm.definitionFor(field.ID)
+		if !ok {
+			continue
+		}
+
+		value, err := fd.decode(field.Value)
+		if err != nil {
+			log.Warn().Err(err).Msgf("ignoring %s of %s", fd.Attribute, entityID)
+			continue
+		}
+
+		result = append(result, mappedField{definition: fd, value: value})
+	}
+
+	return result, nil
 }
 
 type myDB struct {
-	beaches []domain.Beach
-	trails  []domain.ExerciseTrail
+	mu sync.RWMutex
+
+	beaches                []domain.Beach
+	trails                 []domain.ExerciseTrail
+	playgrounds            []domain.Playground
+	outdoorGyms            []domain.OutdoorGym
+	fireplaces             []domain.Fireplace
+	sportsFields           []domain.SportsField
+	issues                 []domain.DataQualityIssue
+	sourceSensors          map[string]*string
+	preparations           map[string][]time.Time
+	trailStatuses          map[string]*trailStatusInputs
+	trailSchedules         map[string]domain.LightingSchedule
+	areaSchedules          map[string]domain.LightingSchedule
+	elevationModel         domain.ElevationModel
+	elevationProfiles      map[string]elevationProfileEntry
+	difficultyRules        DifficultyRules
+	givenDifficulties      map[string]string
+	trailSeasons           map[string]domain.Season
+	staleness              WaterTemperatureStaleness
+	sensorIDPrefix         string
+	assignments            []domain.DeviceAssignment
+	sensorReadings         map[string]map[string]sensorReading
+	sensorAggregation      map[string]string
+	localEntities          map[string]bool
+	localEntitiesPath      string
+	deviceRegistryPath     string
+	preparationHistoryPath string
+	listeners              []ChangeListener
+	now                    func() time.Time
+	log                    zerolog.Logger
+}
+
+func (db *myDB) applyBeachEnrichment(enrichment map[int64]BeachEnrichment) {
+	for idx, beach := range db.beaches {
+		beach.NUTSCode = nil
+		beach.WikidataID = nil
+		beach.SensorID = db.sourceSensors[beach.ID]
+
+		facilityID, _ := strconv.ParseInt(strings.TrimPrefix(beach.ID, SundsvallAnlaggningPrefix), 10, 64)
+
+		if be, ok := enrichment[facilityID]; ok {
+			if be.NUTSCode != "" {
+				nuts := be.NUTSCode
+				beach.NUTSCode = &nuts
+			}
+
+			if be.WikidataID != "" {
+				wikidata := be.WikidataID
+				beach.WikidataID = &wikidata
+			}
+
+			if be.SensorID != "" && (be.OverrideSensor || beach.SensorID == nil) {
+				sensor := db.sensorIDPrefix + be.SensorID
+				beach.SensorID = &sensor
+				db.log.Info().Msgf("assigning sensor %s to beach %s from enrichment", sensor, beach.ID)
+			}
+		}
+
+		db.beaches[idx] = beach
+	}
+}
+
+func (db *myDB) UpdateBeachEnrichment(enrichment map[int64]BeachEnrichment) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.applyBeachEnrichment(enrichment)
+
+	for _, beach := range db.beaches {
+		db.notifyBeachChanged(beach.ID)
+	}
+
+	return nil
+}
+
+func (db *myDB) verifyTrailLength(trail *domain.ExerciseTrail) {
+	if trail.Length == 0 {
+		trail.Length = trail.ComputedLength
+		db.issues = append(db.issues, domain.DataQualityIssue{
+			EntityID:  trail.ID,
+			Attribute: "length",
+			Message:   fmt.Sprintf("declared length is missing, using computed length %.3f km", trail.ComputedLength),
+		})
+		return
+	}
+
+	deviation := math.Abs(trail.Length-trail.ComputedLength) / trail.Length
+	if deviation > TrailLengthDeviationThreshold {
+		db.issues = append(db.issues, domain.DataQualityIssue{
+			EntityID:  trail.ID,
+			Attribute: "length",
+			Message: fmt.Sprintf(
+				"declared length %.3f km differs from computed length %.3f km by %.0f%%",
+				trail.Length, trail.ComputedLength, deviation*100,
+			),
+		})
+	}
+}
+
+func (db *myDB) GetDataQualityReport() ([]domain.DataQualityIssue, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return append(append([]domain.DataQualityIssue{}, db.issues...), db.staleWaterTemperatureIssues()...), nil
 }
 
 func (db *myDB) GetAllBeaches() ([]domain.Beach, error) {
-	return db.beaches, nil
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	beaches := []domain.Beach{}
+	for _, beach := range db.beaches {
+		beaches = append(beaches, db.withWaterTemperatureStaleness(db.withActiveSensors(beach)))
+	}
+
+	return beaches, nil
 }
 
 func (db *myDB) GetAllTrails() ([]domain.ExerciseTrail, error) {
-	return db.trails, nil
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	trails := []domain.ExerciseTrail{}
+	for _, trail := range db.trails {
+		trails = append(trails, db.withLightingSchedule(db.withEffectiveStatus(trail)))
+	}
+
+	return trails, nil
 }
 
 func (db *myDB) GetBeachFromID(id string) (*domain.Beach, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
 	for _, poi := range db.beaches {
 		if strings.Compare(poi.ID, id) == 0 {
-			return &poi, nil
+			beach := db.withWaterTemperatureStaleness(db.withActiveSensors(poi))
+			return &beach, nil
 		}
 	}
 	return nil, errors.New("not found")
 }
 
 func (db *myDB) GetTrailFromID(id string) (*domain.ExerciseTrail, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
 	for _, trail := range db.trails {
 		if strings.Compare(trail.ID, id) == 0 {
+			trail = db.withLightingSchedule(db.withEffectiveStatus(trail))
 			return &trail, nil
 		}
 	}
 	return nil, errors.New("not found")
 }
 
-func (db *myDB) SetTrailOpenStatus(trailID string, isOpen bool) error {
-	for idx, trail := range db.trails {
-		if strings.Compare(trail.ID, trailID) == 0 {
-			status := "closed"
-			if isOpen {
-				status = "open"
-			}
-			db.trails[idx].Status = status
-			return nil
+func (db *myDB) GetAllPlaygrounds() ([]domain.Playground, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return append([]domain.Playground{}, db.playgrounds...), nil
+}
+
+func (db *myDB) GetPlaygroundFromID(id string) (*domain.Playground, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, playground := range db.playgrounds {
+		if strings.Compare(playground.ID, id) == 0 {
+			return &playground, nil
 		}
 	}
+	return nil, errors.New("not found")
+}
 
-	return errors.New("not found")
+func (db *myDB) GetAllOutdoorGyms() ([]domain.OutdoorGym, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return append([]domain.OutdoorGym{}, db.outdoorGyms...), nil
 }
 
+func (db *myDB) GetOutdoorGymFromID(id string) (*domain.OutdoorGym, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, gym := range db.outdoorGyms {
+		if strings.Compare(gym.ID, id) == 0 {
+			return &gym, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (db *myDB) GetAllFireplaces() ([]domain.Fireplace, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return append([]domain.Fireplace{}, db.fireplaces...), nil
+}
+
+func (db *myDB) GetFireplaceFromID(id string) (*domain.Fireplace, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, fireplace := range db.fireplaces {
+		if strings.Compare(fireplace.ID, id) == 0 {
+			return &fireplace, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (db *myDB) GetAllSportsFields() ([]domain.SportsField, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return append([]domain.SportsField{}, db.sportsFields...), nil
+}
+
+func (db *myDB) GetSportsFieldFromID(id string) (*domain.SportsField, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, sportsField := range db.sportsFields {
+		if strings.Compare(sportsField.ID, id) == 0 {
+			return &sportsField, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+//UpdateTrailLastPreparationTime records a preparation event for a trail. Events that predate the
+//last preparation are added to the history without changing the date of the last preparation.
 func (db *myDB) UpdateTrailLastPreparationTime(trailID string, dateLastPreparation time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	for idx, trail := range db.trails {
 		if strings.Compare(trail.ID, trailID) == 0 {
-			if trail.DateLastPrepared.After(dateLastPreparation) {
-				return fmt.Errorf("last preparation date may not move backwards")
+			if !db.recordPreparation(trailID, dateLastPreparation) {
+				return nil
 			}
 
-			db.trails[idx].DateLastPrepared = dateLastPreparation
+			if dateLastPreparation.After(trail.DateLastPrepared) {
+				db.trails[idx].DateLastPrepared = dateLastPreparation
+				db.notifyTrailChanged(trailID)
+			}
 
-			return nil
+			return db.savePreparationHistory()
 		}
 	}
 
 	return errors.New("not found")
 }
 
-func (db *myDB) UpdateWaterTemperatureFromDeviceID(device string, temp float64, observedAt time.Time) (string, error) {
+//recordPreparation adds a preparation event to the history of a trail, and reports if it was not already there
+func (db *myDB) recordPreparation(trailID string, preparedAt time.Time) bool {
+	history := db.preparations[trailID]
 
-	for idx, poi := range db.beaches {
-		if poi.SensorID != nil && *poi.SensorID == device {
-			if observedAt.After(poi.DateModified) {
-				db.beaches[idx].WaterTemperature = &temp
-				db.beaches[idx].DateModified = time.Now().UTC()
-				return poi.ID, nil
-			} else {
-				return poi.ID, fmt.Errorf("ignored temperature update that predates datemodified of %s", poi.ID)
+	idx := sort.Search(len(history), func(i int) bool {
+		return !history[i].Before(preparedAt)
+	})
+
+	if idx < len(history) && history[idx].Equal(preparedAt) {
+		return false
+	}
+
+	history = append(history, time.Time{})
+	copy(history[idx+1:], history[idx:])
+	history[idx] = preparedAt
+
+	if len(history) > MaxPreparationHistoryLength {
+		history = history[len(history)-MaxPreparationHistoryLength:]
+	}
+
+	db.preparations[trailID] = history
+	return true
+}
+
+func (db *myDB) GetTrailPreparationHistory(trailID string, from, to time.Time) ([]time.Time, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, trail := range db.trails {
+		if strings.Compare(trail.ID, trailID) == 0 {
+			events := []time.Time{}
+
+			for _, preparedAt := range db.preparations[trailID] {
+				if (from.IsZero() || !preparedAt.Before(from)) && (to.IsZero() || preparedAt.Before(to)) {
+					events = append(events, preparedAt)
+				}
 			}
+
+			return events, nil
 		}
 	}
 
-	return "", fmt.Errorf("no beach found matching sensor ID %s", device)
+	return nil, errors.New("not found")
 }
@@ -1,15 +1,20 @@
 package database
 
 import (
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+
 	"github.com/matryer/is"
 )
 
@@ -152,3 +157,709 @@ func setupMockServiceThatReturns(responseCode int, body string) *httptest.Server
 		}
 	}))
 }
+
+func TestTrailLengthIsComputedFromGeometry(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	db, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	trail, err := db.GetTrailFromID(SundsvallAnlaggningPrefix + "703")
+	is.NoErr(err)
+	is.Equal(trail.Length, 4.7)
+	is.True(trail.ComputedLength > 4.5 && trail.ComputedLength < 4.9) // computed length should be close to the declared 4.7 km
+
+	report, err := db.GetDataQualityReport()
+	is.NoErr(err)
+
+	for _, issue := range report {
+		is.True(issue.EntityID != trail.ID) // trail should not be reported when lengths match
+	}
+}
+
+func TestBeachEnrichmentCanOverrideSensor(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	db, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	enrichment, err := ParseBeachEnrichment([]byte(`{"1545": {"nuts": "SE0712281000003499", "wikidata": "Q1", "sensorID": "sk-elt-temp-99", "overrideSensor": true}}`))
+	is.NoErr(err)
+
+	err = db.UpdateBeachEnrichment(enrichment)
+	is.NoErr(err)
+
+	beach, err := db.GetBeachFromID(SundsvallAnlaggningPrefix + "1545")
+	is.NoErr(err)
+	is.Equal(*beach.NUTSCode, "SE0712281000003499")
+	is.Equal(*beach.SensorID, "se:servanet:lora:sk-elt-temp-99")
+
+	err = db.UpdateBeachEnrichment(map[int64]BeachEnrichment{})
+	is.NoErr(err)
+
+	beach, _ = db.GetBeachFromID(SundsvallAnlaggningPrefix + "1545")
+	is.True(beach.NUTSCode == nil)                               // nuts code should be removed with the enrichment
+	is.Equal(*beach.SensorID, "se:servanet:lora:sk-elt-temp-01") // sensor from source should be restored
+}
+
+func TestThatInvalidBeachEnrichmentIsRejected(t *testing.T) {
+	is := is.New(t)
+
+	_, err := ParseBeachEnrichment([]byte(`{"283": {"wikidata": "not-a-wikidata-id"}}`))
+	is.True(err != nil) // invalid wikidata id should be rejected
+
+	_, err = ParseBeachEnrichment(defaultBeachEnrichment)
+	is.NoErr(err) // default enrichment should be valid
+}
+
+func TestThatTrailAttributesAreMappedFromFields(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	ds, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	db := ds.(*myDB)
+	db.now = func() time.Time { return time.Date(2022, 1, 15, 12, 0, 0, 0, time.UTC) } // during the ski season
+
+	trail, err := db.GetTrailFromID(SundsvallAnlaggningPrefix + "703")
+	is.NoErr(err)
+	is.Equal(trail.Status, "open")
+	is.Equal(trail.AreaServed, "Motionsspår Södra spårområdet")
+	is.Equal(trail.Category, []string{"floodlit", "ski-classic", "ski-skate"})
+}
+
+func TestThatIceSkatingTrailsAreMappedFromFields(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, `{"type":"FeatureCollection","features":[
+		{"id":4001,"type":"Feature","properties":{"name":"Skridskoleden","type":"Långfärdsskridskoled","published":true,"fields":[
+			{"id":99,"name":"Längd","type":"INTEGER","value":"12000"},{"id":103,"name":"Belysning","type":"TOGGLE","value":"Ja"},
+			{"id":248,"name":"Klassisk","type":"TOGGLE","value":"Ja"},{"id":251,"name":"Skate","type":"TOGGLE","value":"Ja"}]},
+		"geometry":{"type":"LineString","coordinates":[[17.30,62.39],[17.31,62.40]]}}]}`)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	db, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	trail, err := db.GetTrailFromID(SundsvallAnlaggningPrefix + "4001")
+	is.NoErr(err)
+	is.Equal(trail.Length, 12.0)
+	is.Equal(trail.Category, []string{"ice-skating", "floodlit", "ski-classic", "ski-skate"})
+}
+
+func TestThatFieldMappingWithUnknownAttributeIsRejected(t *testing.T) {
+	is := is.New(t)
+
+	_, err := ParseFieldMapping([]byte(`{"Strandbad": {"entity": "Beach", "fields": [{"id": 1, "type": "FREETEXT", "attribute": "colour"}]}}`))
+	is.True(err != nil) // unknown attribute should be rejected
+
+	_, err = ParseFieldMapping([]byte(`{"Skidspår": {"entity": "ExerciseTrail", "fields": [{"id": 99, "type": "FREETEXT", "attribute": "length"}]}}`))
+	is.True(err != nil) // length must be mapped from an integer field
+}
+
+func TestThatPlaygroundsAreLoaded(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, `{"type":"FeatureCollection","features":[
+		{"id":2001,"type":"Feature","properties":{"name":"Lekplatsen","type":"Lekplats","published":true,"fields":[{"id":1,"name":"Beskrivning","type":"FREETEXT","value":"En lekplats"}]},
+		"geometry":{"type":"Point","coordinates":[17.3069,62.3908]}}]}`)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	db, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	playground, err := db.GetPlaygroundFromID(SundsvallAnlaggningPrefix + "2001")
+	is.NoErr(err)
+	is.Equal(playground.Description, "En lekplats")
+	is.Equal(playground.Location.Coordinates, []float64{17.3069, 62.3908})
+}
+
+func TestThatSportsFieldsAreLoaded(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, `{"type":"FeatureCollection","features":[
+		{"id":3001,"type":"Feature","properties":{"name":"Konstgräsplanen","type":"Fotbollsplan","published":true,"fields":[
+			{"id":103,"name":"Belysning","type":"TOGGLE","value":"Ja"},{"id":125,"name":"Underlag","type":"DROPDOWN","value":"Konstgräs"},
+			{"id":153,"name":"Allmänt tillgänglig","type":"DROPDOWN","value":"Hela dygnet"},{"id":154,"name":"Bokningsbar","type":"TOGGLE","value":"Ja"}]},
+		"geometry":{"type":"MultiPolygon","coordinates":[[[[17.30,62.39],[17.31,62.39],[17.31,62.40],[17.30,62.40]]]]}}]}`)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	db, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	sportsField, err := db.GetSportsFieldFromID(SundsvallAnlaggningPrefix + "3001")
+	is.NoErr(err)
+	is.Equal(sportsField.Category, []string{"football", "floodlit"})
+	is.Equal(sportsField.Surface, "Konstgräs")
+	is.True(*sportsField.Bookable)
+	is.Equal(sportsField.OpeningHours, []string{"Mo-Su 00:00-24:00"})
+}
+
+func TestThatBeachAmenitiesAreMappedFromFields(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	db, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	beach, err := db.GetBeachFromID(SundsvallAnlaggningPrefix + "1545")
+	is.NoErr(err)
+	is.Equal(len(beach.BeachType), 0) // beach is neither sandy, rocky nor shallow
+	is.True(!*beach.Bookable)
+	is.Equal(beach.OpeningHours, []string{"Mo-Su 00:00-24:00"})
+	is.Equal(beach.ContactPoint.URL, "https://www.facebook.com/Badarna/")
+	is.Equal(beach.ContactPoint.Telephone, "060-XX XX XX")
+	is.Equal(beach.ContactPoint.Email, "felanmelan@dev.null")
+
+	sandyAndShallow := strings.Replace(response, `{"id":29,"name":"Sandstrand","type":"TOGGLE","value":"Nej"}`, `{"id":29,"name":"Sandstrand","type":"TOGGLE","value":"Ja"}`, 1)
+	sandyAndShallow = strings.Replace(sandyAndShallow, `{"id":33,"name":"Långgrunt","type":"TOGGLE","value":"Nej"}`, `{"id":33,"name":"Långgrunt","type":"TOGGLE","value":"Ja"}`, 1)
+	otherServer := setupMockServiceThatReturns(200, sandyAndShallow)
+
+	db, err = NewDatabaseConnection(otherServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	beach, err = db.GetBeachFromID(SundsvallAnlaggningPrefix + "1545")
+	is.NoErr(err)
+	is.Equal(beach.BeachType, []string{"sandy", "shallow"}) // fields 29 and 33 are set
+}
+
+func TestThatTrailPreparationHistoryIsRecorded(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	db, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	trailID := SundsvallAnlaggningPrefix + "1211"
+	first := time.Date(2021, 12, 1, 6, 0, 0, 0, time.UTC)
+	second := time.Date(2021, 12, 3, 6, 0, 0, 0, time.UTC)
+
+	is.NoErr(db.UpdateTrailLastPreparationTime(trailID, second))
+	is.NoErr(db.UpdateTrailLastPreparationTime(trailID, second)) // repeated polls should not add events
+	is.NoErr(db.UpdateTrailLastPreparationTime(trailID, first))  // older events should be added to the history
+
+	history, err := db.GetTrailPreparationHistory(trailID, time.Time{}, time.Time{})
+	is.NoErr(err)
+	is.Equal(history, []time.Time{first, second})
+
+	trail, _ := db.GetTrailFromID(trailID)
+	is.Equal(trail.DateLastPrepared, second) // last preparation should not move backwards
+}
+
+func TestThatTrailPreparationHistoryIsKeptAcrossRestarts(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	path := filepath.Join(t.TempDir(), "preparations.json")
+
+	db, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger(), WithPreparationHistoryPath(path))
+	is.NoErr(err)
+
+	trailID := SundsvallAnlaggningPrefix + "1211"
+	first := time.Date(2021, 12, 1, 6, 0, 0, 0, time.UTC)
+	second := time.Date(2021, 12, 3, 6, 0, 0, 0, time.UTC)
+
+	is.NoErr(db.UpdateTrailLastPreparationTime(trailID, second))
+	is.NoErr(db.UpdateTrailLastPreparationTime(trailID, first))
+
+	db, err = NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger(), WithPreparationHistoryPath(path))
+	is.NoErr(err)
+
+	history, err := db.GetTrailPreparationHistory(trailID, time.Time{}, time.Time{})
+	is.NoErr(err)
+	is.Equal(history, []time.Time{first, second})
+
+	trail, _ := db.GetTrailFromID(trailID)
+	is.Equal(trail.DateLastPrepared, second) // the last preparation should be restored from the history
+}
+
+func TestThatTrailStatusFollowsSeasonAndOverrides(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	ds, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	db := ds.(*myDB)
+	trailID := SundsvallAnlaggningPrefix + "1211"
+
+	db.now = func() time.Time { return time.Date(2022, 1, 15, 12, 0, 0, 0, time.UTC) }
+	is.NoErr(db.SetTrailOpenStatus(trailID, true))
+
+	trail, _ := db.GetTrailFromID(trailID)
+	is.Equal(trail.Status, "open") // feed should take precedence over the source during the season
+
+	db.now = func() time.Time { return time.Date(2022, 7, 15, 12, 0, 0, 0, time.UTC) }
+
+	trail, _ = db.GetTrailFromID(trailID)
+	is.Equal(trail.Status, "closed") // ski trails should be closed outside of the season
+	is.Equal(trail.StatusReason, "out of season (12-01 to 03-31)")
+
+	is.NoErr(db.SetTrailStatusOverride(trailID, &domain.StatusOverride{Status: "open", Reason: "roller ski event"}))
+
+	trail, _ = db.GetTrailFromID(trailID)
+	is.Equal(trail.Status, "open") // manual override should take precedence over the season
+	is.Equal(trail.StatusReason, "manual override: roller ski event")
+
+	trail, _ = db.GetTrailFromID(SundsvallAnlaggningPrefix + "703")
+	is.Equal(trail.Status, "closed") // the season follows the categories of a trail, not its facility type
+}
+
+func TestThatTrailSeasonsAreKeyedByCategory(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	seasons, err := ParseTrailSeasons([]byte(`{"ski-classic": {"from": "12-01", "to": "03-31"}, "floodlit": {"from": "10-01", "to": "04-30"}}`))
+	is.NoErr(err)
+
+	_, err = ParseTrailSeasons([]byte(`{"ski-classic": {"from": "december", "to": "03-31"}}`))
+	is.True(err != nil) // seasons must use MM-DD dates
+
+	ds, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger(), WithTrailSeasons(seasons))
+	is.NoErr(err)
+
+	db := ds.(*myDB)
+	db.now = func() time.Time { return time.Date(2022, 4, 15, 12, 0, 0, 0, time.UTC) }
+
+	trail, _ := db.GetTrailFromID(SundsvallAnlaggningPrefix + "703")
+	is.Equal(trail.Status, "open") // within the season of one of the categories
+
+	db.now = func() time.Time { return time.Date(2022, 7, 15, 12, 0, 0, 0, time.UTC) }
+
+	trail, _ = db.GetTrailFromID(SundsvallAnlaggningPrefix + "703")
+	is.Equal(trail.Status, "closed")
+	is.Equal(trail.StatusReason, "out of season (10-01 to 04-30)") // the season of the first category
+
+	trail, _ = db.GetTrailFromID(SundsvallAnlaggningPrefix + "1211")
+	is.Equal(trail.StatusReason, "out of season (12-01 to 03-31)") // ski-skate has no season of its own here
+
+	db.now = func() time.Time { return time.Date(2022, 4, 15, 12, 0, 0, 0, time.UTC) }
+
+	trail, _ = db.GetTrailFromID(SundsvallAnlaggningPrefix + "1211")
+	is.Equal(trail.StatusReason, "out of season (12-01 to 03-31)") // 1211 is not floodlit
+}
+
+func TestThatTrailLightingScheduleTakesPrecedenceOverArea(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	db, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	trailID := SundsvallAnlaggningPrefix + "703"
+
+	is.NoErr(db.SetAreaLightingSchedule("Motionsspår Södra spårområdet", &domain.LightingSchedule{From: "sunset", To: "22:00"}))
+	trail, _ := db.GetTrailFromID(trailID)
+	is.Equal(trail.LightingSchedule.From, "sunset") // area schedule should apply to floodlit trails in the area
+
+	is.NoErr(db.SetTrailLightingSchedule(trailID, &domain.LightingSchedule{From: "06:00", To: "23:00"}))
+	trail, _ = db.GetTrailFromID(trailID)
+	is.Equal(trail.LightingSchedule.From, "06:00") // trail schedule should take precedence
+
+	is.True(db.SetTrailLightingSchedule(trailID, &domain.LightingSchedule{From: "dusk", To: "23:00"}) != nil)
+}
+
+type flatElevationModel struct {
+	calls int
+}
+
+func (m *flatElevationModel) ElevationAt(position []float64) (float64, bool) {
+	m.calls++
+	return 42, true
+}
+
+func TestThatElevationProfileIsOnlyRecomputedWhenGeometryChanges(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	model := &flatElevationModel{}
+	ds, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger(), WithElevationModel(model))
+	is.NoErr(err)
+
+	trail, err := ds.GetTrailFromID(SundsvallAnlaggningPrefix + "703")
+	is.NoErr(err)
+	is.True(trail.Elevation != nil)
+	is.Equal(trail.Elevation.TotalAscent, 0.0)
+	is.Equal(trail.Elevation.MaxElevation, 42.0)
+
+	db := ds.(*myDB)
+	calls := model.calls
+
+	db.updateElevationProfile(trail)
+	is.Equal(model.calls, calls) // unchanged geometry should reuse the computed profile
+
+	trail.Geometry.Lines = trail.Geometry.Lines[1:]
+	db.updateElevationProfile(trail)
+	is.True(model.calls > calls) // changed geometry should be sampled again
+}
+
+func TestThatTrailDifficultyIsClassifiedByRules(t *testing.T) {
+	is := is.New(t)
+
+	rules, err := ParseDifficultyRules(defaultDifficultyRules)
+	is.NoErr(err)
+
+	short := domain.ExerciseTrail{Length: 2.5}
+	is.Equal(rules.Classify(short), DifficultyEasy)
+
+	short.Elevation = &domain.ElevationProfile{TotalAscent: 80, MaxGradient: 9}
+	is.Equal(rules.Classify(short), DifficultyMedium) // elevation should be considered when available
+
+	is.Equal(rules.Classify(domain.ExerciseTrail{Length: 12}), DifficultyHard)
+	is.Equal(rules.Classify(domain.ExerciseTrail{Length: 6, Category: []string{"ice-skating"}}), DifficultyEasy)
+
+	_, err = ParseDifficultyRules([]byte(`{"rules":[{"difficulty":"extreme"}]}`))
+	is.True(err != nil) // unknown difficulties should be rejected
+}
+
+func TestThatSourceDifficultyTakesPrecedence(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	db, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	trail, err := db.GetTrailFromID(SundsvallAnlaggningPrefix + "1211")
+	is.NoErr(err)
+	is.Equal(trail.Length, 6.0)
+	is.Equal(trail.Difficulty, DifficultyEasy) // "Mycket lätt" in the source rather than medium by length
+}
+
+func TestThatStaleWaterTemperaturesAreFlaggedOrHidden(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	ds, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	db := ds.(*myDB)
+	observedAt := time.Date(2022, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	beachID, err := db.UpdateWaterTemperatureFromDeviceID("se:servanet:lora:sk-elt-temp-01", 18.5, observedAt)
+	is.NoErr(err)
+
+	db.now = func() time.Time { return observedAt.Add(2 * time.Hour) }
+	beach, _ := db.GetBeachFromID(beachID)
+	is.Equal(*beach.WaterTemperature, 18.5)
+	is.Equal(beach.WaterTemperatureObservedAt, observedAt)
+	is.True(!beach.WaterTemperatureStale)
+
+	db.now = func() time.Time { return observedAt.Add(72 * time.Hour) }
+	beach, _ = db.GetBeachFromID(beachID)
+	is.True(beach.WaterTemperatureStale) // temperatures older than the max age should be flagged
+
+	issues, _ := db.GetDataQualityReport()
+	is.Equal(issues[len(issues)-1].Attribute, "waterTemperature")
+
+	db.staleness.Action = StaleWaterTemperatureHide
+	beach, _ = db.GetBeachFromID(beachID)
+	is.Equal(beach.WaterTemperature, nil) // stale temperatures should be hidden when the rule says so
+	is.True(beach.WaterTemperatureObservedAt.IsZero())
+	is.True(!beach.WaterTemperatureStale)
+}
+
+func TestThatRegistryAssignmentsReplaceSourceSensor(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	ds, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	db := ds.(*myDB)
+	beachID := SundsvallAnlaggningPrefix + "1545"
+	assignedAt := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	db.now = func() time.Time { return assignedAt.Add(24 * time.Hour) }
+
+	is.NoErr(db.AssignDeviceToBeach(domain.DeviceAssignment{DeviceID: "sensor-a", BeachID: beachID, From: assignedAt}))
+	is.NoErr(db.AssignDeviceToBeach(domain.DeviceAssignment{DeviceID: "sensor-b", BeachID: beachID, From: assignedAt}))
+	is.NoErr(db.AssignDeviceToBeach(domain.DeviceAssignment{DeviceID: "sensor-c", BeachID: beachID, From: assignedAt}))
+
+	_, err = db.UpdateWaterTemperatureFromDeviceID("se:servanet:lora:sk-elt-temp-01", 30.0, assignedAt.Add(time.Hour))
+	is.True(err != nil) // the source sensor should no longer be consulted
+
+	for device, temp := range map[string]float64{"sensor-a": 17.0, "sensor-b": 18.0, "sensor-c": 25.0} {
+		_, err = db.UpdateWaterTemperatureFromDeviceID(device, temp, assignedAt.Add(time.Hour))
+		is.NoErr(err)
+	}
+
+	beach, _ := db.GetBeachFromID(beachID)
+	is.Equal(*beach.WaterTemperature, 18.0) // median of the three sensors
+	is.Equal(len(beach.Sensors), 3)
+
+	is.NoErr(db.UnassignDeviceFromBeach("sensor-c", beachID, assignedAt.Add(2*time.Hour)))
+	beach, _ = db.GetBeachFromID(beachID)
+	is.Equal(*beach.WaterTemperature, 17.5) // median of the remaining sensors
+
+	history, _ := db.GetDeviceAssignments(beachID)
+	is.Equal(len(history), 3) // ended assignments should be kept as history
+
+	is.NoErr(db.UnassignDeviceFromBeach("sensor-a", beachID, assignedAt.Add(3*time.Hour)))
+	is.NoErr(db.UnassignDeviceFromBeach("sensor-b", beachID, assignedAt.Add(3*time.Hour)))
+	beach, _ = db.GetBeachFromID(beachID)
+	is.Equal(beach.WaterTemperature, nil) // no temperature without any assigned sensors
+	is.True(beach.WaterTemperatureObservedAt.IsZero())
+	is.Equal(len(beach.Sensors), 0) // the source sensor should not come back
+}
+
+func TestThatDeviceAssignmentsAreKeptAcrossRestarts(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	path := filepath.Join(t.TempDir(), "devices.json")
+
+	db, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger(), WithDeviceRegistryPath(path))
+	is.NoErr(err)
+
+	beachID := SundsvallAnlaggningPrefix + "1545"
+	assignedAt := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	location := &domain.Point{Coordinates: []float64{17.47, 62.43}}
+
+	is.NoErr(db.AssignDeviceToBeach(domain.DeviceAssignment{DeviceID: "sensor-a", BeachID: beachID, Location: location, From: assignedAt}))
+	is.NoErr(db.AssignDeviceToBeach(domain.DeviceAssignment{DeviceID: "sensor-b", BeachID: beachID, From: assignedAt}))
+	is.NoErr(db.UnassignDeviceFromBeach("sensor-b", beachID, assignedAt.Add(time.Hour)))
+	is.NoErr(db.SetBeachSensorAggregation(beachID, SensorAggregationNearest))
+
+	db, err = NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger(), WithDeviceRegistryPath(path))
+	is.NoErr(err)
+
+	history, err := db.GetDeviceAssignments(beachID)
+	is.NoErr(err)
+	is.Equal(history, []domain.DeviceAssignment{
+		{DeviceID: "sensor-a", BeachID: beachID, Location: location, From: assignedAt},
+		{DeviceID: "sensor-b", BeachID: beachID, From: assignedAt, To: assignedAt.Add(time.Hour)},
+	})
+
+	beach, _ := db.GetBeachFromID(beachID)
+	is.Equal(beach.Sensors, []string{"sensor-a"}) // the source sensor should not come back after a restart
+	is.Equal(beach.SensorAggregation, SensorAggregationNearest)
+}
+
+func TestThatTrailAttributesCanBeUpdated(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	db, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	trailID := SundsvallAnlaggningPrefix + "703"
+	name, description, difficulty, empty := "Hotellslingan", "Belyst slinga", "Svår", ""
+
+	err = db.UpdateTrailAttributes(trailID, AttributeUpdate{Name: &name, Description: &empty, Difficulty: &difficulty}, true)
+	is.NoErr(err)
+
+	err = db.UpdateTrailAttributes(trailID, AttributeUpdate{Name: &description, Description: &description}, false)
+	is.NoErr(err)
+
+	trail, _ := db.GetTrailFromID(trailID)
+	is.Equal(trail.Name, name)               // existing values should not be overwritten without overwrite
+	is.Equal(trail.Description, description) // missing values should be set without overwrite
+	is.Equal(trail.Difficulty, DifficultyHard)
+
+	err = db.UpdateTrailAttributes(trailID, AttributeUpdate{OpeningHours: []string{"Mo-Su 00:00-24:00"}}, true)
+	is.True(errors.Is(err, ErrUnsupportedAttribute))
+
+	err = db.UpdateTrailAttributes("unknown", AttributeUpdate{Name: &name}, true)
+	is.True(err != nil)
+}
+
+func TestThatTrailDifficultyIsClassifiedAgainWhenAttributesChange(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	db, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	trailID := "se:timra:trails:1"
+	is.NoErr(db.CreateTrail(domain.ExerciseTrail{ID: trailID, Name: "Slingan", Geometry: domain.LineString{Lines: [][]float64{{17.3, 62.4}, {17.31, 62.4}}}}))
+
+	length := 20.0
+	is.NoErr(db.UpdateTrailAttributes(trailID, AttributeUpdate{Length: &length}, true))
+	trail, _ := db.GetTrailFromID(trailID)
+	is.Equal(trail.Difficulty, DifficultyHard) // a longer trail should be classified again
+
+	is.NoErr(db.UpdateTrailAttributes(trailID, AttributeUpdate{Category: []string{"ice-skating"}, Length: &trail.ComputedLength}, true))
+	trail, _ = db.GetTrailFromID(trailID)
+	is.Equal(trail.Difficulty, DifficultyEasy)
+
+	medium := "medel"
+	is.NoErr(db.UpdateTrailAttributes(trailID, AttributeUpdate{Difficulty: &medium}, false)) // a classified difficulty is not a value of its own
+	is.NoErr(db.UpdateTrailAttributes(trailID, AttributeUpdate{Length: &length}, true))
+	trail, _ = db.GetTrailFromID(trailID)
+	is.Equal(trail.Difficulty, DifficultyMedium) // a given difficulty should not be classified again
+}
+
+func TestThatLocationAndStatusCanOnlyBeChangedForLocalEntities(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	db, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	sourceTrail, _ := db.GetTrailFromID(SundsvallAnlaggningPrefix + "703")
+	status := sourceTrail.Status
+	err = db.UpdateTrailAttributes(sourceTrail.ID, AttributeUpdate{TrailGeometry: &sourceTrail.Geometry, Status: &status}, true)
+	is.NoErr(err) // unchanged values should be accepted
+
+	moved := domain.LineString{Lines: [][]float64{{17.3, 62.4}, {17.31, 62.4}}}
+	err = db.UpdateTrailAttributes(sourceTrail.ID, AttributeUpdate{TrailGeometry: &moved}, true)
+	is.True(errors.Is(err, ErrUnsupportedAttribute)) // the source manages the location
+
+	localTrail := domain.ExerciseTrail{ID: "se:timra:trails:1", Name: "Slingan", Geometry: domain.LineString{Lines: [][]float64{{17.3, 62.4}, {17.3, 62.41}}}}
+	is.NoErr(db.CreateTrail(localTrail))
+
+	closed := TrailStatusClosed
+	err = db.UpdateTrailAttributes(localTrail.ID, AttributeUpdate{TrailGeometry: &moved, Status: &closed}, true)
+	is.NoErr(err)
+
+	trail, _ := db.GetTrailFromID(localTrail.ID)
+	is.Equal(trail.Geometry.Lines, moved.Lines)
+	is.Equal(trail.Status, TrailStatusClosed)
+}
+
+func TestThatLocalEntitiesAreKeptAcrossRestarts(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	path := filepath.Join(t.TempDir(), "local.json")
+
+	db, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger(), WithLocalEntitiesPath(path))
+	is.NoErr(err)
+
+	beach := domain.Beach{
+		ID:       "se:timra:beaches:1",
+		Name:     "Vinterbadet",
+		Geometry: domain.MultiPolygon{Lines: [][][][]float64{{{{17.3, 62.4}, {17.31, 62.4}, {17.31, 62.41}, {17.3, 62.4}}}}},
+	}
+	is.NoErr(db.CreateBeach(beach))
+	is.True(errors.Is(db.CreateBeach(beach), ErrEntityExists))
+
+	beach.ID = SundsvallAnlaggningPrefix + "9999"
+	is.True(errors.Is(db.CreateBeach(beach), ErrInvalidAttributeValue)) // source ids are reserved
+
+	trail := domain.ExerciseTrail{
+		ID:       "se:timra:trails:1",
+		Name:     "Skidspåret",
+		Status:   TrailStatusOpen,
+		Geometry: domain.LineString{Lines: [][]float64{{17.3, 62.4}, {17.31, 62.4}}},
+	}
+	is.NoErr(db.CreateTrail(trail))
+
+	db, err = NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger(), WithLocalEntitiesPath(path))
+	is.NoErr(err)
+
+	beaches, _ := db.GetAllBeaches()
+	is.Equal(len(beaches), 2) // the local beach should be loaded together with the source beach
+
+	created, err := db.GetTrailFromID("se:timra:trails:1")
+	is.NoErr(err)
+	is.Equal(created.Status, TrailStatusOpen)
+	is.True(created.Length > 0.5) // length should be computed from the geometry when missing
+
+	is.True(errors.Is(db.DeleteTrail(SundsvallAnlaggningPrefix+"703"), ErrNotLocallyManaged))
+	is.NoErr(db.DeleteTrail("se:timra:trails:1"))
+	_, err = db.GetTrailFromID("se:timra:trails:1")
+	is.True(err != nil)
+}
+
+func TestThatOnlyGivenDifficultiesOfLocalTrailsAreKept(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	path := filepath.Join(t.TempDir(), "local.json")
+
+	db, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger(), WithLocalEntitiesPath(path))
+	is.NoErr(err)
+
+	geometry := domain.LineString{Lines: [][]float64{{17.3, 62.4}, {17.31, 62.4}}}
+	is.NoErr(db.CreateTrail(domain.ExerciseTrail{ID: "se:timra:trails:1", Name: "Slingan", Geometry: geometry}))
+	is.NoErr(db.CreateTrail(domain.ExerciseTrail{ID: "se:timra:trails:2", Name: "Backen", Geometry: geometry, Difficulty: DifficultyHard}))
+
+	classified, _ := db.GetTrailFromID("se:timra:trails:1")
+	is.Equal(classified.Difficulty, DifficultyEasy)
+
+	rules, err := ParseDifficultyRules([]byte(`{"rules": [{"difficulty": "medium"}]}`))
+	is.NoErr(err)
+
+	db, err = NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger(), WithLocalEntitiesPath(path), WithDifficultyRules(rules))
+	is.NoErr(err)
+
+	classified, _ = db.GetTrailFromID("se:timra:trails:1")
+	is.Equal(classified.Difficulty, DifficultyMedium) // the difficulty should be classified by the current rules
+	given, _ := db.GetTrailFromID("se:timra:trails:2")
+	is.Equal(given.Difficulty, DifficultyHard)
+}
+
+func TestThatChangesAreAnnouncedToListeners(t *testing.T) {
+	mockServer := setupMockServiceThatReturns(200, response)
+	is := is.New(t)
+
+	log.Logger = log.Output(ioutil.Discard)
+
+	db, err := NewDatabaseConnection(mockServer.URL, "apikey", log.With().Logger())
+	is.NoErr(err)
+
+	changes := []EntityChange{}
+	db.AddChangeListener(func(change EntityChange) {
+		changes = append(changes, change)
+	})
+
+	trailID := SundsvallAnlaggningPrefix + "703"
+
+	is.NoErr(db.SetTrailOpenStatus(trailID, true))
+	is.NoErr(db.SetTrailOpenStatus(trailID, true))
+	is.NoErr(db.UpdateTrailLastPreparationTime(trailID, time.Now().UTC()))
+
+	is.Equal(len(changes), 2) // a status that is reported again by the feed should not be announced
+	is.Equal(changes[0], EntityChange{EntityType: EntityTypeExerciseTrail, EntityID: trailID})
+
+	trail := domain.ExerciseTrail{
+		ID:       "se:timra:trails:1",
+		Name:     "Skidspåret",
+		Geometry: domain.LineString{Lines: [][]float64{{17.3, 62.4}, {17.31, 62.4}}},
+	}
+	is.NoErr(db.CreateTrail(trail))
+	is.NoErr(db.DeleteTrail(trail.ID))
+
+	is.Equal(changes[len(changes)-1], EntityChange{EntityType: EntityTypeExerciseTrail, EntityID: trail.ID, Deleted: true})
+}
@@ -0,0 +1,429 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+)
+
+const (
+	//SensorAggregationMedian uses the median of the recent readings from all sensors at a beach
+	SensorAggregationMedian string = "median"
+	//SensorAggregationNearest uses the recent reading from the sensor closest to the swim area
+	SensorAggregationNearest string = "nearest"
+)
+
+//ErrUnknownDevice is returned for readings from devices that are not assigned to any beach
+var ErrUnknownDevice error = errors.New("no beach found matching sensor ID")
+
+type sensorReading struct {
+	value      float64
+	observedAt time.Time
+}
+
+//deviceRegistryDocument is the format of the file that the device assignments and the sensor aggregation
+//methods of beaches are kept in
+type deviceRegistryDocument struct {
+	Assignments       []deviceAssignment `json:"assignments"`
+	SensorAggregation map[string]string  `json:"sensorAggregation"`
+}
+
+type deviceAssignment struct {
+	DeviceID string     `json:"deviceID"`
+	BeachID  string     `json:"beachID"`
+	Location []float64  `json:"location,omitempty"`
+	From     time.Time  `json:"from"`
+	To       *time.Time `json:"to,omitempty"`
+}
+
+//WithDeviceRegistryPath keeps the device assignments in a file, so that they survive restarts
+func WithDeviceRegistryPath(path string) Option {
+	return func(opts *options) {
+		opts.deviceRegistryPath = path
+	}
+}
+
+func (db *myDB) loadDeviceRegistry() error {
+	if db.deviceRegistryPath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(db.deviceRegistryPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	document := deviceRegistryDocument{}
+	err = json.Unmarshal(data, &document)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal device registry from %s: %s", db.deviceRegistryPath, err.Error())
+	}
+
+	for _, a := range document.Assignments {
+		if db.beachIndex(a.BeachID) < 0 {
+			db.log.Warn().Msgf("ignoring assignment of device %s to unknown beach %q", a.DeviceID, a.BeachID)
+			continue
+		}
+
+		assignment := domain.DeviceAssignment{DeviceID: a.DeviceID, BeachID: a.BeachID, From: a.From}
+		if len(a.Location) >= 2 {
+			assignment.Location = &domain.Point{Coordinates: a.Location}
+		}
+		if a.To != nil {
+			assignment.To = *a.To
+		}
+
+		db.assignments = append(db.assignments, assignment)
+	}
+
+	for beachID, method := range document.SensorAggregation {
+		if db.beachIndex(beachID) >= 0 {
+			db.sensorAggregation[beachID] = method
+		}
+	}
+
+	db.log.Info().Msgf("loaded %d device assignments", len(db.assignments))
+
+	return nil
+}
+
+func (db *myDB) saveDeviceRegistry() error {
+	if db.deviceRegistryPath == "" {
+		return nil
+	}
+
+	document := deviceRegistryDocument{Assignments: []deviceAssignment{}, SensorAggregation: db.sensorAggregation}
+
+	for _, a := range db.assignments {
+		assignment := deviceAssignment{DeviceID: a.DeviceID, BeachID: a.BeachID, From: a.From}
+		if a.Location != nil {
+			assignment.Location = a.Location.Coordinates
+		}
+		if !a.To.IsZero() {
+			to := a.To
+			assignment.To = &to
+		}
+
+		document.Assignments = append(document.Assignments, assignment)
+	}
+
+	data, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	tmp := db.deviceRegistryPath + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, db.deviceRegistryPath)
+}
+
+//WithSensorIDPrefix replaces the prefix that is prepended to sensor names from the source and the enrichment
+func WithSensorIDPrefix(prefix string) Option {
+	return func(opts *options) {
+		opts.sensorIDPrefix = &prefix
+	}
+}
+
+func (db *myDB) beachIndex(beachID string) int {
+	for idx, beach := range db.beaches {
+		if beach.ID == beachID {
+			return idx
+		}
+	}
+	return -1
+}
+
+//activeDevices returns the devices assigned to a beach in the registry at the given time. The sensor
+//from the source or enrichment is only used for beaches that have never had a device assigned in the
+//registry, so that ending the last assignment of a beach does not bring back the source sensor.
+func (db *myDB) activeDevices(beach domain.Beach, t time.Time) []string {
+	devices := []string{}
+	registered := false
+
+	for _, a := range db.assignments {
+		if a.BeachID == beach.ID {
+			registered = true
+			if a.ActiveAt(t) {
+				devices = append(devices, a.DeviceID)
+			}
+		}
+	}
+
+	if !registered && beach.SensorID != nil {
+		devices = append(devices, *beach.SensorID)
+	}
+
+	return devices
+}
+
+func (db *myDB) withActiveSensors(beach domain.Beach) domain.Beach {
+	beach.Sensors = db.activeDevices(beach, db.now())
+	beach.SensorAggregation = db.aggregationFor(beach.ID)
+	return beach
+}
+
+func (db *myDB) aggregationFor(beachID string) string {
+	if method, ok := db.sensorAggregation[beachID]; ok {
+		return method
+	}
+	return SensorAggregationMedian
+}
+
+//beachForDevice returns the index of the beach that a device was assigned to at the given time. A
+//reading from before the device was first assigned to a beach, such as a dead lettered reading that
+//is replayed after the device has been registered, belongs to the beach of its earliest assignment.
+func (db *myDB) beachForDevice(device string, t time.Time) int {
+	for _, a := range db.assignments {
+		if a.DeviceID == device && a.ActiveAt(t) {
+			return db.beachIndex(a.BeachID)
+		}
+	}
+
+	for idx, beach := range db.beaches {
+		for _, d := range db.activeDevices(beach, t) {
+			if d == device {
+				return idx
+			}
+		}
+	}
+
+	earliest := -1
+	for i, a := range db.assignments {
+		if a.DeviceID == device && (earliest < 0 || a.From.Before(db.assignments[earliest].From)) {
+			earliest = i
+		}
+	}
+
+	if earliest >= 0 && t.Before(db.assignments[earliest].From) {
+		return db.beachIndex(db.assignments[earliest].BeachID)
+	}
+
+	return -1
+}
+
+func (db *myDB) deviceLocation(device, beachID string, t time.Time) *domain.Point {
+	for _, a := range db.assignments {
+		if a.DeviceID == device && a.BeachID == beachID && a.ActiveAt(t) {
+			return a.Location
+		}
+	}
+	return nil
+}
+
+//updateAggregatedWaterTemperature combines the readings from the active devices at a beach, ignoring
+//readings that are older than the staleness max age compared to the latest reading. The water
+//temperature is cleared when none of the active devices has a reading.
+func (db *myDB) updateAggregatedWaterTemperature(idx int) {
+	beach := db.beaches[idx]
+	now := db.now()
+	readings := db.sensorReadings[beach.ID]
+
+	devices := []string{}
+	latest := time.Time{}
+
+	for _, device := range db.activeDevices(beach, now) {
+		if r, ok := readings[device]; ok {
+			devices = append(devices, device)
+			if r.observedAt.After(latest) {
+				latest = r.observedAt
+			}
+		}
+	}
+
+	recent := []string{}
+	for _, device := range devices {
+		if latest.Sub(readings[device].observedAt) <= db.staleness.MaxAge {
+			recent = append(recent, device)
+		}
+	}
+
+	if len(recent) == 0 {
+		db.beaches[idx].WaterTemperature = nil
+		db.beaches[idx].WaterTemperatureObservedAt = time.Time{}
+		return
+	}
+
+	var value float64
+
+	if db.aggregationFor(beach.ID) == SensorAggregationNearest {
+		nearest := math.Inf(1)
+		for _, device := range recent {
+			distance := math.Inf(1)
+			if location := db.deviceLocation(device, beach.ID, now); location != nil {
+				distance = beach.Geometry.DistanceTo(*location)
+			}
+
+			r := readings[device]
+			if distance < nearest || (distance == nearest && r.observedAt.Equal(latest)) {
+				nearest = distance
+				value = r.value
+			}
+		}
+	} else {
+		values := []float64{}
+		for _, device := range recent {
+			values = append(values, readings[device].value)
+		}
+		sort.Float64s(values)
+
+		middle := len(values) / 2
+		value = values[middle]
+		if len(values)%2 == 0 {
+			value = math.Round((values[middle-1]+values[middle])/2*10) / 10
+		}
+	}
+
+	db.beaches[idx].WaterTemperature = &value
+	db.beaches[idx].WaterTemperatureObservedAt = latest
+}
+
+func (db *myDB) UpdateWaterTemperatureFromDeviceID(device string, temp float64, observedAt time.Time) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	idx := db.beachForDevice(device, observedAt)
+	if idx < 0 {
+		return "", fmt.Errorf("%w %s", ErrUnknownDevice, device)
+	}
+
+	beach := db.beaches[idx]
+
+	readings, ok := db.sensorReadings[beach.ID]
+	if !ok {
+		readings = map[string]sensorReading{}
+		db.sensorReadings[beach.ID] = readings
+	}
+
+	if previous, ok := readings[device]; ok && !observedAt.After(previous.observedAt) {
+		return beach.ID, fmt.Errorf("ignored temperature update that predates the latest reading from %s", device)
+	}
+
+	readings[device] = sensorReading{value: temp, observedAt: observedAt.UTC()}
+
+	db.updateAggregatedWaterTemperature(idx)
+	db.beaches[idx].DateModified = time.Now().UTC()
+	db.notifyBeachChanged(beach.ID)
+
+	return beach.ID, nil
+}
+
+//AssignDeviceToBeach adds an assignment to the registry. Any active assignment of the device to
+//another beach ends when the new assignment starts.
+func (db *myDB) AssignDeviceToBeach(assignment domain.DeviceAssignment) error {
+	if assignment.DeviceID == "" {
+		return fmt.Errorf("device id must not be empty")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	idx := db.beachIndex(assignment.BeachID)
+	if idx < 0 {
+		return errors.New("not found")
+	}
+
+	if assignment.From.IsZero() {
+		assignment.From = db.now().UTC()
+	}
+
+	affected := map[int]bool{idx: true}
+
+	for i, a := range db.assignments {
+		if a.DeviceID == assignment.DeviceID && a.To.IsZero() {
+			if !assignment.From.After(a.From) {
+				return fmt.Errorf("device %s has an assignment starting at %s", a.DeviceID, a.From.Format(time.RFC3339))
+			}
+
+			db.assignments[i].To = assignment.From
+			affected[db.beachIndex(a.BeachID)] = true
+		}
+	}
+
+	db.assignments = append(db.assignments, assignment)
+
+	for i := range affected {
+		if i >= 0 {
+			db.updateAggregatedWaterTemperature(i)
+			db.notifyBeachChanged(db.beaches[i].ID)
+		}
+	}
+
+	return db.saveDeviceRegistry()
+}
+
+//UnassignDeviceFromBeach ends the active assignment of a device to a beach
+func (db *myDB) UnassignDeviceFromBeach(deviceID, beachID string, at time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, a := range db.assignments {
+		if a.DeviceID == deviceID && a.BeachID == beachID && a.To.IsZero() {
+			if at.IsZero() {
+				at = db.now().UTC()
+			}
+
+			if at.Before(a.From) {
+				return fmt.Errorf("assignment of %s can not end before it started", deviceID)
+			}
+
+			db.assignments[i].To = at
+			db.updateAggregatedWaterTemperature(db.beachIndex(beachID))
+			db.notifyBeachChanged(beachID)
+			return db.saveDeviceRegistry()
+		}
+	}
+
+	return errors.New("not found")
+}
+
+//GetDeviceAssignments returns the assignment history of a beach, or of all beaches if the beach id is empty
+func (db *myDB) GetDeviceAssignments(beachID string) ([]domain.DeviceAssignment, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if beachID != "" && db.beachIndex(beachID) < 0 {
+		return nil, errors.New("not found")
+	}
+
+	assignments := []domain.DeviceAssignment{}
+	for _, a := range db.assignments {
+		if beachID == "" || a.BeachID == beachID {
+			assignments = append(assignments, a)
+		}
+	}
+
+	return assignments, nil
+}
+
+//SetBeachSensorAggregation selects how the readings from multiple sensors at a beach are combined
+func (db *myDB) SetBeachSensorAggregation(beachID, method string) error {
+	if method != SensorAggregationMedian && method != SensorAggregationNearest {
+		return fmt.Errorf("unknown sensor aggregation %q", method)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	idx := db.beachIndex(beachID)
+	if idx < 0 {
+		return errors.New("not found")
+	}
+
+	db.sensorAggregation[beachID] = method
+	db.updateAggregatedWaterTemperature(idx)
+	db.notifyBeachChanged(beachID)
+
+	return db.saveDeviceRegistry()
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+)
+
+//go:embed difficulty.json
+var defaultDifficultyRules []byte
+
+const (
+	DifficultyEasy   string = "easy"
+	DifficultyMedium string = "medium"
+	DifficultyHard   string = "hard"
+)
+
+//DifficultyRules classifies exercise trails using the first rule that the trail satisfies
+type DifficultyRules struct {
+	Rules []DifficultyRule `json:"rules"`
+}
+
+//DifficultyRule is satisfied by trails that have any of the categories, if given, and that do not exceed
+//the given length in km, total ascent in metres or gradient in percent. Elevation limits are ignored
+//for trails without an elevation profile.
+type DifficultyRule struct {
+	Difficulty  string   `json:"difficulty"`
+	Categories  []string `json:"categories,omitempty"`
+	MaxLength   *float64 `json:"maxLength,omitempty"`
+	MaxAscent   *float64 `json:"maxAscent,omitempty"`
+	MaxGradient *float64 `json:"maxGradient,omitempty"`
+}
+
+//sourceDifficulties maps the difficulty values used by the source to our classification
+var sourceDifficulties map[string]string = map[string]string{
+	"mycket lätt": DifficultyEasy,
+	"lätt":        DifficultyEasy,
+	"easy":        DifficultyEasy,
+	"medel":       DifficultyMedium,
+	"medelsvår":   DifficultyMedium,
+	"medium":      DifficultyMedium,
+	"svår":        DifficultyHard,
+	"mycket svår": DifficultyHard,
+	"hard":        DifficultyHard,
+}
+
+//WithDifficultyRules replaces the default rules used to classify the difficulty of exercise trails
+func WithDifficultyRules(rules DifficultyRules) Option {
+	return func(opts *options) {
+		opts.difficultyRules = &rules
+	}
+}
+
+//ParseDifficultyRules parses and validates a json document with difficulty rules
+func ParseDifficultyRules(data []byte) (DifficultyRules, error) {
+	rules := DifficultyRules{}
+
+	err := json.Unmarshal(data, &rules)
+	if err != nil {
+		return rules, fmt.Errorf("failed to unmarshal difficulty rules: %s", err.Error())
+	}
+
+	if len(rules.Rules) == 0 {
+		return rules, fmt.Errorf("difficulty rules must contain at least one rule")
+	}
+
+	for idx, rule := range rules.Rules {
+		if rule.Difficulty != DifficultyEasy && rule.Difficulty != DifficultyMedium && rule.Difficulty != DifficultyHard {
+			return rules, fmt.Errorf("rule %d has unknown difficulty %q", idx+1, rule.Difficulty)
+		}
+	}
+
+	return rules, nil
+}
+
+func (rule DifficultyRule) satisfiedBy(trail domain.ExerciseTrail) bool {
+	if len(rule.Categories) > 0 {
+		hasCategory := false
+		for _, category := range rule.Categories {
+			hasCategory = hasCategory || contains(trail.Category, category)
+		}
+
+		if !hasCategory {
+			return false
+		}
+	}
+
+	if rule.MaxLength != nil && trail.Length > *rule.MaxLength {
+		return false
+	}
+
+	if trail.Elevation != nil {
+		if rule.MaxAscent != nil && trail.Elevation.TotalAscent > *rule.MaxAscent {
+			return false
+		}
+
+		if rule.MaxGradient != nil && trail.Elevation.MaxGradient > *rule.MaxGradient {
+			return false
+		}
+	}
+
+	return true
+}
+
+//Classify returns the difficulty of the first rule that the trail satisfies, or hard if none does
+func (rules DifficultyRules) Classify(trail domain.ExerciseTrail) string {
+	for _, rule := range rules.Rules {
+		if rule.satisfiedBy(trail) {
+			return rule.Difficulty
+		}
+	}
+
+	return DifficultyHard
+}
+
+//updateDifficulty classifies the difficulty of a trail, unless the source or a client has provided it.
+//The given difficulty is kept apart from the classified one, so that only a given difficulty is stored.
+func (db *myDB) updateDifficulty(trail *domain.ExerciseTrail, sourceDifficulty string) {
+	if sourceDifficulty == "" {
+		delete(db.givenDifficulties, trail.ID)
+	} else {
+		db.givenDifficulties[trail.ID] = sourceDifficulty
+		difficulty, ok := sourceDifficulties[strings.ToLower(strings.TrimSpace(sourceDifficulty))]
+		if ok {
+			trail.Difficulty = difficulty
+			return
+		}
+
+		db.issues = append(db.issues, domain.DataQualityIssue{
+			EntityID:  trail.ID,
+			Attribute: "difficulty",
+			Message:   fmt.Sprintf("unknown difficulty %q in source, using classified difficulty instead", sourceDifficulty),
+		})
+	}
+
+	trail.Difficulty = db.difficultyRules.Classify(*trail)
+}
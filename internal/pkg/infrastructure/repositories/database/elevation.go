@@ -0,0 +1,60 @@
+package database
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+)
+
+type elevationProfileEntry struct {
+	geometryHash uint64
+	profile      *domain.ElevationProfile
+}
+
+//WithElevationModel enables computation of elevation profiles for exercise trails
+func WithElevationModel(model domain.ElevationModel) Option {
+	return func(opts *options) {
+		opts.elevationModel = model
+	}
+}
+
+func hashGeometry(ls domain.LineString) uint64 {
+	h := fnv.New64a()
+	b := make([]byte, 8)
+
+	for _, position := range ls.Lines {
+		for _, coordinate := range position {
+			binary.LittleEndian.PutUint64(b, math.Float64bits(coordinate))
+			h.Write(b)
+		}
+	}
+
+	return h.Sum64()
+}
+
+//updateElevationProfile assigns the elevation profile of a trail, which is only recomputed
+//when the geometry of the trail has changed since the profile was last computed
+func (db *myDB) updateElevationProfile(trail *domain.ExerciseTrail) {
+	if db.elevationModel == nil {
+		return
+	}
+
+	geometryHash := hashGeometry(trail.Geometry)
+
+	entry, ok := db.elevationProfiles[trail.ID]
+	if !ok || entry.geometryHash != geometryHash {
+		entry = elevationProfileEntry{
+			geometryHash: geometryHash,
+			profile:      domain.NewElevationProfile(trail.Geometry, db.elevationModel),
+		}
+		db.elevationProfiles[trail.ID] = entry
+
+		if entry.profile == nil {
+			db.log.Warn().Msgf("elevation model does not cover trail %s", trail.ID)
+		}
+	}
+
+	trail.Elevation = entry.profile
+}
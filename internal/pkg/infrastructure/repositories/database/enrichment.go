@@ -0,0 +1,64 @@
+package database
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//go:embed beaches.json
+var defaultBeachEnrichment []byte
+
+//BeachEnrichment contains information about a beach that is not published by the source
+type BeachEnrichment struct {
+	Name           string `json:"name,omitempty"`
+	NUTSCode       string `json:"nuts,omitempty"`
+	WikidataID     string `json:"wikidata,omitempty"`
+	SensorID       string `json:"sensorID,omitempty"`
+	OverrideSensor bool   `json:"overrideSensor,omitempty"`
+}
+
+var nutsCodePattern = regexp.MustCompile(`^[A-Z]{2}[0-9]{16}$`)
+var wikidataIDPattern = regexp.MustCompile(`^Q[0-9]+$`)
+
+//ParseBeachEnrichment parses and validates a json document with beach enrichments keyed by facility ID
+func ParseBeachEnrichment(data []byte) (map[int64]BeachEnrichment, error) {
+	document := map[string]BeachEnrichment{}
+
+	err := json.Unmarshal(data, &document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal beach enrichment: %s", err.Error())
+	}
+
+	enrichment := map[int64]BeachEnrichment{}
+
+	for key, be := range document {
+		facilityID, err := strconv.ParseInt(key, 10, 64)
+		if err != nil || facilityID <= 0 {
+			return nil, fmt.Errorf("invalid facility id %q in beach enrichment", key)
+		}
+
+		if be.NUTSCode != "" && !nutsCodePattern.MatchString(be.NUTSCode) {
+			return nil, fmt.Errorf("invalid nuts code %q for facility %d", be.NUTSCode, facilityID)
+		}
+
+		if be.WikidataID != "" && !wikidataIDPattern.MatchString(be.WikidataID) {
+			return nil, fmt.Errorf("invalid wikidata id %q for facility %d", be.WikidataID, facilityID)
+		}
+
+		if strings.ContainsAny(be.SensorID, " \t\r\n:") {
+			return nil, fmt.Errorf("invalid sensor id %q for facility %d", be.SensorID, facilityID)
+		}
+
+		if be.OverrideSensor && be.SensorID == "" {
+			return nil, fmt.Errorf("facility %d overrides the sensor without specifying a sensor id", facilityID)
+		}
+
+		enrichment[facilityID] = be
+	}
+
+	return enrichment, nil
+}
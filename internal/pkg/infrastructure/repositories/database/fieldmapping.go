@@ -0,0 +1,187 @@
+package database
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+)
+
+//go:embed fields.json
+var defaultFieldMapping []byte
+
+const (
+	FieldTypeFreeText string = "FREETEXT"
+	FieldTypeToggle   string = "TOGGLE"
+	FieldTypeDropdown string = "DROPDOWN"
+	FieldTypeInteger  string = "INTEGER"
+)
+
+//FieldMapping maps facility types in the source to domain entities and their attributes
+type FieldMapping map[string]FacilityTypeMapping
+
+//FacilityTypeMapping describes how the fields of a facility type should be interpreted
+type FacilityTypeMapping struct {
+	Entity     string            `json:"entity"`
+	Categories []string          `json:"categories,omitempty"`
+	Fields     []FieldDefinition `json:"fields"`
+}
+
+//SeasonDefinition is a part of the year, from and to MM-DD dates
+type SeasonDefinition struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+//FieldDefinition assigns a source field ID and value type to a domain attribute
+type FieldDefinition struct {
+	ID        int64  `json:"id"`
+	Type      string `json:"type"`
+	Attribute string `json:"attribute"`
+	Value     string `json:"value,omitempty"`
+}
+
+type fieldValue struct {
+	text   string
+	number int64
+	toggle bool
+}
+
+//entityAttributes lists the attributes that can be targeted for each entity and the field types they accept
+var entityAttributes map[string]map[string][]string = map[string]map[string][]string{
+	"Beach": {
+		"beachType":        {FieldTypeToggle},
+		"bookable":         {FieldTypeToggle},
+		"contactEmail":     {FieldTypeFreeText},
+		"contactTelephone": {FieldTypeFreeText},
+		"contactURL":       {FieldTypeFreeText},
+		"description":      {FieldTypeFreeText, FieldTypeDropdown},
+		"facilities":       {FieldTypeToggle},
+		"openingHours":     {FieldTypeFreeText, FieldTypeDropdown},
+		"sensor":           {FieldTypeFreeText},
+	},
+	"ExerciseTrail": {
+		"areaServed":  {FieldTypeFreeText, FieldTypeDropdown},
+		"category":    {FieldTypeToggle},
+		"description": {FieldTypeFreeText, FieldTypeDropdown},
+		"difficulty":  {FieldTypeFreeText, FieldTypeDropdown},
+		"length":      {FieldTypeInteger},
+		"status":      {FieldTypeToggle},
+	},
+	"Playground": {
+		"description": {FieldTypeFreeText, FieldTypeDropdown},
+	},
+	"OutdoorGym": {
+		"description": {FieldTypeFreeText, FieldTypeDropdown},
+	},
+	"Fireplace": {
+		"description": {FieldTypeFreeText, FieldTypeDropdown},
+	},
+	"SportsField": {
+		"bookable":     {FieldTypeToggle},
+		"category":     {FieldTypeToggle},
+		"description":  {FieldTypeFreeText, FieldTypeDropdown},
+		"openingHours": {FieldTypeFreeText, FieldTypeDropdown},
+		"surface":      {FieldTypeFreeText, FieldTypeDropdown},
+	},
+}
+
+//valueAttributes are the attributes that add the value of the field definition when a toggle is set
+var valueAttributes []string = []string{"beachType", "category", "facilities"}
+
+//ParseFieldMapping parses and validates a json document with field mappings keyed by facility type
+func ParseFieldMapping(data []byte) (FieldMapping, error) {
+	mapping := FieldMapping{}
+
+	err := json.Unmarshal(data, &mapping)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal field mapping: %s", err.Error())
+	}
+
+	for facilityType, ftm := range mapping {
+		attributes, ok := entityAttributes[ftm.Entity]
+		if !ok {
+			return nil, fmt.Errorf("facility type %s maps to unknown entity %q", facilityType, ftm.Entity)
+		}
+
+		for _, fd := range ftm.Fields {
+			acceptedTypes, ok := attributes[fd.Attribute]
+			if !ok {
+				return nil, fmt.Errorf("field %d of %s maps to unknown attribute %q", fd.ID, facilityType, fd.Attribute)
+			}
+
+			if !contains(acceptedTypes, fd.Type) {
+				return nil, fmt.Errorf("field %d of %s has type %s that can not be mapped to %s", fd.ID, facilityType, fd.Type, fd.Attribute)
+			}
+
+			if contains(valueAttributes, fd.Attribute) && fd.Value == "" {
+				return nil, fmt.Errorf("field %d of %s must specify a %s value", fd.ID, facilityType, fd.Attribute)
+			}
+		}
+	}
+
+	return mapping, nil
+}
+
+func (sd SeasonDefinition) parse() (*domain.Season, error) {
+	from, err := time.Parse("01-02", sd.From)
+	if err != nil {
+		return nil, fmt.Errorf("from must be a date formatted as MM-DD")
+	}
+
+	to, err := time.Parse("01-02", sd.To)
+	if err != nil {
+		return nil, fmt.Errorf("to must be a date formatted as MM-DD")
+	}
+
+	return &domain.Season{FromMonth: from.Month(), FromDay: from.Day(), ToMonth: to.Month(), ToDay: to.Day()}, nil
+}
+
+func (ftm FacilityTypeMapping) definitionFor(fieldID int64) (*FieldDefinition, bool) {
+	for idx := range ftm.Fields {
+		if ftm.Fields[idx].ID == fieldID {
+			return &ftm.Fields[idx], true
+		}
+	}
+	return nil, false
+}
+
+func (fd FieldDefinition) decode(raw json.RawMessage) (fieldValue, error) {
+	value := fieldValue{}
+
+	if fd.Type == FieldTypeInteger {
+		number, err := strconv.ParseInt(strings.Trim(string(raw), "\""), 10, 64)
+		if err != nil {
+			return value, fmt.Errorf("field %d is not a valid integer: %s", fd.ID, err.Error())
+		}
+		value.number = number
+		return value, nil
+	}
+
+	err := json.Unmarshal(raw, &value.text)
+	if err != nil {
+		return value, fmt.Errorf("field %d is not a valid %s: %s", fd.ID, strings.ToLower(fd.Type), err.Error())
+	}
+
+	if fd.Type == FieldTypeToggle {
+		if value.text != "Ja" && value.text != "Nej" {
+			return value, fmt.Errorf("field %d has unexpected toggle value %q", fd.ID, value.text)
+		}
+		value.toggle = (value.text == "Ja")
+	}
+
+	return value, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+)
+
+//withLightingSchedule assigns the lighting schedule of a floodlit trail, where a schedule for the
+//trail itself takes precedence over a schedule for the area that the trail belongs to
+func (db *myDB) withLightingSchedule(trail domain.ExerciseTrail) domain.ExerciseTrail {
+	trail.LightingSchedule = nil
+
+	isFloodlit := false
+	for _, category := range trail.Category {
+		isFloodlit = isFloodlit || category == "floodlit"
+	}
+
+	if !isFloodlit {
+		return trail
+	}
+
+	if schedule, ok := db.trailSchedules[trail.ID]; ok {
+		trail.LightingSchedule = &schedule
+	} else if schedule, ok := db.areaSchedules[trail.AreaServed]; ok && trail.AreaServed != "" {
+		trail.LightingSchedule = &schedule
+	}
+
+	return trail
+}
+
+func (db *myDB) SetTrailLightingSchedule(trailID string, schedule *domain.LightingSchedule) error {
+	if schedule != nil {
+		if err := schedule.Validate(); err != nil {
+			return err
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, trail := range db.trails {
+		if trail.ID == trailID {
+			if schedule == nil {
+				delete(db.trailSchedules, trailID)
+			} else {
+				db.trailSchedules[trailID] = *schedule
+			}
+			db.notifyTrailChanged(trailID)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("not found")
+}
+
+func (db *myDB) SetAreaLightingSchedule(area string, schedule *domain.LightingSchedule) error {
+	if schedule != nil {
+		if err := schedule.Validate(); err != nil {
+			return err
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	trailIDs := []string{}
+	for _, trail := range db.trails {
+		if trail.AreaServed == area {
+			trailIDs = append(trailIDs, trail.ID)
+		}
+	}
+
+	if len(trailIDs) == 0 {
+		return fmt.Errorf("no trails found in area %s", area)
+	}
+
+	if schedule == nil {
+		delete(db.areaSchedules, area)
+	} else {
+		db.areaSchedules[area] = *schedule
+	}
+
+	for _, trailID := range trailIDs {
+		db.notifyTrailChanged(trailID)
+	}
+
+	return nil
+}
@@ -0,0 +1,360 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+)
+
+//ErrEntityExists is returned when an entity is created with an id that is already in use
+var ErrEntityExists error = errors.New("entity already exists")
+
+//ErrNotLocallyManaged is returned when deleting an entity that has been loaded from the facility source
+var ErrNotLocallyManaged error = errors.New("entity is not locally managed")
+
+//localEntityDocument is the format of the file that locally managed entities are kept in
+type localEntityDocument struct {
+	Beaches []localBeach `json:"beaches"`
+	Trails  []localTrail `json:"trails"`
+}
+
+type localBeach struct {
+	ID           string          `json:"id"`
+	Name         string          `json:"name"`
+	Description  string          `json:"description,omitempty"`
+	Geometry     [][][][]float64 `json:"geometry"`
+	OpeningHours []string        `json:"openingHours,omitempty"`
+	DateCreated  time.Time       `json:"dateCreated"`
+	DateModified time.Time       `json:"dateModified"`
+}
+
+type localTrail struct {
+	ID           string      `json:"id"`
+	Name         string      `json:"name"`
+	Description  string      `json:"description,omitempty"`
+	Category     []string    `json:"category,omitempty"`
+	Length       float64     `json:"length,omitempty"`
+	AreaServed   string      `json:"areaServed,omitempty"`
+	Geometry     [][]float64 `json:"geometry"`
+	Status       string      `json:"status,omitempty"`
+	Difficulty   string      `json:"difficulty,omitempty"`
+	DateCreated  time.Time   `json:"dateCreated"`
+	DateModified time.Time   `json:"dateModified"`
+}
+
+//WithLocalEntitiesPath keeps locally created beaches and trails in a file, so that they survive restarts
+func WithLocalEntitiesPath(path string) Option {
+	return func(opts *options) {
+		opts.localEntitiesPath = path
+	}
+}
+
+//validateLocalEntityID makes sure that locally created entities can never be replaced by entities from
+//the facility source, by not allowing them to use the id prefix of the source
+func validateLocalEntityID(id string) error {
+	if id == "" || strings.ContainsAny(id, " \t\r\n/") {
+		return fmt.Errorf("%w: %q is not a valid id", ErrInvalidAttributeValue, id)
+	}
+
+	if strings.HasPrefix(id, SundsvallAnlaggningPrefix) {
+		return fmt.Errorf("%w: ids starting with %s are reserved for the facility source", ErrInvalidAttributeValue, SundsvallAnlaggningPrefix)
+	}
+
+	return nil
+}
+
+func (db *myDB) loadLocalEntities() error {
+	if db.localEntitiesPath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(db.localEntitiesPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	document := localEntityDocument{}
+	err = json.Unmarshal(data, &document)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal local entities from %s: %s", db.localEntitiesPath, err.Error())
+	}
+
+	for _, b := range document.Beaches {
+		if err := validateLocalEntityID(b.ID); err != nil || db.beachIndex(b.ID) >= 0 {
+			db.log.Warn().Msgf("ignoring local beach %q that conflicts with the facility source", b.ID)
+			continue
+		}
+
+		db.addLocalBeach(domain.Beach{
+			ID:           b.ID,
+			Name:         b.Name,
+			Description:  b.Description,
+			Geometry:     domain.MultiPolygon{Lines: b.Geometry},
+			OpeningHours: b.OpeningHours,
+			DateCreated:  b.DateCreated,
+			DateModified: b.DateModified,
+		})
+	}
+
+	for _, t := range document.Trails {
+		if err := validateLocalEntityID(t.ID); err != nil || db.trailStatuses[t.ID] != nil {
+			db.log.Warn().Msgf("ignoring local trail %q that conflicts with the facility source", t.ID)
+			continue
+		}
+
+		db.addLocalTrail(domain.ExerciseTrail{
+			ID:           t.ID,
+			Name:         t.Name,
+			Description:  t.Description,
+			Category:     t.Category,
+			Length:       t.Length,
+			AreaServed:   t.AreaServed,
+			Geometry:     domain.LineString{Lines: t.Geometry},
+			Status:       t.Status,
+			Difficulty:   t.Difficulty,
+			DateCreated:  t.DateCreated,
+			DateModified: t.DateModified,
+		})
+	}
+
+	db.log.Info().Msgf("loaded %d local beaches and %d local trails", len(document.Beaches), len(document.Trails))
+
+	return nil
+}
+
+//saveLocalEntitiesIfManaged writes the locally managed entities to file if the changed entity is one of them
+func (db *myDB) saveLocalEntitiesIfManaged(entityID string) error {
+	if !db.localEntities[entityID] {
+		return nil
+	}
+
+	return db.saveLocalEntities()
+}
+
+func (db *myDB) saveLocalEntities() error {
+	if db.localEntitiesPath == "" {
+		return nil
+	}
+
+	document := localEntityDocument{Beaches: []localBeach{}, Trails: []localTrail{}}
+
+	for _, b := range db.beaches {
+		if db.localEntities[b.ID] {
+			document.Beaches = append(document.Beaches, localBeach{
+				ID:           b.ID,
+				Name:         b.Name,
+				Description:  b.Description,
+				Geometry:     b.Geometry.Lines,
+				OpeningHours: b.OpeningHours,
+				DateCreated:  b.DateCreated,
+				DateModified: b.DateModified,
+			})
+		}
+	}
+
+	for _, t := range db.trails {
+		if db.localEntities[t.ID] {
+			document.Trails = append(document.Trails, localTrail{
+				ID:           t.ID,
+				Name:         t.Name,
+				Description:  t.Description,
+				Category:     t.Category,
+				Length:       t.Length,
+				AreaServed:   t.AreaServed,
+				Geometry:     t.Geometry.Lines,
+				Status:       db.trailStatuses[t.ID].source,
+				Difficulty:   db.givenDifficulties[t.ID],
+				DateCreated:  t.DateCreated,
+				DateModified: t.DateModified,
+			})
+		}
+	}
+
+	data, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	tmp := db.localEntitiesPath + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, db.localEntitiesPath)
+}
+
+func (db *myDB) addLocalBeach(beach domain.Beach) {
+	if beach.DateCreated.IsZero() {
+		beach.DateCreated = db.now().UTC()
+	}
+
+	if beach.DateModified.IsZero() {
+		beach.DateModified = beach.DateCreated
+	}
+
+	db.localEntities[beach.ID] = true
+	db.beaches = append(db.beaches, beach)
+}
+
+func (db *myDB) addLocalTrail(trail domain.ExerciseTrail) {
+	if trail.DateCreated.IsZero() {
+		trail.DateCreated = db.now().UTC()
+	}
+
+	if trail.DateModified.IsZero() {
+		trail.DateModified = trail.DateCreated
+	}
+
+	trail.ComputedLength = trail.Geometry.Length() / 1000.0
+
+	db.verifyTrailLength(&trail)
+	db.updateElevationProfile(&trail)
+	db.updateDifficulty(&trail, trail.Difficulty)
+
+	db.trailStatuses[trail.ID] = &trailStatusInputs{source: trail.Status}
+	db.localEntities[trail.ID] = true
+	db.trails = append(db.trails, trail)
+}
+
+//CreateBeach adds a locally managed beach that is kept alongside the beaches from the facility source
+func (db *myDB) CreateBeach(beach domain.Beach) error {
+	if err := validateLocalEntityID(beach.ID); err != nil {
+		return err
+	}
+
+	if beach.Name == "" || len(beach.Geometry.Lines) == 0 {
+		return fmt.Errorf("%w: a beach must have a name and a location", ErrInvalidAttributeValue)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.beachIndex(beach.ID) >= 0 {
+		return fmt.Errorf("%w: %s", ErrEntityExists, beach.ID)
+	}
+
+	db.addLocalBeach(beach)
+	db.notifyBeachChanged(beach.ID)
+
+	return db.saveLocalEntities()
+}
+
+//CreateTrail adds a locally managed exercise trail that is kept alongside the trails from the facility source
+func (db *myDB) CreateTrail(trail domain.ExerciseTrail) error {
+	if err := validateLocalEntityID(trail.ID); err != nil {
+		return err
+	}
+
+	if trail.Name == "" || len(trail.Geometry.Lines) < 2 {
+		return fmt.Errorf("%w: a trail must have a name and a location", ErrInvalidAttributeValue)
+	}
+
+	if trail.Status != "" && trail.Status != TrailStatusOpen && trail.Status != TrailStatusClosed {
+		return fmt.Errorf("%w: status must be either %s or %s", ErrInvalidAttributeValue, TrailStatusOpen, TrailStatusClosed)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, t := range db.trails {
+		if t.ID == trail.ID {
+			return fmt.Errorf("%w: %s", ErrEntityExists, trail.ID)
+		}
+	}
+
+	db.addLocalTrail(trail)
+	db.notifyTrailChanged(trail.ID)
+
+	return db.saveLocalEntities()
+}
+
+//DeleteBeach removes a locally managed beach together with its device assignments and readings
+func (db *myDB) DeleteBeach(beachID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	idx := db.beachIndex(beachID)
+	if idx < 0 {
+		return errors.New("not found")
+	}
+
+	if !db.localEntities[beachID] {
+		return fmt.Errorf("%w: %s", ErrNotLocallyManaged, beachID)
+	}
+
+	db.beaches = append(db.beaches[:idx], db.beaches[idx+1:]...)
+
+	assignments := []domain.DeviceAssignment{}
+	for _, a := range db.assignments {
+		if a.BeachID != beachID {
+			assignments = append(assignments, a)
+		}
+	}
+	db.assignments = assignments
+
+	delete(db.sensorReadings, beachID)
+	delete(db.sensorAggregation, beachID)
+	delete(db.localEntities, beachID)
+	db.removeIssues(beachID)
+	db.notifyChange(EntityTypeBeach, beachID, true)
+
+	if err := db.saveDeviceRegistry(); err != nil {
+		return err
+	}
+
+	return db.saveLocalEntities()
+}
+
+//DeleteTrail removes a locally managed exercise trail together with its status, schedule and history
+func (db *myDB) DeleteTrail(trailID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for idx, trail := range db.trails {
+		if trail.ID != trailID {
+			continue
+		}
+
+		if !db.localEntities[trailID] {
+			return fmt.Errorf("%w: %s", ErrNotLocallyManaged, trailID)
+		}
+
+		db.trails = append(db.trails[:idx], db.trails[idx+1:]...)
+
+		delete(db.trailStatuses, trailID)
+		delete(db.trailSchedules, trailID)
+		delete(db.preparations, trailID)
+		delete(db.elevationProfiles, trailID)
+		delete(db.givenDifficulties, trailID)
+		delete(db.localEntities, trailID)
+		db.removeIssues(trailID)
+		db.notifyChange(EntityTypeExerciseTrail, trailID, true)
+
+		if err := db.savePreparationHistory(); err != nil {
+			return err
+		}
+
+		return db.saveLocalEntities()
+	}
+
+	return errors.New("not found")
+}
+
+//removeIssues removes the data quality issues of an entity, or only those of the given attributes
+func (db *myDB) removeIssues(entityID string, attributes ...string) {
+	issues := []domain.DataQualityIssue{}
+	for _, issue := range db.issues {
+		if issue.EntityID != entityID || (len(attributes) > 0 && !contains(attributes, issue.Attribute)) {
+			issues = append(issues, issue)
+		}
+	}
+	db.issues = issues
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+//WithPreparationHistoryPath keeps the preparation history of trails in a file, so that the history of
+//a season survives restarts
+func WithPreparationHistoryPath(path string) Option {
+	return func(opts *options) {
+		opts.preparationHistoryPath = path
+	}
+}
+
+//loadPreparationHistory reads the preparation events of each trail, and restores the date of the last
+//preparation from the latest of them
+func (db *myDB) loadPreparationHistory() error {
+	if db.preparationHistoryPath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(db.preparationHistoryPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	document := map[string][]time.Time{}
+	err = json.Unmarshal(data, &document)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal preparation history from %s: %s", db.preparationHistoryPath, err.Error())
+	}
+
+	for idx, trail := range db.trails {
+		for _, preparedAt := range document[trail.ID] {
+			db.recordPreparation(trail.ID, preparedAt)
+
+			if preparedAt.After(trail.DateLastPrepared) {
+				trail.DateLastPrepared = preparedAt
+			}
+		}
+
+		db.trails[idx] = trail
+	}
+
+	db.log.Info().Msgf("loaded the preparation history of %d trails", len(db.preparations))
+
+	return nil
+}
+
+func (db *myDB) savePreparationHistory() error {
+	if db.preparationHistoryPath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(db.preparations)
+	if err != nil {
+		return err
+	}
+
+	tmp := db.preparationHistoryPath + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, db.preparationHistoryPath)
+}
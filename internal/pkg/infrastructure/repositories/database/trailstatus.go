@@ -0,0 +1,152 @@
+package database
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+)
+
+//go:embed seasons.json
+var defaultTrailSeasons []byte
+
+const (
+	TrailStatusOpen   string = "open"
+	TrailStatusClosed string = "closed"
+)
+
+//trailStatusInputs contains the statuses that have been reported for a trail by different sources
+type trailStatusInputs struct {
+	source   string
+	feed     string
+	override *domain.StatusOverride
+}
+
+//TrailSeasons limits the part of the year when trails of a category, such as ski-classic, can be open
+type TrailSeasons map[string]SeasonDefinition
+
+//WithTrailSeasons replaces the default seasons of trail categories
+func WithTrailSeasons(seasons TrailSeasons) Option {
+	return func(opts *options) {
+		opts.trailSeasons = seasons
+	}
+}
+
+//ParseTrailSeasons parses and validates a json document with seasons keyed by trail category
+func ParseTrailSeasons(data []byte) (TrailSeasons, error) {
+	seasons := TrailSeasons{}
+
+	err := json.Unmarshal(data, &seasons)
+	if err != nil {
+		return nil, err
+	}
+
+	for category, sd := range seasons {
+		if _, err := sd.parse(); err != nil {
+			return nil, fmt.Errorf("invalid season for category %s: %s", category, err.Error())
+		}
+	}
+
+	return seasons, nil
+}
+
+//trailSeason returns the season of the categories of a trail that the time is within or, if it is outside
+//all of them, the season of the first category that has one. Trails without seasonal categories have no season.
+func (db *myDB) trailSeason(trail domain.ExerciseTrail, now time.Time) *domain.Season {
+	var season *domain.Season
+
+	for _, category := range trail.Category {
+		categorySeason, ok := db.trailSeasons[category]
+		if !ok {
+			continue
+		}
+
+		if categorySeason.Contains(now) {
+			return &categorySeason
+		}
+
+		if season == nil {
+			season = &categorySeason
+		}
+	}
+
+	return season
+}
+
+//withEffectiveStatus resolves the status of a trail from, in order of precedence, a manual override,
+//the season of the trail, the preparation status feed and the status published by the facility source
+func (db *myDB) withEffectiveStatus(trail domain.ExerciseTrail) domain.ExerciseTrail {
+	now := db.now()
+	inputs, ok := db.trailStatuses[trail.ID]
+	if !ok {
+		inputs = &trailStatusInputs{}
+	}
+
+	trail.Season = db.trailSeason(trail, now)
+
+	if inputs.override != nil && (inputs.override.Until.IsZero() || now.Before(inputs.override.Until)) {
+		trail.Status = inputs.override.Status
+		trail.StatusReason = "manual override"
+		if inputs.override.Reason != "" {
+			trail.StatusReason = fmt.Sprintf("manual override: %s", inputs.override.Reason)
+		}
+	} else if trail.Season != nil && !trail.Season.Contains(now) {
+		trail.Status = TrailStatusClosed
+		trail.StatusReason = fmt.Sprintf("out of season (%s)", trail.Season.String())
+	} else if inputs.feed != "" {
+		trail.Status = inputs.feed
+		trail.StatusReason = "reported by the preparation status feed"
+	} else if inputs.source != "" {
+		trail.Status = inputs.source
+		trail.StatusReason = "published by the facility source"
+	} else {
+		trail.Status = ""
+		trail.StatusReason = ""
+	}
+
+	return trail
+}
+
+func (db *myDB) SetTrailOpenStatus(trailID string, isOpen bool) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	inputs, ok := db.trailStatuses[trailID]
+	if !ok {
+		return fmt.Errorf("not found")
+	}
+
+	feed := TrailStatusClosed
+	if isOpen {
+		feed = TrailStatusOpen
+	}
+
+	//the status feed is polled, so only changes of the reported status are announced
+	if inputs.feed != feed {
+		inputs.feed = feed
+		db.notifyTrailChanged(trailID)
+	}
+
+	return nil
+}
+
+func (db *myDB) SetTrailStatusOverride(trailID string, override *domain.StatusOverride) error {
+	if override != nil && override.Status != TrailStatusOpen && override.Status != TrailStatusClosed {
+		return fmt.Errorf("status must be either %s or %s", TrailStatusOpen, TrailStatusClosed)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	inputs, ok := db.trailStatuses[trailID]
+	if !ok {
+		return fmt.Errorf("not found")
+	}
+
+	inputs.override = override
+	db.notifyTrailChanged(trailID)
+
+	return nil
+}
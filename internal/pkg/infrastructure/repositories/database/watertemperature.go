@@ -0,0 +1,87 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/diwise/api-pointofinterest/internal/pkg/domain"
+)
+
+const (
+	//StaleWaterTemperatureFlag keeps stale water temperatures, but flags them as stale
+	StaleWaterTemperatureFlag string = "flag"
+	//StaleWaterTemperatureHide removes stale water temperatures from beaches
+	StaleWaterTemperatureHide string = "hide"
+)
+
+//DefaultWaterTemperatureMaxAge is the age after which a water temperature is considered stale
+const DefaultWaterTemperatureMaxAge time.Duration = 48 * time.Hour
+
+//WaterTemperatureStaleness decides what happens to water temperatures that are older than MaxAge
+type WaterTemperatureStaleness struct {
+	MaxAge time.Duration
+	Action string
+}
+
+//WithWaterTemperatureStaleness replaces the default rule for stale water temperatures
+func WithWaterTemperatureStaleness(staleness WaterTemperatureStaleness) Option {
+	return func(opts *options) {
+		opts.staleness = &staleness
+	}
+}
+
+//Validate checks that the staleness rule has a positive max age and a known action
+func (s WaterTemperatureStaleness) Validate() error {
+	if s.MaxAge <= 0 {
+		return fmt.Errorf("max age of water temperatures must be positive")
+	}
+
+	if s.Action != StaleWaterTemperatureFlag && s.Action != StaleWaterTemperatureHide {
+		return fmt.Errorf("unknown action %q for stale water temperatures", s.Action)
+	}
+
+	return nil
+}
+
+func (db *myDB) isStale(beach domain.Beach) bool {
+	return beach.WaterTemperature != nil && db.now().Sub(beach.WaterTemperatureObservedAt) > db.staleness.MaxAge
+}
+
+//withWaterTemperatureStaleness flags or hides the water temperature of a beach if it has not been
+//observed within the max age of the staleness rule
+func (db *myDB) withWaterTemperatureStaleness(beach domain.Beach) domain.Beach {
+	beach.WaterTemperatureStale = false
+
+	if !db.isStale(beach) {
+		return beach
+	}
+
+	if db.staleness.Action == StaleWaterTemperatureHide {
+		beach.WaterTemperature = nil
+		beach.WaterTemperatureObservedAt = time.Time{}
+	} else {
+		beach.WaterTemperatureStale = true
+	}
+
+	return beach
+}
+
+//staleWaterTemperatureIssues reports the beaches whose latest water temperature is stale
+func (db *myDB) staleWaterTemperatureIssues() []domain.DataQualityIssue {
+	issues := []domain.DataQualityIssue{}
+
+	for _, beach := range db.beaches {
+		if db.isStale(beach) {
+			issues = append(issues, domain.DataQualityIssue{
+				EntityID:  beach.ID,
+				Attribute: "waterTemperature",
+				Message: fmt.Sprintf(
+					"latest water temperature was observed at %s, more than %.0f hours ago",
+					beach.WaterTemperatureObservedAt.Format(time.RFC3339), db.staleness.MaxAge.Hours(),
+				),
+			})
+		}
+	}
+
+	return issues
+}
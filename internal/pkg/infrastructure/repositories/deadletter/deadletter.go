@@ -0,0 +1,186 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+//DefaultCapacity is the number of messages that are kept before the oldest are discarded
+const DefaultCapacity int = 1000
+
+//Message is a message that could not be processed, together with the reason it was rejected
+type Message struct {
+	ID          string    `json:"id"`
+	Topic       string    `json:"topic"`
+	Body        []byte    `json:"body"`
+	Reason      string    `json:"reason"`
+	ReceivedAt  time.Time `json:"receivedAt"`
+	Attempts    int       `json:"attempts"`
+	LastAttempt time.Time `json:"lastAttempt,omitempty"`
+}
+
+//Store keeps rejected messages so that they can be inspected and replayed
+type Store interface {
+	Add(topic string, body []byte, reason string) (*Message, error)
+	List() ([]Message, error)
+	Get(id string) (*Message, error)
+	RecordFailure(id, reason string) error
+	Remove(id string) error
+}
+
+//storeDocument is the format of the file that messages are saved to
+type storeDocument struct {
+	NextID   int       `json:"nextID"`
+	Messages []Message `json:"messages"`
+}
+
+type store struct {
+	mu       sync.Mutex
+	messages []Message
+	nextID   int
+	capacity int
+	path     string
+	now      func() time.Time
+}
+
+//NewStore creates a dead letter store that keeps up to capacity messages. If path is not empty the
+//messages are loaded from, and saved to, a json file at that path.
+func NewStore(path string, capacity int) (Store, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("capacity must be positive")
+	}
+
+	s := &store{
+		messages: []Message{},
+		capacity: capacity,
+		path:     path,
+		now:      time.Now,
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		if len(data) > 0 {
+			document := storeDocument{}
+			err = json.Unmarshal(data, &document)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal dead letters from %s: %s", path, err.Error())
+			}
+
+			s.nextID = document.NextID
+			if document.Messages != nil {
+				s.messages = document.Messages
+			}
+		}
+	}
+
+	return s, nil
+}
+
+//save writes all messages to the file of the store, through a temporary file so that a crash
+//does not leave a partially written file behind
+func (s *store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(storeDocument{NextID: s.nextID, Messages: s.messages})
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+func (s *store) indexOf(id string) int {
+	for idx, m := range s.messages {
+		if m.ID == id {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (s *store) Add(topic string, body []byte, reason string) (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	m := Message{
+		ID:         fmt.Sprintf("%d", s.nextID),
+		Topic:      topic,
+		Body:       append([]byte{}, body...),
+		Reason:     reason,
+		ReceivedAt: s.now().UTC(),
+	}
+
+	s.messages = append(s.messages, m)
+	if len(s.messages) > s.capacity {
+		s.messages = s.messages[len(s.messages)-s.capacity:]
+	}
+
+	return &m, s.save()
+}
+
+func (s *store) List() ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message{}, s.messages...), nil
+}
+
+func (s *store) Get(id string) (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := s.indexOf(id)
+	if idx < 0 {
+		return nil, errors.New("not found")
+	}
+
+	m := s.messages[idx]
+	return &m, nil
+}
+
+//RecordFailure updates the reason of a message after a replay attempt has failed
+func (s *store) RecordFailure(id, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := s.indexOf(id)
+	if idx < 0 {
+		return errors.New("not found")
+	}
+
+	s.messages[idx].Reason = reason
+	s.messages[idx].Attempts++
+	s.messages[idx].LastAttempt = s.now().UTC()
+
+	return s.save()
+}
+
+func (s *store) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := s.indexOf(id)
+	if idx < 0 {
+		return errors.New("not found")
+	}
+
+	s.messages = append(s.messages[:idx], s.messages[idx+1:]...)
+
+	return s.save()
+}
@@ -0,0 +1,49 @@
+package deadletter
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestThatOldestMessagesAreDiscardedAtCapacity(t *testing.T) {
+	is := is.New(t)
+
+	s, err := NewStore("", 2)
+	is.NoErr(err)
+
+	s.Add("topic", []byte("1"), "first")
+	s.Add("topic", []byte("2"), "second")
+	s.Add("topic", []byte("3"), "third")
+
+	messages, _ := s.List()
+	is.Equal(len(messages), 2)
+	is.Equal(messages[0].Reason, "second")
+}
+
+func TestThatMessagesArePersisted(t *testing.T) {
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "deadletters.json")
+
+	s, err := NewStore(path, DefaultCapacity)
+	is.NoErr(err)
+
+	first, _ := s.Add("topic", []byte(`{"temp":12}`), "unknown device")
+	s.Add("topic", []byte(`{}`), "missing timestamp")
+	is.NoErr(s.RecordFailure(first.ID, "still unknown device"))
+	is.NoErr(s.Remove("2"))
+
+	s, err = NewStore(path, DefaultCapacity)
+	is.NoErr(err)
+
+	messages, _ := s.List()
+	is.Equal(len(messages), 1)
+	is.Equal(messages[0].Reason, "still unknown device")
+	is.Equal(messages[0].Attempts, 1)
+	is.Equal(string(messages[0].Body), `{"temp":12}`)
+
+	added, _ := s.Add("topic", []byte(`{}`), "missing timestamp")
+	is.Equal(added.ID, "3") // ids should not be reused after a restart
+}